@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/zYoma/go-url-shortener/internal/app"
 	"github.com/zYoma/go-url-shortener/internal/config"
@@ -20,6 +22,12 @@ func main() {
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
+	// подкоманда migrate управляет схемой базы данных без запуска серверов
+	migrate := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if migrate {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	// получаем конфигурацию
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -31,10 +39,18 @@ func main() {
 		panic(err)
 	}
 
+	if migrate {
+		if err = app.Migrate(cfg, flag.Args(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// инициализация приложения
 	application, err := app.New(cfg)
 	if err != nil {
-		panic(err)
+		logger.Log.Sugar().Fatalf("Не удалось инициализировать приложение: %s", err)
 	}
 
 	// запускаем приложение
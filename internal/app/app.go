@@ -6,14 +6,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/zYoma/go-url-shortener/internal/app/server"
 	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/geoip"
 	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"github.com/zYoma/go-url-shortener/internal/storage"
+	"github.com/zYoma/go-url-shortener/internal/storage/breaker"
+	"github.com/zYoma/go-url-shortener/internal/storage/cache"
 	"github.com/zYoma/go-url-shortener/internal/storage/mem"
 	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
+	"github.com/zYoma/go-url-shortener/internal/storage/shard"
+	"github.com/zYoma/go-url-shortener/internal/storage/sqlite"
 )
 
 // App представляет основную структуру приложения, инкапсулирующую сервер и
@@ -23,10 +31,22 @@ type App struct {
 	Server     *server.HTTPServer
 	stopChan   chan int64
 	GRPCServer *server.GRPCServer
+	provider   storage.StorageProvider
+	// wg отслеживает фоновые горутины приложения, которые должны завершиться
+	// до закрытия хранилища.
+	wg *sync.WaitGroup
 }
 
-// ErrServerStoped описывает ошибку, возникающую при остановке сервера.
-var ErrServerStoped = errors.New("server stoped")
+// возможные ошибки пакета
+var (
+	// ErrServerStoped описывает ошибку, возникающую при остановке сервера.
+	ErrServerStoped = errors.New("server stoped")
+	// ErrKeyStore описывает ошибку, когда хранилище не поддерживает пул ключей.
+	ErrKeyStore = errors.New("storage does not support key pool")
+	// ErrBreakerWithoutCache описывает ошибку конфигурации, в которой выключатель
+	// включен без кеша редиректов, обслуживающего переходы, пока выключатель разомкнут.
+	ErrBreakerWithoutCache = errors.New("circuit breaker requires redirect cache")
+)
 
 // New инициализирует и возвращает новый экземпляр App, готовый к запуску.
 // Эта функция принимает конфигурацию приложения и на основе её параметров
@@ -35,6 +55,7 @@ var ErrServerStoped = errors.New("server stoped")
 // cfg: параметры конфигурации приложения.
 //
 // Возвращает инициализированный экземпляр App и ошибку, если таковая возникла.
+// Если приложение не удалось создать, созданное хранилище закрывается.
 func New(cfg *config.Config) (*App, error) {
 	// создаем провайдер для storage
 	provider, err := StorageConstructor(cfg)
@@ -42,18 +63,113 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
+	app, err := newApp(cfg, provider)
+	if err != nil {
+		if closeErr := provider.Close(); closeErr != nil {
+			logger.Log.Sugar().Errorf("Не удалось закрыть хранилище: %s", closeErr)
+		}
+		return nil, err
+	}
+	return app, nil
+}
+
+// newApp инициализирует хранилище provider и создаёт приложение. Фоновые горутины
+// запускаются только после всех проверок, которые могут завершиться ошибкой.
+func newApp(cfg *config.Config, provider storage.StorageProvider) (*App, error) {
 	// инициализируем провайдера
 	if err := provider.Init(); err != nil {
 		return nil, err
 	}
-	// канал для уведомления фоновой горутины об остановке приложения
-	stopChan := make(chan int64, 1)
+
+	// создаем генератор коротких URL
+	gen, err := generator.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if seq, ok := gen.(*generator.Sequence); ok {
+		if err := initSequence(seq, provider); err != nil {
+			return nil, err
+		}
+	}
+
+	var pool *generator.Pool
+	if cfg.KeyPoolChunk > 0 {
+		// короткие URL раздаются из заранее сгенерированного пула ключей; поддержку пула
+		// проверяет исходное хранилище, а ключи забираются через выключатель, если он включен
+		if _, ok := storage.As[storage.KeyStore](storage.Base(provider)); !ok {
+			return nil, ErrKeyStore
+		}
+		keyStore, _ := storage.As[storage.KeyStore](provider)
+		if pool, err = generator.NewPool(keyStore, gen, cfg.KeyPoolChunk); err != nil {
+			return nil, err
+		}
+		gen = pool
+	}
+
+	var geo *geoip.DB
+	if cfg.GeoIPPath != "" {
+		// переходы дополняются страной и городом клиента
+		if geo, err = geoip.Open(cfg.GeoIPPath, cfg.GeoIPReloadInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	// канал для уведомления фоновых горутин об остановке приложения,
+	// закрывается при остановке, чтобы сигнал получили все горутины
+	stopChan := make(chan int64)
+	var wg sync.WaitGroup
+
+	if pool != nil {
+		wg.Add(1)
+		go pool.Run(&wg, stopChan)
+	}
+
+	if sharded, ok := storage.As[*shard.Storage](provider); ok {
+		// ссылки переносятся на добавленные шарды в фоне
+		wg.Add(1)
+		go sharded.Rebalance(&wg, stopChan)
+	}
+
+	if c, ok := provider.(*cache.Storage); ok {
+		// изменения ссылок другими экземплярами приложения сбрасывают локальный кеш
+		if listener, ok := storage.As[storage.ChangeListener](provider); ok {
+			wg.Add(1)
+			go listener.ListenChanges(&wg, stopChan, c.HandleChange)
+		}
+	}
+
+	if geo != nil {
+		// новая версия файла базы GeoIP подхватывается в фоне
+		wg.Add(1)
+		go geo.Run(&wg, stopChan)
+	}
 
 	// создаем сервер
-	httpServer := server.New(provider, cfg, stopChan)
-	grpcServer := server.NewGRPC(cfg, provider)
+	httpServer := server.New(provider, cfg, stopChan, gen, geo)
+	grpcServer := server.NewGRPC(cfg, provider, gen)
 
-	return &App{Server: httpServer, stopChan: stopChan, GRPCServer: grpcServer}, nil
+	return &App{Server: httpServer, stopChan: stopChan, GRPCServer: grpcServer, provider: provider, wg: &wg}, nil
+}
+
+// initSequence настраивает последовательный генератор. Если хранилище раздаёт
+// диапазоны порядковых номеров, экземпляры приложения берут номера из общих
+// диапазонов, а диапазоны резервируются через выключатель, если он включен.
+// Хранилища без диапазонов используются одним экземпляром, поэтому для них
+// последовательность продолжается с количества уже сохранённых ссылок.
+// Возможные коллизии в обоих случаях разрешаются повторной генерацией.
+func initSequence(seq *generator.Sequence, provider storage.StorageProvider) error {
+	if _, ok := storage.As[storage.SequenceStore](storage.Base(provider)); ok {
+		store, _ := storage.As[storage.SequenceStore](provider)
+		seq.UseRanges(store)
+		return nil
+	}
+
+	stats, err := provider.GetServiceStats(context.Background())
+	if err != nil {
+		return err
+	}
+	seq.Seed(uint64(stats.URLS))
+	return nil
 }
 
 // Run запускает приложение, включая HTTP-сервер и обработку сигналов
@@ -67,7 +183,7 @@ func (s *App) Run() error {
 	defer stop()
 
 	// Создание канала для ошибок
-	errChan := make(chan error)
+	errChan := make(chan error, 2)
 
 	// запустить сервис
 	logger.Log.Info("start application")
@@ -87,33 +203,97 @@ func (s *App) Run() error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	// при сигнале завершения и при ошибке запуска сервера приложение
+	// останавливается одинаково, чтобы хранилище было закрыто
 	select {
 	case <-sigChan:
-		// уведомляем горутину что надо остановиться
-		s.stopChan <- 1
-		// При получении сигнала завершения останавливаем сервер
-		if err := s.Server.Shutdown(ctx); err != nil {
+		if err := s.shutdown(ctx); err != nil {
 			return err
 		}
-		s.GRPCServer.Stop()
 		return ErrServerStoped
 	case err := <-errChan:
-		return err
+		return errors.Join(err, s.shutdown(ctx))
 	}
+}
 
+// shutdown останавливает серверы и фоновые горутины и закрывает хранилище.
+func (s *App) shutdown(ctx context.Context) error {
+	// уведомляем горутины что надо остановиться
+	close(s.stopChan)
+	// останавливаем сервер; ошибка остановки не мешает закрыть хранилище
+	serverErr := s.Server.Shutdown(ctx)
+	s.GRPCServer.Stop()
+	// дожидаемся возврата неиспользованных ключей в пул и остановки подписки на изменения
+	s.wg.Wait()
+	// закрываем хранилище после остановки всех обработчиков
+	return errors.Join(serverErr, s.provider.Close())
 }
 
 // StorageConstructor в зависимости от конфигурации выбирает и возвращает
-// соответствующий провайдер хранилища данных для приложения.
+// соответствующий провайдер хранилища данных для приложения: шардированный
+// postgres, если заданы DSN шардов, SQLite для DSN со схемой sqlite://, postgres
+// для любого другого DSN и хранилище в памяти с файлом, если DSN не задан.
+// Если задан порог выключателя, провайдер оборачивается выключателем, а если
+// задан размер кеша - кешем редиректов, который обслуживает переходы, пока
+// выключатель разомкнут. Выключатель без кеша не включается, так как переходы
+// по ссылкам при разомкнутом выключателе были бы недоступны.
 //
 // cfg: параметры конфигурации, влияющие на выбор провайдера хранилища.
 //
 // Возвращает экземпляр провайдера хранилища и ошибку, если таковая возникла.
 func StorageConstructor(cfg *config.Config) (storage.StorageProvider, error) {
-	if cfg.DSN != "" {
+	if cfg.BreakerThreshold > 0 && cfg.CacheSize <= 0 {
+		return nil, ErrBreakerWithoutCache
+	}
+	provider, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BreakerThreshold > 0 {
+		logger.Log.Sugar().Infof("выключатель хранилища после %d ошибок подряд", cfg.BreakerThreshold)
+		provider = breaker.New(provider, cfg)
+	}
+	if cfg.CacheSize > 0 {
+		logger.Log.Sugar().Infof("кеш редиректов на %d записей", cfg.CacheSize)
+		return cache.New(provider, cfg), nil
+	}
+	return provider, nil
+}
+
+// newStorage создаёт провайдер хранилища по DSN.
+func newStorage(cfg *config.Config) (storage.StorageProvider, error) {
+	switch {
+	case len(cfg.ShardDSNs) > 0:
+		logger.Log.Sugar().Infof("провайдер - postgres, шардов: %d", len(cfg.ShardDSNs))
+		return newShards(cfg)
+	case strings.HasPrefix(cfg.DSN, sqlite.Scheme):
+		logger.Log.Sugar().Infof("провайдер - sqlite")
+		return sqlite.New(cfg)
+	case cfg.DSN != "":
 		logger.Log.Sugar().Infof("провайдер - postgres")
 		return postgres.New(cfg)
 	}
 	logger.Log.Sugar().Infof("провайдер - mem")
 	return mem.New(cfg)
 }
+
+// newShards создаёт шардированное хранилище над базами postgres из cfg.ShardDSNs.
+// Реплики для шардов не используются.
+func newShards(cfg *config.Config) (storage.StorageProvider, error) {
+	shards := make([]storage.StorageProvider, 0, len(cfg.ShardDSNs))
+	for _, dsn := range cfg.ShardDSNs {
+		shardCfg := *cfg
+		shardCfg.DSN = dsn
+		shardCfg.ReplicaDSNs = nil
+
+		provider, err := postgres.New(&shardCfg)
+		if err != nil {
+			for _, created := range shards {
+				_ = created.Close()
+			}
+			return nil, err
+		}
+		shards = append(shards, provider)
+	}
+	return shard.New(shards, cfg)
+}
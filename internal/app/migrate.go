@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
+	"github.com/zYoma/go-url-shortener/internal/storage/sqlite"
+)
+
+// возможные ошибки команды migrate
+var (
+	// ErrMigrateDSN описывает ошибку запуска миграций без DSN базы данных PostgreSQL или её шардов.
+	ErrMigrateDSN = errors.New("migrations require a postgres DSN")
+	// ErrMigrateUsage описывает ошибку неверных аргументов команды migrate.
+	ErrMigrateUsage = errors.New("usage: migrate up [version] | down [steps] | status | version")
+)
+
+// Migrate выполняет подкоманду migrate, не запуская серверы приложения.
+//
+// Поддерживаемые команды:
+//   - up [version] - применить все миграции или миграции до указанной версии;
+//   - down [steps] - откатить последние steps миграций (по умолчанию одну);
+//   - status - вывести список миграций и время их применения;
+//   - version - вывести текущую версию схемы.
+//
+// Если заданы DSN шардов, команда выполняется на каждом шарде по очереди, как
+// их выбирает приложение, а результат каждого шарда выводится под его номером.
+// Результат выполнения команды записывается в out.
+func Migrate(cfg *config.Config, args []string, out io.Writer) error {
+	dsns := cfg.ShardDSNs
+	if len(dsns) == 0 {
+		if cfg.DSN == "" || strings.HasPrefix(cfg.DSN, sqlite.Scheme) {
+			return ErrMigrateDSN
+		}
+		dsns = []string{cfg.DSN}
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return ErrMigrateUsage
+	}
+
+	for i, dsn := range dsns {
+		if len(cfg.ShardDSNs) > 0 {
+			fmt.Fprintf(out, "shard %d:\n", i)
+		}
+		dbCfg := *cfg
+		dbCfg.DSN = dsn
+		if err := migrate(&dbCfg, args, out); err != nil {
+			if len(cfg.ShardDSNs) > 0 {
+				return fmt.Errorf("shard %d: %w", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate выполняет команду migrate на базе данных cfg.DSN.
+func migrate(cfg *config.Config, args []string, out io.Writer) error {
+	migrator, err := postgres.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		var target int64
+		if len(args) == 2 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil || target <= 0 {
+				return ErrMigrateUsage
+			}
+		}
+		applied, err := migrator.Up(ctx, target)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", applied)
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return ErrMigrateUsage
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %d migration(s)\n", reverted)
+	case "status":
+		if len(args) != 1 {
+			return ErrMigrateUsage
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				// версия применена более новой версией приложения
+				appliedAt += " (unknown)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case "version":
+		if len(args) != 1 {
+			return ErrMigrateUsage
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		var version int64
+		for _, status := range statuses {
+			if status.AppliedAt != nil {
+				version = status.Version
+			}
+		}
+		fmt.Fprintln(out, version)
+	default:
+		return ErrMigrateUsage
+	}
+
+	return nil
+}
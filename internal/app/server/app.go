@@ -7,6 +7,8 @@ import (
 
 	"github.com/zYoma/go-url-shortener/internal/config"
 	"github.com/zYoma/go-url-shortener/internal/handlers"
+	"github.com/zYoma/go-url-shortener/internal/libs/geoip"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"github.com/zYoma/go-url-shortener/internal/storage"
 )
 
@@ -23,31 +25,41 @@ type HTTPServer struct {
 	// всех активных запросов перед остановкой сервера.
 	wg  *sync.WaitGroup
 	cfg *config.Config
+
+	// service нужен, чтобы после остановки сервера записать переходы,
+	// пришедшие от запросов, завершившихся уже после остановки фоновых горутин.
+	service *handlers.HandlerService
 }
 
 // New создает и возвращает новый экземпляр HTTPServer, готовый к запуску.
 // Эта функция принимает провайдер URL storage.URLProvider и конфигурацию
 // приложения cfg для инициализации внутренних компонентов, таких как обработчики
 // и HTTP-сервер. Также инициализируется WaitGroup для контроля за горутинами,
-// например, за фоновым удалением сообщений.
+// например, за фоновым удалением сообщений, пометкой истёкших ссылок и записью переходов.
 //
 // provider: компонент для взаимодействия с хранилищем URL.
 // cfg: конфигурационные параметры приложения, включая адрес запуска сервера.
+// gen: стратегия генерации коротких URL.
+// geo: база GeoIP, по которой переходы дополняются местоположением клиента, nil если не задана.
 //
 // Возвращает указатель на инициализированный HTTPServer.
 func New(
 	provider storage.URLProvider,
 	cfg *config.Config,
 	stopChan chan int64,
+	gen generator.Generator,
+	geo *geoip.DB,
 ) *HTTPServer {
 
 	// создаем сервис обработчик
-	service := handlers.New(provider, cfg)
+	service := handlers.New(provider, cfg, gen, geo)
 
-	// запускаем горутину для удаления сообщений
+	// запускаем горутины для удаления сообщений, пометки истёкших ссылок и записи переходов
 	var wg sync.WaitGroup
-	wg.Add(1) // если нужно будет запустить несколько горутин, инкриментировать в цикле
+	wg.Add(3)
 	go service.DeleteMessages(&wg, stopChan)
+	go service.ExpireLinks(&wg, stopChan)
+	go service.RecordClicks(&wg, stopChan)
 
 	// получаем роутер
 	router := service.GetRouter()
@@ -57,9 +69,10 @@ func New(
 		Handler: router,
 	}
 	return &HTTPServer{
-		server: server,
-		wg:     &wg,
-		cfg:    cfg,
+		server:  server,
+		wg:      &wg,
+		cfg:     cfg,
+		service: service,
 	}
 }
 
@@ -100,5 +113,8 @@ func (a *HTTPServer) Shutdown(ctx context.Context) error {
 	// ждем пока все горутины завершатся
 	// остановим приложение только после завершения фоновых задач
 	a.wg.Wait()
-	return a.server.Shutdown(ctx)
+	err := a.server.Shutdown(ctx)
+	// записываем переходы от запросов, которые завершились во время остановки
+	a.service.FlushClicks()
+	return err
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/zYoma/go-url-shortener/internal/config"
 	grpchandlers "github.com/zYoma/go-url-shortener/internal/handlers/grpc_handlers"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"github.com/zYoma/go-url-shortener/internal/storage"
 	pb "github.com/zYoma/go-url-shortener/proto"
 	"google.golang.org/grpc"
@@ -16,8 +17,8 @@ type GRPCServer struct {
 	service *grpchandlers.HandlerService
 }
 
-func NewGRPC(cfg *config.Config, provider storage.URLProvider) *GRPCServer {
-	service := grpchandlers.New(provider, cfg)
+func NewGRPC(cfg *config.Config, provider storage.URLProvider, gen generator.Generator) *GRPCServer {
+	service := grpchandlers.New(provider, cfg, gen)
 	return &GRPCServer{service: service}
 }
 
@@ -5,6 +5,9 @@ import (
 	"flag"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var flagRunAddr string
@@ -18,6 +21,36 @@ var flagCertPath string
 var flagCertKeyPath string
 var flagConfigFile string
 var flagTrustedSubnet string
+var flagMaxURLLength int
+var flagShortURLGenerator string
+var flagShortURLLength int
+var flagShortURLAlphabet string
+var flagKeyPoolChunk int
+var flagCacheSize int
+var flagCacheTTL time.Duration
+var flagCacheNegativeTTL time.Duration
+var flagReplicaDSN string
+var flagReplicaCheckInterval time.Duration
+var flagDBWaitTimeout time.Duration
+var flagDBRetryAttempts int
+var flagDBMaxConns int
+var flagDBMinConns int
+var flagDBMaxConnLifetime time.Duration
+var flagDBMaxConnIdleTime time.Duration
+var flagBreakerThreshold int
+var flagBreakerProbeInterval time.Duration
+var flagShardDSN string
+var flagShardRebalanceInterval time.Duration
+var flagAliasCharset string
+var flagAliasMinLength int
+var flagAliasMaxLength int
+var flagReservedAliases string
+var flagExpireInterval time.Duration
+var flagExpireBatch int
+var flagClickBufferSize int
+var flagClickFlushInterval time.Duration
+var flagGeoIPPath string
+var flagGeoIPReloadInterval time.Duration
 
 const (
 	envServerAddress = "SERVER_ADDRESS"
@@ -31,33 +64,140 @@ const (
 	envCertKeyPath   = "CERT_KEY_PATH"
 	envConfigFile    = "CONFIG"
 	envTrustedSubnet = "TRUSTED_SUBNET"
+	envMaxURLLength  = "MAX_URL_LENGTH"
+	envGenerator     = "SHORT_URL_GENERATOR"
+	envShortLength   = "SHORT_URL_LENGTH"
+	envAlphabet      = "SHORT_URL_ALPHABET"
+	envKeyPoolChunk  = "KEY_POOL_CHUNK"
+	envCacheSize     = "CACHE_SIZE"
+	envCacheTTL      = "CACHE_TTL"
+	envCacheNegTTL   = "CACHE_NEGATIVE_TTL"
+	envReplicaDSN    = "DATABASE_REPLICA_DSN"
+	envReplicaCheck  = "REPLICA_CHECK_INTERVAL"
+	envDBWait        = "DB_WAIT_TIMEOUT"
+	envDBRetry       = "DB_RETRY_ATTEMPTS"
+	envDBMaxConns    = "DB_MAX_CONNS"
+	envDBMinConns    = "DB_MIN_CONNS"
+	envDBLifetime    = "DB_MAX_CONN_LIFETIME"
+	envDBIdleTime    = "DB_MAX_CONN_IDLE_TIME"
+	envBreakerFails  = "BREAKER_THRESHOLD"
+	envBreakerProbe  = "BREAKER_PROBE_INTERVAL"
+	envShardDSN      = "DATABASE_SHARD_DSN"
+	envRebalance     = "SHARD_REBALANCE_INTERVAL"
+	envAliasCharset  = "ALIAS_CHARSET"
+	envAliasMin      = "ALIAS_MIN_LENGTH"
+	envAliasMax      = "ALIAS_MAX_LENGTH"
+	envAliasReserved = "ALIAS_RESERVED"
+	envExpireEvery   = "EXPIRE_INTERVAL"
+	envExpireBatch   = "EXPIRE_BATCH_SIZE"
+	envClickBuffer   = "CLICK_BUFFER_SIZE"
+	envClickFlush    = "CLICK_FLUSH_INTERVAL"
+	envGeoIPPath     = "GEOIP_PATH"
+	envGeoIPReload   = "GEOIP_RELOAD_INTERVAL"
 )
 
 // Config определяет конфигурацию приложения, собираемую из аргументов командной строки и переменных окружения.
 type Config struct {
-	RunAddr       string // Адрес и порт для запуска сервера.
-	BaseShortURL  string // Базовый URL для коротких ссылок.
-	LogLevel      string // Уровень логирования.
-	StorageFile   string // Имя файла для хранения данных.
-	DSN           string // Data Source Name для подключения к БД.
-	TokenSecret   string // Секрет для подписи JWT токенов.
-	EnableHTTPS   bool   // Включить HTTPS
-	CertPath      string // путь до файла с сертификатом
-	CertKeyPath   string // путь до ключа
-	TrustedSubnet string // разрешенная подсеть
+	RunAddr           string // Адрес и порт для запуска сервера.
+	BaseShortURL      string // Базовый URL для коротких ссылок.
+	LogLevel          string // Уровень логирования.
+	StorageFile       string // Имя файла для хранения данных.
+	DSN               string // Data Source Name для подключения к БД (postgres или sqlite://путь).
+	TokenSecret       string // Секрет для подписи JWT токенов.
+	EnableHTTPS       bool   // Включить HTTPS
+	CertPath          string // путь до файла с сертификатом
+	CertKeyPath       string // путь до ключа
+	TrustedSubnet     string // разрешенная подсеть
+	MaxURLLength      int    // максимальная длина сокращаемого URL, 0 - без ограничений
+	ShortURLGenerator string // стратегия генерации коротких URL: random, sequence или hash
+	ShortURLLength    int    // длина короткого URL
+	ShortURLAlphabet  string // символы, из которых состоит короткий URL
+	KeyPoolChunk      int    // количество ключей, забираемых из пула за раз, 0 - пул не используется
+	CacheSize         int    // количество ссылок в кеше переходов, 0 - кеш отключен
+
+	CacheTTL         time.Duration // время жизни ссылки в кеше
+	CacheNegativeTTL time.Duration // время жизни в кеше отметки о ненайденной ссылке
+
+	ReplicaDSNs          []string      // DSN реплик postgres для чтения
+	ReplicaCheckInterval time.Duration // период проверки доступности реплик
+
+	DBWaitTimeout     time.Duration // сколько ждать доступности БД при запуске, 0 - не ждать
+	DBRetryAttempts   int           // количество попыток запроса к БД при временных ошибках
+	DBMaxConns        int           // максимальное количество соединений в пуле, 0 - по умолчанию pgx
+	DBMinConns        int           // минимальное количество соединений в пуле
+	DBMaxConnLifetime time.Duration // максимальное время жизни соединения
+	DBMaxConnIdleTime time.Duration // максимальное время простоя соединения
+
+	BreakerThreshold     int           // количество ошибок недоступности хранилища подряд, размыкающее выключатель, 0 - выключатель отключен, требует CacheSize
+	BreakerProbeInterval time.Duration // период проверки недоступного хранилища
+
+	ShardDSNs              []string      // DSN шардов postgres, новые шарды добавляются в конец списка
+	ShardRebalanceInterval time.Duration // период переноса ссылок между шардами, 0 - перенос отключен и ссылки ищутся на всех шардах
+
+	AliasCharset    string   // символы, из которых может состоять псевдоним ссылки
+	AliasMinLength  int      // минимальная длина псевдонима
+	AliasMaxLength  int      // максимальная длина псевдонима
+	ReservedAliases []string // слова, которые нельзя использовать как псевдонимы, кроме маршрутов сервиса
+
+	ExpireInterval  time.Duration // период пометки удалёнными ссылок с истёкшим сроком действия
+	ExpireBatchSize int           // количество ссылок, помечаемых удалёнными одним запросом
+
+	ClickBufferSize    int           // сколько переходов по ссылкам может ждать записи, лишние отбрасываются
+	ClickFlushInterval time.Duration // период записи накопленных переходов по ссылкам
+
+	GeoIPPath           string        // путь к базе GeoIP в формате MaxMind (.mmdb), пустой - переходы не дополняются страной и городом
+	GeoIPReloadInterval time.Duration // период проверки изменения файла базы GeoIP
 }
 
 type fileConfig struct {
-	ServerAddress   string `json:"server_address"`
-	BaseURL         string `json:"base_url"`
-	LogLevel        string `json:"log_level"`
-	FileStoragePath string `json:"file_storage_path"`
-	DatabaseDSN     string `json:"database_dsn"`
-	TokenSecret     string `json:"token_secret"`
-	EnableHTTPS     bool   `json:"enable_https"`
-	CertPath        string `json:"cert_path"`
-	CertKeyPath     string `json:"cert_key_path"`
-	TrustedSubnet   string `json:"trusted_subnet"`
+	ServerAddress     string `json:"server_address"`
+	BaseURL           string `json:"base_url"`
+	LogLevel          string `json:"log_level"`
+	FileStoragePath   string `json:"file_storage_path"`
+	DatabaseDSN       string `json:"database_dsn"`
+	TokenSecret       string `json:"token_secret"`
+	EnableHTTPS       bool   `json:"enable_https"`
+	CertPath          string `json:"cert_path"`
+	CertKeyPath       string `json:"cert_key_path"`
+	TrustedSubnet     string `json:"trusted_subnet"`
+	MaxURLLength      int    `json:"max_url_length"`
+	ShortURLGenerator string `json:"short_url_generator"`
+	ShortURLLength    int    `json:"short_url_length"`
+	ShortURLAlphabet  string `json:"short_url_alphabet"`
+	KeyPoolChunk      int    `json:"key_pool_chunk"`
+	CacheSize         int    `json:"cache_size"`
+	CacheTTL          string `json:"cache_ttl"`
+	CacheNegativeTTL  string `json:"cache_negative_ttl"`
+
+	DatabaseReplicaDSNs  []string `json:"database_replica_dsns"`
+	ReplicaCheckInterval string   `json:"replica_check_interval"`
+
+	DBWaitTimeout     string `json:"db_wait_timeout"`
+	DBRetryAttempts   int    `json:"db_retry_attempts"`
+	DBMaxConns        int    `json:"db_max_conns"`
+	DBMinConns        int    `json:"db_min_conns"`
+	DBMaxConnLifetime string `json:"db_max_conn_lifetime"`
+	DBMaxConnIdleTime string `json:"db_max_conn_idle_time"`
+
+	BreakerThreshold     int    `json:"breaker_threshold"`
+	BreakerProbeInterval string `json:"breaker_probe_interval"`
+
+	DatabaseShardDSNs      []string `json:"database_shard_dsns"`
+	ShardRebalanceInterval string   `json:"shard_rebalance_interval"`
+
+	AliasCharset   string   `json:"alias_charset"`
+	AliasMinLength int      `json:"alias_min_length"`
+	AliasMaxLength int      `json:"alias_max_length"`
+	AliasReserved  []string `json:"alias_reserved"`
+
+	ExpireInterval  string `json:"expire_interval"`
+	ExpireBatchSize int    `json:"expire_batch_size"`
+
+	ClickBufferSize    int    `json:"click_buffer_size"`
+	ClickFlushInterval string `json:"click_flush_interval"`
+
+	GeoIPPath           string `json:"geoip_path"`
+	GeoIPReloadInterval string `json:"geoip_reload_interval"`
 }
 
 func parseConfigFile(filePath string) (*fileConfig, error) {
@@ -93,6 +233,36 @@ func GetConfig() (*Config, error) {
 	flag.StringVar(&flagCertKeyPath, "ck", "", "path to cert key")
 	flag.StringVar(&flagConfigFile, "c", "config.json", "path to config file")
 	flag.StringVar(&flagTrustedSubnet, "t", "", "trusted subnet")
+	flag.IntVar(&flagMaxURLLength, "ul", 0, "max URL length, 0 - unlimited")
+	flag.StringVar(&flagShortURLGenerator, "g", "", "short url generator: random, sequence or hash")
+	flag.IntVar(&flagShortURLLength, "sl", 0, "short url length")
+	flag.StringVar(&flagShortURLAlphabet, "sa", "", "short url alphabet of A-Z, a-z, 0-9 and -._~ characters")
+	flag.IntVar(&flagKeyPoolChunk, "kc", 0, "key pool chunk size, 0 - key pool disabled")
+	flag.IntVar(&flagCacheSize, "cs", 0, "redirect cache size, 0 - cache disabled")
+	flag.DurationVar(&flagCacheTTL, "ct", 0, "redirect cache TTL")
+	flag.DurationVar(&flagCacheNegativeTTL, "cn", 0, "redirect cache TTL for not found links")
+	flag.StringVar(&flagReplicaDSN, "rd", "", "comma-separated DSNs of postgres read replicas")
+	flag.DurationVar(&flagReplicaCheckInterval, "ri", 0, "replica health check interval")
+	flag.DurationVar(&flagDBWaitTimeout, "dw", 0, "how long to wait for the database at startup, 0 - do not wait")
+	flag.IntVar(&flagDBRetryAttempts, "dr", 0, "attempts of database queries on transient errors")
+	flag.IntVar(&flagDBMaxConns, "dmax", 0, "max database pool connections")
+	flag.IntVar(&flagDBMinConns, "dmin", 0, "min database pool connections")
+	flag.DurationVar(&flagDBMaxConnLifetime, "dlt", 0, "max database connection lifetime")
+	flag.DurationVar(&flagDBMaxConnIdleTime, "dit", 0, "max database connection idle time")
+	flag.IntVar(&flagBreakerThreshold, "bt", 0, "consecutive storage failures that open the circuit breaker, 0 - disabled, requires -cs")
+	flag.DurationVar(&flagBreakerProbeInterval, "bp", 0, "storage health probe interval while the circuit breaker is open")
+	flag.StringVar(&flagShardDSN, "sd", "", "comma-separated DSNs of postgres shards, new shards go to the end")
+	flag.DurationVar(&flagShardRebalanceInterval, "sri", 0, "interval of moving links between shards, 0 - disabled")
+	flag.StringVar(&flagAliasCharset, "ac", "", "characters allowed in custom aliases")
+	flag.IntVar(&flagAliasMinLength, "amin", 0, "min custom alias length")
+	flag.IntVar(&flagAliasMaxLength, "amax", 0, "max custom alias length")
+	flag.StringVar(&flagReservedAliases, "ar", "", "comma-separated words that cannot be used as custom aliases")
+	flag.DurationVar(&flagExpireInterval, "ei", 0, "interval of marking expired links as deleted")
+	flag.IntVar(&flagExpireBatch, "eb", 0, "number of expired links marked as deleted per query")
+	flag.IntVar(&flagClickBufferSize, "cbs", 0, "number of clicks waiting to be saved, extra clicks are dropped")
+	flag.DurationVar(&flagClickFlushInterval, "cfi", 0, "interval of saving recorded clicks")
+	flag.StringVar(&flagGeoIPPath, "geoip", "", "path to MaxMind GeoIP database (.mmdb) used to add country and city to clicks")
+	flag.DurationVar(&flagGeoIPReloadInterval, "gri", 0, "interval of checking the GeoIP database file for changes")
 	flag.Parse()
 
 	// если есть переменные окружения, используем их значения
@@ -129,6 +299,63 @@ func GetConfig() (*Config, error) {
 		flagTrustedSubnet = envSubnet
 	}
 
+	if envGen := os.Getenv(envGenerator); envGen != "" {
+		flagShortURLGenerator = envGen
+	}
+	if envAlpha := os.Getenv(envAlphabet); envAlpha != "" {
+		flagShortURLAlphabet = envAlpha
+	}
+	if envReplicas := os.Getenv(envReplicaDSN); envReplicas != "" {
+		flagReplicaDSN = envReplicas
+	}
+	if envShards := os.Getenv(envShardDSN); envShards != "" {
+		flagShardDSN = envShards
+	}
+	if envCharset := os.Getenv(envAliasCharset); envCharset != "" {
+		flagAliasCharset = envCharset
+	}
+	if envReserved := os.Getenv(envAliasReserved); envReserved != "" {
+		flagReservedAliases = envReserved
+	}
+	if envGeoIP := os.Getenv(envGeoIPPath); envGeoIP != "" {
+		flagGeoIPPath = envGeoIP
+	}
+	for name, value := range map[string]*time.Duration{
+		envCacheTTL:     &flagCacheTTL,
+		envCacheNegTTL:  &flagCacheNegativeTTL,
+		envReplicaCheck: &flagReplicaCheckInterval,
+		envDBWait:       &flagDBWaitTimeout,
+		envDBLifetime:   &flagDBMaxConnLifetime,
+		envDBIdleTime:   &flagDBMaxConnIdleTime,
+		envBreakerProbe: &flagBreakerProbeInterval,
+		envRebalance:    &flagShardRebalanceInterval,
+		envExpireEvery:  &flagExpireInterval,
+		envClickFlush:   &flagClickFlushInterval,
+		envGeoIPReload:  &flagGeoIPReloadInterval,
+	} {
+		if err := setDurationFromEnv(value, name); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range map[string]*int{
+		envMaxURLLength: &flagMaxURLLength,
+		envShortLength:  &flagShortURLLength,
+		envKeyPoolChunk: &flagKeyPoolChunk,
+		envCacheSize:    &flagCacheSize,
+		envDBRetry:      &flagDBRetryAttempts,
+		envDBMaxConns:   &flagDBMaxConns,
+		envDBMinConns:   &flagDBMinConns,
+		envBreakerFails: &flagBreakerThreshold,
+		envAliasMin:     &flagAliasMinLength,
+		envAliasMax:     &flagAliasMaxLength,
+		envExpireBatch:  &flagExpireBatch,
+		envClickBuffer:  &flagClickBufferSize,
+	} {
+		if err := setIntFromEnv(value, name); err != nil {
+			return nil, err
+		}
+	}
+
 	confFromFile, err := parseConfigFile(flagConfigFile)
 	if err != nil {
 		return nil, err
@@ -145,19 +372,109 @@ func GetConfig() (*Config, error) {
 		setValueFromFileConfig(&flagCertPath, confFromFile.CertPath)
 		setValueFromFileConfig(&flagCertKeyPath, confFromFile.CertKeyPath)
 		setValueFromFileConfig(&flagTrustedSubnet, confFromFile.TrustedSubnet)
+		setValueFromFileConfig(&flagMaxURLLength, confFromFile.MaxURLLength)
+		setValueFromFileConfig(&flagShortURLGenerator, confFromFile.ShortURLGenerator)
+		setValueFromFileConfig(&flagShortURLLength, confFromFile.ShortURLLength)
+		setValueFromFileConfig(&flagShortURLAlphabet, confFromFile.ShortURLAlphabet)
+		setValueFromFileConfig(&flagKeyPoolChunk, confFromFile.KeyPoolChunk)
+		setValueFromFileConfig(&flagCacheSize, confFromFile.CacheSize)
+		if err = setDurationFromFileConfig(&flagCacheTTL, confFromFile.CacheTTL); err != nil {
+			return nil, err
+		}
+		if err = setDurationFromFileConfig(&flagCacheNegativeTTL, confFromFile.CacheNegativeTTL); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagReplicaDSN, strings.Join(confFromFile.DatabaseReplicaDSNs, ","))
+		if err = setDurationFromFileConfig(&flagReplicaCheckInterval, confFromFile.ReplicaCheckInterval); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagDBRetryAttempts, confFromFile.DBRetryAttempts)
+		setValueFromFileConfig(&flagDBMaxConns, confFromFile.DBMaxConns)
+		setValueFromFileConfig(&flagDBMinConns, confFromFile.DBMinConns)
+		if err = setDurationFromFileConfig(&flagDBWaitTimeout, confFromFile.DBWaitTimeout); err != nil {
+			return nil, err
+		}
+		if err = setDurationFromFileConfig(&flagDBMaxConnLifetime, confFromFile.DBMaxConnLifetime); err != nil {
+			return nil, err
+		}
+		if err = setDurationFromFileConfig(&flagDBMaxConnIdleTime, confFromFile.DBMaxConnIdleTime); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagBreakerThreshold, confFromFile.BreakerThreshold)
+		if err = setDurationFromFileConfig(&flagBreakerProbeInterval, confFromFile.BreakerProbeInterval); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagShardDSN, strings.Join(confFromFile.DatabaseShardDSNs, ","))
+		if err = setDurationFromFileConfig(&flagShardRebalanceInterval, confFromFile.ShardRebalanceInterval); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagAliasCharset, confFromFile.AliasCharset)
+		setValueFromFileConfig(&flagAliasMinLength, confFromFile.AliasMinLength)
+		setValueFromFileConfig(&flagAliasMaxLength, confFromFile.AliasMaxLength)
+		setValueFromFileConfig(&flagReservedAliases, strings.Join(confFromFile.AliasReserved, ","))
+		if err = setDurationFromFileConfig(&flagExpireInterval, confFromFile.ExpireInterval); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagExpireBatch, confFromFile.ExpireBatchSize)
+		setValueFromFileConfig(&flagClickBufferSize, confFromFile.ClickBufferSize)
+		if err = setDurationFromFileConfig(&flagClickFlushInterval, confFromFile.ClickFlushInterval); err != nil {
+			return nil, err
+		}
+		setValueFromFileConfig(&flagGeoIPPath, confFromFile.GeoIPPath)
+		if err = setDurationFromFileConfig(&flagGeoIPReloadInterval, confFromFile.GeoIPReloadInterval); err != nil {
+			return nil, err
+		}
 	}
 
 	return &Config{
-		RunAddr:       flagRunAddr,
-		BaseShortURL:  flagBaseShortURL,
-		LogLevel:      flagLogLevel,
-		StorageFile:   flagStorageFileNmae,
-		DSN:           flagDSN,
-		TokenSecret:   flagTokenSecret,
-		EnableHTTPS:   flagHTTPS,
-		CertPath:      flagCertPath,
-		CertKeyPath:   flagCertKeyPath,
-		TrustedSubnet: flagTrustedSubnet,
+		RunAddr:           flagRunAddr,
+		BaseShortURL:      flagBaseShortURL,
+		LogLevel:          flagLogLevel,
+		StorageFile:       flagStorageFileNmae,
+		DSN:               flagDSN,
+		TokenSecret:       flagTokenSecret,
+		EnableHTTPS:       flagHTTPS,
+		CertPath:          flagCertPath,
+		CertKeyPath:       flagCertKeyPath,
+		TrustedSubnet:     flagTrustedSubnet,
+		MaxURLLength:      flagMaxURLLength,
+		ShortURLGenerator: flagShortURLGenerator,
+		ShortURLLength:    flagShortURLLength,
+		ShortURLAlphabet:  flagShortURLAlphabet,
+		KeyPoolChunk:      flagKeyPoolChunk,
+		CacheSize:         flagCacheSize,
+		CacheTTL:          flagCacheTTL,
+		CacheNegativeTTL:  flagCacheNegativeTTL,
+
+		ReplicaDSNs:          splitList(flagReplicaDSN),
+		ReplicaCheckInterval: flagReplicaCheckInterval,
+
+		DBWaitTimeout:     flagDBWaitTimeout,
+		DBRetryAttempts:   flagDBRetryAttempts,
+		DBMaxConns:        flagDBMaxConns,
+		DBMinConns:        flagDBMinConns,
+		DBMaxConnLifetime: flagDBMaxConnLifetime,
+		DBMaxConnIdleTime: flagDBMaxConnIdleTime,
+
+		BreakerThreshold:     flagBreakerThreshold,
+		BreakerProbeInterval: flagBreakerProbeInterval,
+
+		ShardDSNs:              splitList(flagShardDSN),
+		ShardRebalanceInterval: flagShardRebalanceInterval,
+
+		AliasCharset:    flagAliasCharset,
+		AliasMinLength:  flagAliasMinLength,
+		AliasMaxLength:  flagAliasMaxLength,
+		ReservedAliases: splitList(flagReservedAliases),
+
+		ExpireInterval:  flagExpireInterval,
+		ExpireBatchSize: flagExpireBatch,
+
+		ClickBufferSize:    flagClickBufferSize,
+		ClickFlushInterval: flagClickFlushInterval,
+
+		GeoIPPath:           flagGeoIPPath,
+		GeoIPReloadInterval: flagGeoIPReloadInterval,
 	}, nil
 }
 
@@ -167,7 +484,7 @@ func nilValue[T comparable]() T {
 }
 
 // setValueFromFileConfig проставляет значения из файла конфигурации, если текущее значение пустое
-// дженерики использовал чтобы работать как с bool так и со строкой
+// дженерики использовал чтобы работать как с bool, так и со строкой и числом
 func setValueFromFileConfig[T comparable](varPtr *T, varFile T) {
 	if varPtr == nil {
 		// Обрабатываем случай, когда varPtr является nil
@@ -175,7 +492,7 @@ func setValueFromFileConfig[T comparable](varPtr *T, varFile T) {
 	}
 
 	switch reflect.TypeOf(*varPtr).Kind() {
-	case reflect.String:
+	case reflect.String, reflect.Int:
 		if *varPtr == nilValue[T]() && varFile != nilValue[T]() {
 			*varPtr = varFile
 		}
@@ -185,3 +502,56 @@ func setValueFromFileConfig[T comparable](varPtr *T, varFile T) {
 		}
 	}
 }
+
+// setDurationFromFileConfig проставляет длительность из файла конфигурации, если текущее значение
+// не задано. В файле длительность записывается строкой в формате time.ParseDuration, например "5m".
+func setDurationFromFileConfig(varPtr *time.Duration, varFile string) error {
+	if *varPtr != 0 || varFile == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(varFile)
+	if err != nil {
+		return err
+	}
+	*varPtr = d
+	return nil
+}
+
+// setIntFromEnv проставляет число из переменной окружения name, если она задана.
+func setIntFromEnv(varPtr *int, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*varPtr = n
+	return nil
+}
+
+// setDurationFromEnv проставляет длительность из переменной окружения name, если она задана.
+func setDurationFromEnv(varPtr *time.Duration, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*varPtr = d
+	return nil
+}
+
+// splitList разбивает строку со значениями через запятую, пропуская пустые значения.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
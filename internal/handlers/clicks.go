@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultClickBufferSize - сколько переходов может ждать записи по умолчанию.
+	defaultClickBufferSize = 10000
+	// defaultClickFlushInterval - период записи накопленных переходов по умолчанию.
+	defaultClickFlushInterval = 5 * time.Second
+	// clickBatchSize - количество переходов, при накоплении которого они записываются, не дожидаясь таймера.
+	clickBatchSize = 1000
+	// maxClickHeaderLength - максимальная длина сохраняемых заголовков Referer и User-Agent.
+	maxClickHeaderLength = 512
+)
+
+// queuedClick описывает переход, ожидающий записи. Адрес клиента хранится
+// целиком, чтобы сеть и местоположение клиента определялись при записи,
+// а не на пути редиректа.
+type queuedClick struct {
+	click models.Click
+	ip    net.IP
+}
+
+// newClickBuffer создаёт буфер переходов, если хранилище умеет их сохранять.
+func newClickBuffer(provider storage.URLProvider, cfg *config.Config) chan queuedClick {
+	if _, ok := storage.As[storage.ClickStore](provider); !ok {
+		return nil
+	}
+	size := cfg.ClickBufferSize
+	if size <= 0 {
+		size = defaultClickBufferSize
+	}
+	return make(chan queuedClick, size)
+}
+
+// recordClick передаёт переход по ссылке shortURL на запись. Переход не ждёт
+// записи: если буфер заполнен, переход отбрасывается и учитывается в droppedClicks.
+func (h *HandlerService) recordClick(req *http.Request, shortURL string) {
+	if h.clicks == nil {
+		return
+	}
+
+	queued := queuedClick{
+		click: models.Click{
+			ShortURL:  shortURL,
+			Time:      time.Now().UTC(),
+			Referrer:  truncateHeader(req.Referer()),
+			UserAgent: truncateHeader(req.UserAgent()),
+		},
+	}
+	if ip, err := clientIP(req); err == nil {
+		queued.ip = ip
+	}
+
+	select {
+	case h.clicks <- queued:
+	default:
+		h.droppedClicks.Add(1)
+	}
+}
+
+// RecordClicks постоянно слушает канал clicks и записывает переходы по ссылкам
+// в хранилище пачками: по таймеру или при накоплении clickBatchSize переходов.
+// При получении сигнала завершения записывает переходы, оставшиеся в канале.
+//
+// wg *sync.WaitGroup: группа ожидания для синхронизации завершения горутины.
+// stopChan chan int64: канал для получения сигнала о необходимости завершения работы.
+func (h *HandlerService) RecordClicks(wg *sync.WaitGroup, stopChan chan int64) {
+	defer wg.Done()
+
+	store, ok := storage.As[storage.ClickStore](h.provider)
+	if !ok || h.clicks == nil {
+		return
+	}
+
+	interval := h.cfg.ClickFlushInterval
+	if interval <= 0 {
+		interval = defaultClickFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var clicks []models.Click
+
+	for {
+		select {
+		case queued := <-h.clicks:
+			clicks = append(clicks, h.resolveClick(queued))
+			if len(clicks) >= clickBatchSize {
+				h.saveClicks(store, &clicks)
+			}
+		case <-ticker.C:
+			h.saveClicks(store, &clicks)
+		case <-stopChan:
+			// сигнал остановки приложения, забираем переходы, оставшиеся в канале
+			for len(h.clicks) > 0 {
+				clicks = append(clicks, h.resolveClick(<-h.clicks))
+			}
+			h.saveClicks(store, &clicks)
+			return
+		}
+	}
+}
+
+// FlushClicks синхронно записывает переходы, оставшиеся в канале. Вызывается
+// после остановки HTTP-сервера и завершения RecordClicks, чтобы не потерять
+// переходы от запросов, обработанных во время остановки.
+func (h *HandlerService) FlushClicks() {
+	store, ok := storage.As[storage.ClickStore](h.provider)
+	if !ok || h.clicks == nil {
+		return
+	}
+
+	var clicks []models.Click
+	for len(h.clicks) > 0 {
+		clicks = append(clicks, h.resolveClick(<-h.clicks))
+	}
+	h.saveClicks(store, &clicks)
+}
+
+// resolveClick дополняет переход сетью клиента и, если задана база GeoIP,
+// страной и городом клиента.
+func (h *HandlerService) resolveClick(queued queuedClick) models.Click {
+	click := queued.click
+	if queued.ip == nil {
+		return click
+	}
+	click.IPPrefix = ipPrefix(queued.ip)
+	location := h.geo.Lookup(queued.ip)
+	click.Country, click.City = location.Country, location.City
+	return click
+}
+
+// saveClicks записывает накопленные переходы и очищает список. Если записать
+// не удалось, переходы остаются в списке до следующей попытки, но не больше
+// размера буфера: самые старые переходы отбрасываются.
+func (h *HandlerService) saveClicks(store storage.ClickStore, clicks *[]models.Click) {
+	if dropped := h.droppedClicks.Swap(0); dropped > 0 {
+		logger.Log.Warn("clicks dropped: buffer is full", zap.Uint64("count", dropped))
+	}
+	if len(*clicks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := store.SaveClicks(ctx, *clicks); err != nil {
+		logger.Log.Debug("cannot save clicks", zap.Error(err))
+		if extra := len(*clicks) - cap(h.clicks); extra > 0 {
+			logger.Log.Warn("clicks dropped: storage is not available", zap.Int("count", extra))
+			*clicks = (*clicks)[extra:]
+		}
+		return
+	}
+
+	// Очищаем переходы после сохранения
+	*clicks = nil
+}
+
+// truncateHeader обрезает значение заголовка до maxClickHeaderLength байт,
+// не разрезая символы UTF-8.
+func truncateHeader(value string) string {
+	if len(value) <= maxClickHeaderLength {
+		return value
+	}
+	return strings.ToValidUTF8(value[:maxClickHeaderLength], "")
+}
+
+// ipPrefix возвращает сеть клиента: /24 для IPv4 и /48 для IPv6.
+// Для нераспознанного адреса возвращает пустую строку.
+func ipPrefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return (&net.IPNet{IP: ip16.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+	}
+	return ""
+}
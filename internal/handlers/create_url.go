@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"encoding/json"
 
@@ -12,14 +13,19 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/zYoma/go-url-shortener/internal/logger"
 	"github.com/zYoma/go-url-shortener/internal/models"
-	"github.com/zYoma/go-url-shortener/internal/services/generator"
-	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
+	"github.com/zYoma/go-url-shortener/internal/services/alias"
+	"github.com/zYoma/go-url-shortener/internal/services/shorten"
+	"github.com/zYoma/go-url-shortener/internal/storage"
 	"go.uber.org/zap"
 )
 
+// aliasParam - параметр запроса CreateURL с псевдонимом ссылки.
+const aliasParam = "alias"
+
 // CreateURL обрабатывает HTTP-запросы для создания короткой версии одиночного URL.
 // В теле запроса ожидается строка, содержащая оригинальный URL. Метод читает тело запроса,
 // проверяет, что URL не пустой, и использует сервис для генерации короткой версии URL и его сохранения.
+// Вместо сгенерированного короткого URL можно передать псевдоним в параметре запроса alias.
 // В случае успеха, в ответе возвращается созданный короткий URL. В случае ошибок возвращает
 // соответствующие HTTP-статусы и описания ошибок.
 //
@@ -42,8 +48,19 @@ func (h *HandlerService) CreateURL(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// создаем короткую ссылку
-	shortURL := generator.GenerateShortURL()
+	// проверяем, что URL не длиннее допустимого
+	if err = models.ValidateURLLength(originalURL, h.cfg.MaxURLLength); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	customAlias := req.URL.Query().Get(aliasParam)
+	if customAlias != "" {
+		if err = h.aliases.Validate(customAlias); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	ctx := req.Context()
 	userID, err := getUserFromRequest(req.Context())
@@ -52,16 +69,20 @@ func (h *HandlerService) CreateURL(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// сохраняем ссылку в хранилище
-	err = h.provider.SaveURL(ctx, originalURL, shortURL, userID)
+	// создаем короткую ссылку и сохраняем её в хранилище
+	shortURL, err := shorten.Save(ctx, h.provider, h.generator, originalURL, customAlias, userID, models.Schedule{})
 	if err != nil {
-		if errors.Is(err, postgres.ErrConflict) {
-			resultShortURL, _ := h.provider.GetShortURL(ctx, originalURL)
+		if errors.Is(err, alias.ErrTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			resultShortURL := h.existingShortURL(ctx, err, originalURL)
 			w.WriteHeader(http.StatusConflict)
 			fmt.Fprintf(w, "%s/%s", h.cfg.BaseShortURL, resultShortURL)
 			return
 		}
-		render.JSON(w, req, models.Error("failed save link to db"))
+		renderStorageError(w, req, err, "failed save link to db")
 		return
 	}
 
@@ -76,6 +97,10 @@ func (h *HandlerService) CreateURL(w http.ResponseWriter, req *http.Request) {
 // В теле запроса ожидается JSON объект, содержащий оригинальный URL и дополнительные данные.
 // Метод декодирует тело запроса, валидирует полученные данные, и в случае корректности,
 // использует сервис для генерации короткой версии URL и его сохранения.
+// Если в запросе передан псевдоним, он проверяется и сохраняется вместо сгенерированного
+// короткого URL; занятый псевдоним возвращает 409 с ошибкой, а не существующую ссылку.
+// Необязательные active_from и expires_at задают срок действия ссылки: expires_at
+// должен быть в будущем и позже active_from.
 // В ответ клиенту отправляется JSON объект с результатом операции. В случае ошибок возвращает
 // соответствующие HTTP-статусы и описания ошибок в формате JSON.
 //
@@ -116,8 +141,28 @@ func (h *HandlerService) CreateShortURL(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// создаем короткую ссылку
-	shortURL := generator.GenerateShortURL()
+	if err = models.ValidateURLLength(req.URL, h.cfg.MaxURLLength); err != nil {
+		logger.Log.Error("request validate error", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, models.Error(err.Error()))
+		return
+	}
+
+	if err = req.Schedule().Validate(time.Now()); err != nil {
+		logger.Log.Error("request validate error", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, models.Error(err.Error()))
+		return
+	}
+
+	if req.Alias != "" {
+		if err = h.aliases.Validate(req.Alias); err != nil {
+			logger.Log.Error("request validate error", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, models.Error(err.Error()))
+			return
+		}
+	}
 
 	ctx := r.Context()
 	userID, err := getUserFromRequest(r.Context())
@@ -126,12 +171,16 @@ func (h *HandlerService) CreateShortURL(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// сохраняем ссылку в хранилище
-	err = h.provider.SaveURL(ctx, req.URL, shortURL, userID)
+	// создаем короткую ссылку и сохраняем её в хранилище
+	shortURL, err := shorten.Save(ctx, h.provider, h.generator, req.URL, req.Alias, userID, req.Schedule())
 	if err != nil {
-		if errors.Is(err, postgres.ErrConflict) {
-
-			resultShortURL, _ := h.provider.GetShortURL(ctx, req.URL)
+		if errors.Is(err, alias.ErrTaken) {
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, models.Error(err.Error()))
+			return
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			resultShortURL := h.existingShortURL(ctx, err, req.URL)
 			w.WriteHeader(http.StatusConflict)
 			response := models.CreateShortURLResponse{
 				Result: fmt.Sprintf("%s/%s", h.cfg.BaseShortURL, resultShortURL),
@@ -140,7 +189,7 @@ func (h *HandlerService) CreateShortURL(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		render.JSON(w, r, models.Error("failed save link to db"))
+		renderStorageError(w, r, err, "failed save link to db")
 		return
 	}
 
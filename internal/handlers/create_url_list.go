@@ -11,10 +11,15 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/zYoma/go-url-shortener/internal/logger"
 	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/batch"
 	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"go.uber.org/zap"
 )
 
+// batchModeItems - значение параметра mode, при котором пакетный запрос
+// возвращает результат для каждой ссылки.
+const batchModeItems = "items"
+
 // CreateShortListURL обрабатывает HTTP POST запросы для создания коротких URL из списка длинных URL.
 // В теле запроса ожидается JSON массив с объектами, содержащими исходные длинные URL и идентификаторы для корреляции.
 // Этот метод использует стороннюю библиотеку jsoniter для эффективной работы с JSON,
@@ -27,6 +32,10 @@ import (
 // В случае неудачи при чтении тела запроса, десериализации JSON, валидации URL или сохранении в хранилище,
 // клиенту отправляется соответствующий HTTP статус ошибки и описание ошибки в формате JSON.
 //
+// С параметром mode=items некорректные URL не отклоняют весь запрос: в ответ со статусом
+// 207 Multi-Status для каждого correlation_id возвращается свой результат - created,
+// existing с существующим коротким URL или invalid с причиной.
+//
 // Параметры:
 //
 //	w http.ResponseWriter: интерфейс для отправки HTTP ответов.
@@ -62,29 +71,31 @@ func (h *HandlerService) CreateShortListURL(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "":
+	case batchModeItems:
+		h.createShortListItems(w, r, req)
+		return
+	default:
+		logger.Log.Error("unknown batch mode", zap.String("mode", mode))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, models.Error("unknown mode"))
+		return
+	}
+
 	// Создаём экземпляр валидатора один раз
 	validate := validator.New()
 
 	for _, url := range req {
 		// Используем уже созданный экземпляр валидатора для проверки
-		if err = validate.Struct(url); err != nil {
-			validateErr := err.(validator.ValidationErrors)
-			logger.Log.Error("request validate error", zap.Error(err))
+		if reason := models.ValidateOriginalURL(validate, url, h.cfg.MaxURLLength); reason != "" {
+			logger.Log.Error("request validate error", zap.String("error", reason))
 			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, models.ValidationError(validateErr))
+			render.JSON(w, r, models.Error(reason))
 			return
 		}
 	}
 
-	var insertData []models.InsertData
-	var responseData []models.ShortURL
-
-	for _, url := range req {
-		shortURL := generator.GenerateShortURL()
-		insertData = append(insertData, models.InsertData{OriginalURL: url.OriginalURL, ShortURL: shortURL})
-		responseData = append(responseData, models.ShortURL{CorrelationID: url.CorrelationID, ShortURL: fmt.Sprintf("%s/%s", h.cfg.BaseShortURL, shortURL)})
-	}
-
 	ctx := r.Context()
 	userID, err := getUserFromRequest(r.Context())
 	if err != nil {
@@ -92,12 +103,23 @@ func (h *HandlerService) CreateShortListURL(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = h.provider.BulkSaveURL(ctx, insertData, userID)
+	links := make([]models.InsertData, 0, len(req))
+	for _, url := range req {
+		links = append(links, models.InsertData{OriginalURL: url.OriginalURL, Schedule: url.Schedule()})
+	}
+
+	// уже сохранённые URL возвращаются с существующим коротким URL
+	results, err := generator.SaveBatch(ctx, h.generator, h.provider, links, userID)
 	if err != nil {
-		render.JSON(w, r, models.Error("failed save link to db"))
+		renderStorageError(w, r, err, "failed save link to db")
 		return
 	}
 
+	responseData := make([]models.ShortURL, 0, len(req))
+	for i, url := range req {
+		responseData = append(responseData, models.ShortURL{CorrelationID: url.CorrelationID, ShortURL: fmt.Sprintf("%s/%s", h.cfg.BaseShortURL, results[i].ShortURL)})
+	}
+
 	w.WriteHeader(http.StatusCreated)
 
 	jsonData, err := jsoniter.Marshal(responseData)
@@ -114,3 +136,30 @@ func (h *HandlerService) CreateShortListURL(w http.ResponseWriter, r *http.Reque
 		return
 	}
 }
+
+// createShortListItems обрабатывает пакетный запрос в режиме mode=items и отвечает
+// статусом 207 Multi-Status со списком результатов для каждой ссылки.
+func (h *HandlerService) createShortListItems(w http.ResponseWriter, r *http.Request, req []models.OriginalURL) {
+	userID, err := getUserFromRequest(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := batch.Shorten(r.Context(), h.provider, h.generator, h.cfg, req, userID)
+	if err != nil {
+		renderStorageError(w, r, err, "failed save link to db")
+		return
+	}
+
+	jsonData, err := jsoniter.Marshal(items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err = w.Write(jsonData); err != nil {
+		logger.Log.Error("cannot write response", zap.Error(err))
+	}
+}
@@ -54,13 +54,22 @@ var missingURLBody string = `
 ]
 `
 
+// createdResults возвращает результат пакетного сохранения, в котором созданы все ссылки.
+func createdResults(_ context.Context, data []models.InsertData, _ string) []models.BulkSaveResult {
+	results := make([]models.BulkSaveResult, 0, len(data))
+	for _, d := range data {
+		results = append(results, models.BulkSaveResult{Status: models.BulkSaveCreated, ShortURL: d.ShortURL})
+	}
+	return results
+}
+
 func TestCreateListURL(t *testing.T) {
 	cfg := GetMockConfig()
 
 	providerMock := new(mocks.URLProvider)
-	providerMock.On("BulkSaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything).Return(nil)
+	providerMock.On("BulkSaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything).Return(createdResults, nil)
 
-	service := New(providerMock, cfg)
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
 	r := service.GetRouter()
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -95,13 +104,58 @@ func TestCreateListURL(t *testing.T) {
 	}
 }
 
+func TestCreateListURLItems(t *testing.T) {
+	cfg := GetMockConfig()
+
+	providerMock := new(mocks.URLProvider)
+	providerMock.On("BulkSaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything).Return(
+		func(_ context.Context, data []models.InsertData, _ string) []models.BulkSaveResult {
+			// первая ссылка уже сохранена, остальные создаются
+			results := createdResults(context.TODO(), data, "")
+			results[0] = models.BulkSaveResult{Status: models.BulkSaveExisting, ShortURL: "exists"}
+			return results
+		}, nil)
+
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
+	srv := httptest.NewServer(service.GetRouter())
+	defer srv.Close()
+
+	body := []models.OriginalURL{
+		{CorrelationID: "1", OriginalURL: "http://ya.ru"},
+		{CorrelationID: "2", OriginalURL: "ya.ru"},
+		{CorrelationID: "3", OriginalURL: "http://go.dev"},
+	}
+	var items []models.BatchItem
+	resp, err := resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		SetBody(body).
+		SetResult(&items).
+		Post(fmt.Sprintf("%s/api/shorten/batch?mode=items", srv.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode())
+
+	require.Len(t, items, 3)
+	assert.Equal(t, models.BatchItem{CorrelationID: "1", Status: models.BulkSaveExisting, ShortURL: "http://localhost:8080/exists"}, items[0])
+	assert.Equal(t, models.BatchItem{CorrelationID: "2", Status: models.BulkSaveInvalid, Error: "field OriginalURL is not a valid URL"}, items[1])
+	assert.Equal(t, "3", items[2].CorrelationID)
+	assert.Equal(t, models.BulkSaveCreated, items[2].Status)
+
+	// неизвестный режим отклоняется
+	resp, err = resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		SetBody(body).
+		Post(fmt.Sprintf("%s/api/shorten/batch?mode=all", srv.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
 func BenchmarkCreateShortListURL(b *testing.B) {
 	cfg := GetMockConfig()
 
 	providerMock := new(mocks.URLProvider)
-	providerMock.On("BulkSaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything).Return(nil)
+	providerMock.On("BulkSaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything).Return(createdResults, nil)
 
-	handlerService := New(providerMock, cfg)
+	handlerService := New(providerMock, cfg, GetMockGenerator(), nil)
 
 	testURLs := []models.OriginalURL{
 		{CorrelationID: "1", OriginalURL: "http://example1.com"},
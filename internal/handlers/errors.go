@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// storageErrorStatus сопоставляет ошибку хранилища с HTTP-статусом ответа.
+// Это единственное место, где ошибки провайдеров хранилища переводятся в коды HTTP.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrGone):
+		return http.StatusGone
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, storage.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrNotSupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// renderStorageError отправляет клиенту JSON с описанием ошибки и статусом,
+// соответствующим ошибке хранилища.
+func renderStorageError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	setRetryAfter(w, err)
+	w.WriteHeader(storageErrorStatus(err))
+	render.JSON(w, r, models.Error(msg))
+}
+
+// setRetryAfter проставляет заголовок Retry-After, если хранилище недоступно
+// и сообщило, через сколько стоит повторить запрос.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var unavailable *storage.UnavailableError
+	if errors.As(err, &unavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(unavailable.RetryAfter.Seconds())))
+	}
+}
+
+// existingShortURL возвращает короткий URL уже существующей ссылки для ошибки конфликта.
+// Если провайдер не передал его в storage.ConflictError, короткий URL запрашивается отдельно.
+func (h *HandlerService) existingShortURL(ctx context.Context, err error, fullURL string) string {
+	var conflict *storage.ConflictError
+	if errors.As(err, &conflict) {
+		return conflict.ShortURL
+	}
+	shortURL, _ := h.provider.GetShortURL(ctx, fullURL)
+	return shortURL
+}
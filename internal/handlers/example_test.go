@@ -10,6 +10,7 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/zYoma/go-url-shortener/internal/config"
 	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"github.com/zYoma/go-url-shortener/internal/storage/mem"
 )
 
@@ -20,8 +21,11 @@ func ExampleHandlerService_CreateShortListURL() {
 	// создаем провайдер для storage
 	provider, _ := mem.New(cfg)
 
+	// создаем генератор коротких URL
+	gen, _ := generator.New(cfg)
+
 	// Создание экземпляра HandlerService.
-	h := New(provider, cfg)
+	h := New(provider, cfg, gen, nil)
 
 	// Подготовка данных запроса.
 	originalURLs := []models.OriginalURL{
@@ -53,8 +57,11 @@ func ExampleHandlerService_DeleteShortListURL() {
 	// создаем провайдер для storage
 	provider, _ := mem.New(cfg)
 
+	// создаем генератор коротких URL
+	gen, _ := generator.New(cfg)
+
 	// Создание экземпляра HandlerService.
-	h := New(provider, cfg)
+	h := New(provider, cfg, gen, nil)
 	h.delChan = make(chan models.UserListURLForDelete, 1)
 
 	// Подготовка данных запроса: список коротких URL для удаления.
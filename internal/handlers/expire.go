@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultExpireInterval - период пометки удалёнными истёкших ссылок по умолчанию.
+	defaultExpireInterval = time.Minute
+	// defaultExpireBatchSize - количество ссылок, помечаемых удалёнными одним запросом, по умолчанию.
+	defaultExpireBatchSize = 1000
+)
+
+// ExpireLinks периодически помечает удалёнными ссылки с истёкшим сроком действия,
+// пока не будет закрыт stopChan. Истёкшие ссылки не открываются и до пометки,
+// пометка освобождает их в кешах и списках ссылок как обычное удаление.
+// Если хранилище не поддерживает пометку истёкших ссылок, метод сразу завершается.
+func (h *HandlerService) ExpireLinks(wg *sync.WaitGroup, stopChan chan int64) {
+	defer wg.Done()
+
+	expirer, ok := storage.As[storage.Expirer](h.provider)
+	if !ok {
+		return
+	}
+
+	interval := h.cfg.ExpireInterval
+	if interval <= 0 {
+		interval = defaultExpireInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.expireLinks(expirer, stopChan)
+		case <-stopChan:
+			// сигнал остановки приложения
+			return
+		}
+	}
+}
+
+// expireLinks помечает удалёнными истёкшие ссылки пачками, пока хранилище
+// возвращает полные пачки, чтобы накопившиеся ссылки не ждали следующего периода.
+func (h *HandlerService) expireLinks(expirer storage.Expirer, stopChan chan int64) {
+	batchSize := h.cfg.ExpireBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultExpireBatchSize
+	}
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		expired, err := expirer.ExpireURLs(ctx, batchSize)
+		cancel()
+		if err != nil {
+			logger.Log.Debug("cannot expire links", zap.Error(err))
+			return
+		}
+		if len(expired) > 0 {
+			logger.Log.Debug("expired links marked as deleted", zap.Int("count", len(expired)))
+		}
+		if len(expired) < batchSize {
+			return
+		}
+
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+	}
+}
@@ -1,21 +1,22 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
 )
 
 // GetURL обрабатывает HTTP-запросы для перенаправления пользователя по короткой ссылке.
 // Метод извлекает идентификатор короткой ссылки из URL-параметра запроса, выполняет поиск
 // оригинального URL в хранилище по данному идентификатору и, в случае успеха, перенаправляет пользователя
-// по найденному оригинальному URL.
+// по найденному оригинальному URL. Переход записывается в статистику асинхронно
+// и не задерживает перенаправление.
 //
-// В случае, если URL был удалён, клиенту возвращается HTTP-статус 410 (Gone),
-// указывающий на то, что ресурс был удалён и более недоступен.
-// Если соответствующий оригинальный URL не найден, возвращается статус 404 (Not Found).
+// В случае, если URL был удалён или срок его действия истёк, клиенту возвращается
+// HTTP-статус 410 (Gone), указывающий на то, что ресурс более недоступен.
+// Если соответствующий оригинальный URL не найден или срок действия ссылки
+// ещё не начался, возвращается статус 404 (Not Found),
+// а при остальных ошибках хранилища - статус, соответствующий ошибке.
 //
 // Параметры:
 //
@@ -30,13 +31,18 @@ func (h *HandlerService) GetURL(w http.ResponseWriter, req *http.Request) {
 	// проверяем в хранилище, есть ли урл для полученного id
 	originalURL, err := h.provider.GetURL(ctx, shortURL)
 	if err != nil {
-		if errors.Is(err, postgres.ErrURLDeleted) {
+		switch status := storageErrorStatus(err); status {
+		case http.StatusGone:
 			w.WriteHeader(http.StatusGone)
-			return
+		case http.StatusNotFound:
+			http.NotFound(w, req)
+		default:
+			setRetryAfter(w, err)
+			http.Error(w, http.StatusText(status), status)
 		}
-		http.NotFound(w, req)
 		return
 	}
 
+	h.recordClick(req, shortURL)
 	http.Redirect(w, req, originalURL, http.StatusTemporaryRedirect)
 }
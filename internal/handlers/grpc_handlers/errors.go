@@ -0,0 +1,59 @@
+package grpchandlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// storageErrorCode сопоставляет ошибку хранилища с кодом ответа gRPC.
+// Это единственное место, где ошибки провайдеров хранилища переводятся в коды gRPC.
+func storageErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrGone):
+		return codes.NotFound
+	case errors.Is(err, storage.ErrConflict):
+		return codes.AlreadyExists
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return codes.ResourceExhausted
+	case errors.Is(err, storage.ErrUnavailable):
+		return codes.Unavailable
+	case errors.Is(err, storage.ErrNotSupported):
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
+
+// retryAfterKey - ключ метаданных ответа со временем в секундах, через которое
+// стоит повторить запрос к недоступному хранилищу.
+const retryAfterKey = "retry-after"
+
+// storageError возвращает ошибку gRPC с кодом, соответствующим ошибке хранилища.
+// Если хранилище сообщило, через сколько повторить запрос, время передаётся
+// в метаданных ответа retry-after.
+func storageError(ctx context.Context, err error, msg string) error {
+	var unavailable *storage.UnavailableError
+	if errors.As(err, &unavailable) {
+		retryAfter := strconv.Itoa(int(unavailable.RetryAfter.Seconds()))
+		_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, retryAfter))
+	}
+	return status.Error(storageErrorCode(err), msg)
+}
+
+// existingShortURL возвращает короткий URL уже существующей ссылки для ошибки конфликта.
+// Если провайдер не передал его в storage.ConflictError, короткий URL запрашивается отдельно.
+func (h *HandlerService) existingShortURL(ctx context.Context, err error, fullURL string) string {
+	var conflict *storage.ConflictError
+	if errors.As(err, &conflict) {
+		return conflict.ShortURL
+	}
+	shortURL, _ := h.provider.GetShortURL(ctx, fullURL)
+	return shortURL
+}
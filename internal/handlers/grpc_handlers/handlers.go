@@ -4,22 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/zYoma/go-url-shortener/internal/config"
 	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/alias"
+	"github.com/zYoma/go-url-shortener/internal/services/batch"
 	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/services/linkstats"
+	"github.com/zYoma/go-url-shortener/internal/services/shorten"
 	"github.com/zYoma/go-url-shortener/internal/storage"
-	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
 	pb "github.com/zYoma/go-url-shortener/proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type HandlerService struct {
-	provider storage.URLProvider // Интерфейс взаимодействия с хранилищем URL.
-	cfg      *config.Config      // Конфигурация приложения.
+	provider  storage.URLProvider // Интерфейс взаимодействия с хранилищем URL.
+	cfg       *config.Config      // Конфигурация приложения.
+	generator generator.Generator // Стратегия генерации коротких URL.
+	aliases   *alias.Validator    // Проверка пользовательских псевдонимов.
 	pb.UnimplementedShortenerServer
 }
 
@@ -30,13 +37,16 @@ type HandlerService struct {
 // cfg: конфигурация приложения.
 //
 // Возвращает указатель на созданный экземпляр HandlerService.
-func New(provider storage.URLProvider, cfg *config.Config) *HandlerService {
-	return &HandlerService{provider: provider, cfg: cfg}
+func New(provider storage.URLProvider, cfg *config.Config, gen generator.Generator) *HandlerService {
+	return &HandlerService{provider: provider, cfg: cfg, generator: gen, aliases: alias.New(cfg)}
 }
 
 func (h *HandlerService) CreateShortURL(ctx context.Context, req *pb.CreateShortURLRequest) (*pb.CreateShortURLResponse, error) {
 	request := models.CreateShortURLRequest{
-		URL: req.GetUrl(),
+		URL:        req.GetUrl(),
+		Alias:      req.GetAlias(),
+		ActiveFrom: timeOrNil(req.GetActiveFrom()),
+		ExpiresAt:  timeOrNil(req.GetExpiresAt()),
 	}
 
 	if err := validator.New().Struct(request); err != nil {
@@ -44,7 +54,19 @@ func (h *HandlerService) CreateShortURL(ctx context.Context, req *pb.CreateShort
 		return nil, status.Errorf(codes.InvalidArgument, "request validation error: %v", validateErr)
 	}
 
-	shortURL := generator.GenerateShortURL()
+	if err := models.ValidateURLLength(request.URL, h.cfg.MaxURLLength); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := request.Schedule().Validate(time.Now()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if request.Alias != "" {
+		if err := h.aliases.Validate(request.Alias); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
 
 	// получаем userID из контекста
 	userID, ok := ctx.Value(UserIDKey).(string)
@@ -52,14 +74,18 @@ func (h *HandlerService) CreateShortURL(ctx context.Context, req *pb.CreateShort
 		return nil, errors.New("user ID not found in context")
 	}
 
-	if err := h.provider.SaveURL(ctx, request.URL, shortURL, userID); err != nil {
-		if errors.Is(err, postgres.ErrConflict) {
-			resultShortURL, _ := h.provider.GetShortURL(ctx, request.URL)
+	shortURL, err := shorten.Save(ctx, h.provider, h.generator, request.URL, request.Alias, userID, request.Schedule())
+	if err != nil {
+		if errors.Is(err, alias.ErrTaken) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			resultShortURL := h.existingShortURL(ctx, err, request.URL)
 			return &pb.CreateShortURLResponse{
 				Result: fmt.Sprintf("%s/%s", h.cfg.BaseShortURL, resultShortURL),
 			}, status.Error(codes.AlreadyExists, "link already exists")
 		}
-		return nil, status.Error(codes.Internal, "failed to save link to db")
+		return nil, storageError(ctx, err, "failed to save link to db")
 	}
 
 	return &pb.CreateShortURLResponse{
@@ -67,6 +93,64 @@ func (h *HandlerService) CreateShortURL(ctx context.Context, req *pb.CreateShort
 	}, nil
 }
 
+// timeOrNil возвращает время из необязательного поля запроса или nil, если поле не задано.
+func timeOrNil(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// batchStatuses сопоставляет результат обработки ссылки из пакета со статусом gRPC.
+var batchStatuses = map[models.BulkSaveStatus]pb.BatchStatus{
+	models.BulkSaveCreated:  pb.BatchStatus_BATCH_STATUS_CREATED,
+	models.BulkSaveExisting: pb.BatchStatus_BATCH_STATUS_EXISTING,
+	models.BulkSaveInvalid:  pb.BatchStatus_BATCH_STATUS_INVALID,
+}
+
+// CreateShortURLBatch создаёт короткие URL для пакета ссылок и возвращает результат
+// для каждого correlation_id: созданная ссылка, существующая ссылка или причина,
+// по которой ссылка не прошла проверку. Некорректные ссылки не отклоняют весь пакет.
+func (h *HandlerService) CreateShortURLBatch(ctx context.Context, req *pb.CreateShortURLBatchRequest) (*pb.CreateShortURLBatchResponse, error) {
+	if len(req.GetUrls()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty request")
+	}
+
+	// получаем userID из контекста
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok {
+		return nil, errors.New("user ID not found in context")
+	}
+
+	urls := make([]models.OriginalURL, 0, len(req.GetUrls()))
+	for _, u := range req.GetUrls() {
+		urls = append(urls, models.OriginalURL{
+			CorrelationID: u.GetCorrelationId(),
+			OriginalURL:   u.GetOriginalUrl(),
+			ActiveFrom:    timeOrNil(u.GetActiveFrom()),
+			ExpiresAt:     timeOrNil(u.GetExpiresAt()),
+		})
+	}
+
+	items, err := batch.Shorten(ctx, h.provider, h.generator, h.cfg, urls, userID)
+	if err != nil {
+		return nil, storageError(ctx, err, "failed to save links to db")
+	}
+
+	results := make([]*pb.BatchResult, 0, len(items))
+	for _, item := range items {
+		results = append(results, &pb.BatchResult{
+			CorrelationId: item.CorrelationID,
+			Status:        batchStatuses[item.Status],
+			ShortUrl:      item.ShortURL,
+			Error:         item.Error,
+		})
+	}
+
+	return &pb.CreateShortURLBatchResponse{Results: results}, nil
+}
+
 func (h *HandlerService) GetUserURLs(ctx context.Context, req *pb.GetUserURLsRequest) (*pb.GetUserURLsResponse, error) {
 	// Получаем userID из контекста
 	userID, ok := ctx.Value(UserIDKey).(string)
@@ -76,7 +160,7 @@ func (h *HandlerService) GetUserURLs(ctx context.Context, req *pb.GetUserURLsReq
 
 	userURLs, err := h.provider.GetUserURLs(ctx, h.cfg.BaseShortURL, userID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get links from db")
+		return nil, storageError(ctx, err, "failed to get links from db")
 	}
 
 	var pbUserURLs []*pb.URLs
@@ -95,10 +179,68 @@ func (h *HandlerService) GetUserURLs(ctx context.Context, req *pb.GetUserURLsReq
 	return response, nil
 }
 
+// GetLinkStats возвращает статистику переходов по короткой ссылке пользователя.
+// Статистику может получить только владелец ссылки, для чужой ссылки возвращается
+// код PermissionDenied. Незаданные параметры запроса заменяются значениями по умолчанию.
+func (h *HandlerService) GetLinkStats(ctx context.Context, req *pb.GetLinkStatsRequest) (*pb.GetLinkStatsResponse, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok {
+		return nil, errors.New("user ID not found in context")
+	}
+
+	query, err := linkstats.NewQuery(req.ShortUrl, timeOrNil(req.From), timeOrNil(req.To), req.Interval, int(req.Top), time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	stats, err := linkstats.Get(ctx, h.provider, userID, query)
+	if err != nil {
+		if errors.Is(err, linkstats.ErrForbidden) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, storageError(ctx, err, "failed to get link stats from db")
+	}
+
+	response := &pb.GetLinkStatsResponse{
+		ShortUrl:       stats.ShortURL,
+		From:           timestamppb.New(stats.From),
+		To:             timestamppb.New(stats.To),
+		Interval:       string(stats.Interval),
+		Clicks:         int64(stats.Clicks),
+		UniqueVisitors: int64(stats.Visitors),
+		TopReferrers:   clickSources(stats.Referrers),
+		TopUserAgents:  clickSources(stats.UserAgents),
+		TopCountries:   clickSources(stats.Countries),
+	}
+	for _, bucket := range stats.Timeline {
+		response.Timeline = append(response.Timeline, &pb.ClickBucket{
+			Time:   timestamppb.New(bucket.Time),
+			Clicks: int64(bucket.Clicks),
+		})
+	}
+	return response, nil
+}
+
+// clickSources преобразует самые частые значения заголовков переходов в сообщения gRPC.
+func clickSources(sources []models.ClickSource) []*pb.ClickSource {
+	result := make([]*pb.ClickSource, 0, len(sources))
+	for _, source := range sources {
+		result = append(result, &pb.ClickSource{Value: source.Value, Clicks: int64(source.Clicks)})
+	}
+	return result
+}
+
 func (h *HandlerService) Ping(ctx context.Context, req *emptypb.Empty) (*pb.PingResponse, error) {
 	err := h.provider.Ping(ctx)
+	var state storage.CircuitState
+	if breaker, ok := storage.As[storage.CircuitBreaker](h.provider); ok {
+		state = breaker.CircuitState()
+	}
 	if err != nil {
-		return nil, err
+		if state == storage.CircuitOpen {
+			return nil, storageError(ctx, err, "storage is not available: circuit open")
+		}
+		return nil, storageError(ctx, err, "storage is not available")
 	}
-	return &pb.PingResponse{Message: "OK"}, nil
+	return &pb.PingResponse{Message: "OK", CircuitState: string(state)}, nil
 }
@@ -3,12 +3,16 @@ package handlers
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/geoip"
 	"github.com/zYoma/go-url-shortener/internal/logger"
 	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/alias"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
 	"github.com/zYoma/go-url-shortener/internal/storage"
 	"go.uber.org/zap"
 )
@@ -18,9 +22,15 @@ import (
 // для взаимодействия с хранилищем данных, конфигурацию приложения и канал
 // для асинхронного удаления списка URL, принадлежащих пользователю.
 type HandlerService struct {
-	provider storage.URLProvider              // Интерфейс взаимодействия с хранилищем URL.
-	cfg      *config.Config                   // Конфигурация приложения.
-	delChan  chan models.UserListURLForDelete // Канал для удаления списка URL.
+	provider  storage.URLProvider              // Интерфейс взаимодействия с хранилищем URL.
+	cfg       *config.Config                   // Конфигурация приложения.
+	delChan   chan models.UserListURLForDelete // Канал для удаления списка URL.
+	generator generator.Generator              // Стратегия генерации коротких URL.
+	aliases   *alias.Validator                 // Проверка пользовательских псевдонимов.
+	clicks    chan queuedClick                 // Канал для записи переходов по ссылкам, nil если хранилище их не сохраняет.
+	geo       *geoip.DB                        // База GeoIP для определения местоположения клиентов, nil если не задана.
+
+	droppedClicks atomic.Uint64 // Количество переходов, отброшенных из-за заполненного канала.
 }
 
 // New инициализирует и возвращает новый экземпляр HandlerService.
@@ -28,10 +38,20 @@ type HandlerService struct {
 //
 // provider: провайдер для взаимодействия с хранилищем данных.
 // cfg: конфигурация приложения.
+// gen: стратегия генерации коротких URL.
+// geo: база GeoIP, по которой переходы дополняются страной и городом клиента, nil если не задана.
 //
 // Возвращает указатель на созданный экземпляр HandlerService.
-func New(provider storage.URLProvider, cfg *config.Config) *HandlerService {
-	return &HandlerService{provider: provider, cfg: cfg, delChan: make(chan models.UserListURLForDelete, 1024)}
+func New(provider storage.URLProvider, cfg *config.Config, gen generator.Generator, geo *geoip.DB) *HandlerService {
+	return &HandlerService{
+		provider:  provider,
+		cfg:       cfg,
+		delChan:   make(chan models.UserListURLForDelete, 1024),
+		generator: gen,
+		aliases:   alias.New(cfg),
+		clicks:    newClickBuffer(provider, cfg),
+		geo:       geo,
+	}
 }
 
 // GetRouter создает и возвращает роутер с настроенными маршрутами и middleware.
@@ -54,7 +74,9 @@ func (h *HandlerService) GetRouter() chi.Router {
 		r.Get("/{id}", h.GetURL)
 		r.Get("/ping", h.Ping)
 		r.Post("/api/shorten/batch", h.CreateShortListURL)
+		r.Post("/api/shorten/stream", h.CreateShortURLStream)
 		r.Get("/api/user/urls", h.GetUserURL)
+		r.Get("/api/user/urls/{id}/stats", h.GetUserURLStats)
 		r.Delete("/api/user/urls", h.DeleteShortListURL)
 		r.Get("/api/internal/stats", h.GetStats)
 	})
@@ -4,19 +4,31 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/zYoma/go-url-shortener/internal/config"
 	"github.com/zYoma/go-url-shortener/internal/mocks"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/storage"
 	"github.com/zYoma/go-url-shortener/internal/storage/mem"
 	"github.com/zYoma/go-url-shortener/internal/storage/postgres"
 )
@@ -26,17 +38,23 @@ func GetMockConfig() *config.Config {
 		RunAddr:      ":8080",
 		BaseShortURL: "http://localhost:8080",
 		StorageFile:  "/tmp/short-url-db.json",
+		MaxURLLength: 100,
 	}
 }
 
+func GetMockGenerator() generator.Generator {
+	gen, _ := generator.New(GetMockConfig())
+	return gen
+}
+
 func TestCreateURL(t *testing.T) {
 	cfg := GetMockConfig()
 
 	providerMock := new(mocks.URLProvider)
 	// Настройка поведения мока для метода SaveURL
-	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	service := New(providerMock, cfg)
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
 	r := service.GetRouter()
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -66,7 +84,7 @@ func TestCreateURL(t *testing.T) {
 			assert.Contains(t, string(resp.Body()), tc.expectedBody)
 
 			// Проверка вызовов методов
-			providerMock.AssertCalled(t, "SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything)
+			providerMock.AssertCalled(t, "SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 		})
 	}
 }
@@ -85,12 +103,12 @@ func TestGetURL(t *testing.T) {
 			return url
 		}, func(ctx context.Context, shortURL string) error {
 			if shortURL != mockID {
-				return mem.ErrURLNotFound
+				return storage.ErrNotFound
 			}
 			return nil
 		})
 
-	service := New(providerMock, cfg)
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
 	r := service.GetRouter()
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -128,20 +146,135 @@ func TestGetURL(t *testing.T) {
 	}
 }
 
+func TestGetURLUnavailable(t *testing.T) {
+	providerMock := new(mocks.URLProvider)
+	providerMock.On("GetURL", mock.Anything, mock.Anything).Return("", &storage.UnavailableError{RetryAfter: 3 * time.Second})
+
+	service := New(providerMock, GetMockConfig(), GetMockGenerator(), nil)
+	rr := httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/sdReka", nil))
+
+	// пока хранилище недоступно, клиенту сообщается, когда повторить запрос
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("Retry-After"))
+}
+
+// clickProvider сохраняет переходы в память, остальные методы берёт из мока.
+type clickProvider struct {
+	*mocks.URLProvider
+	mutex  sync.Mutex
+	clicks []models.Click
+}
+
+func (p *clickProvider) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.clicks = append(p.clicks, clicks...)
+	return nil
+}
+
+func TestGetURLRecordsClick(t *testing.T) {
+	providerMock := new(mocks.URLProvider)
+	providerMock.On("GetURL", mock.Anything, "sdReka").Return("https://practicum.yandex.ru/", nil)
+	provider := &clickProvider{URLProvider: providerMock}
+
+	cfg := GetMockConfig()
+	cfg.ClickFlushInterval = time.Hour
+	service := New(provider, cfg, GetMockGenerator(), nil)
+
+	var wg sync.WaitGroup
+	stopChan := make(chan int64)
+	wg.Add(1)
+	go service.RecordClicks(&wg, stopChan)
+
+	req := httptest.NewRequest(http.MethodGet, "/sdReka", nil)
+	req.RemoteAddr = "192.168.10.25:41234"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", strings.Repeat("я", maxClickHeaderLength))
+	rr := httptest.NewRecorder()
+	service.GetRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+
+	// накопленные переходы записываются при остановке
+	close(stopChan)
+	wg.Wait()
+
+	require.Len(t, provider.clicks, 1)
+	click := provider.clicks[0]
+	assert.Equal(t, "sdReka", click.ShortURL)
+	assert.Equal(t, "https://example.com/", click.Referrer)
+	assert.Equal(t, "192.168.10.0/24", click.IPPrefix)
+	assert.Len(t, click.UserAgent, maxClickHeaderLength)
+	assert.True(t, utf8.ValidString(click.UserAgent))
+	assert.WithinDuration(t, time.Now(), click.Time, time.Minute)
+}
+
+func TestGetUserURLStats(t *testing.T) {
+	ctx := context.Background()
+	provider, err := mem.New(&config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json")})
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	defer provider.Close()
+
+	require.NoError(t, provider.SaveURL(ctx, "http://ya.ru", "short", "owner", models.Schedule{}))
+	require.NoError(t, provider.(storage.ClickStore).SaveClicks(ctx, []models.Click{
+		{ShortURL: "short", Time: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), UserAgent: "curl"},
+	}))
+
+	service := New(provider, GetMockConfig(), GetMockGenerator(), nil)
+	router := chi.NewRouter()
+	router.Get("/api/user/urls/{id}/stats", service.GetUserURLStats)
+
+	tests := []struct {
+		name       string
+		userID     string
+		target     string
+		wantStatus int
+	}{
+		{name: "владелец ссылки", userID: "owner", target: "/api/user/urls/short/stats?interval=hour", wantStatus: http.StatusOK},
+		{name: "чужая ссылка", userID: "stranger", target: "/api/user/urls/short/stats", wantStatus: http.StatusForbidden},
+		{name: "несуществующая ссылка", userID: "owner", target: "/api/user/urls/missing/stats", wantStatus: http.StatusNotFound},
+		{name: "неверный период", userID: "owner", target: "/api/user/urls/short/stats?from=yesterday", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(context.WithValue(req.Context(), UserIDKey, tt.userID))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/short/stats?interval=hour&from=2024-05-01T00:00:00Z&to=2024-05-02T00:00:00Z", nil)
+	req = req.WithContext(context.WithValue(req.Context(), UserIDKey, "owner"))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var stats models.LinkStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Clicks)
+	require.Len(t, stats.Timeline, 24)
+	assert.Equal(t, models.ClickBucket{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Clicks: 1}, stats.Timeline[10])
+	assert.Equal(t, []models.ClickSource{{Value: "curl", Clicks: 1}}, stats.UserAgents)
+}
+
 func TestCreateShortURL(t *testing.T) {
 	cfg := GetMockConfig()
 	providerMock := new(mocks.URLProvider)
-	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything).Return(
-		func(ctx context.Context, fullURL string, shortURL string, userID string) error {
+	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, fullURL string, shortURL string, userID string, schedule models.Schedule) error {
 			if fullURL == "http://mail.ru" {
-				return postgres.ErrConflict
+				return &storage.ConflictError{ShortURL: "conflict"}
+			}
+			if shortURL == "taken" {
+				return storage.ErrShortURLCollision
 			}
 			return nil
 		},
 	)
 	providerMock.On("GetShortURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything).Return("conflict", nil)
 
-	service := New(providerMock, cfg)
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
 	r := service.GetRouter()
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -159,6 +292,13 @@ func TestCreateShortURL(t *testing.T) {
 		{name: "невалидный url", method: http.MethodPost, body: `{"url": "ya.ru"}`, expectedCode: http.StatusBadRequest, expectedBody: "is not a valid URL"},
 		{name: "не передан url", method: http.MethodPost, body: `{}`, expectedCode: http.StatusBadRequest, expectedBody: "URL is a required field"},
 		{name: "url уже существует в БД", method: http.MethodPost, body: `{"url": "http://mail.ru"}`, expectedCode: http.StatusConflict, expectedBody: "conflict"},
+		{name: "слишком длинный url", method: http.MethodPost, body: fmt.Sprintf(`{"url": "http://ya.ru/?q=%s"}`, strings.Repeat("a", 100)), expectedCode: http.StatusBadRequest, expectedBody: "URL exceeds maximum length of 100 characters"},
+		{name: "псевдоним", method: http.MethodPost, body: `{"url": "http://yandex.ru", "alias": "spring-sale"}`, expectedCode: http.StatusCreated, expectedBody: "http://localhost:8080/spring-sale"},
+		{name: "зарезервированный псевдоним", method: http.MethodPost, body: `{"url": "http://yandex.ru", "alias": "api"}`, expectedCode: http.StatusBadRequest, expectedBody: "alias is reserved"},
+		{name: "псевдоним занят", method: http.MethodPost, body: `{"url": "http://yandex.ru", "alias": "taken"}`, expectedCode: http.StatusConflict, expectedBody: "alias already taken"},
+		{name: "срок действия", method: http.MethodPost, body: `{"url": "http://yandex.ru", "active_from": "2020-01-01T00:00:00Z", "expires_at": "2999-01-01T00:00:00Z"}`, expectedCode: http.StatusCreated, expectedBody: "http://localhost:8080/"},
+		{name: "срок действия истёк", method: http.MethodPost, body: `{"url": "http://yandex.ru", "expires_at": "2020-01-01T00:00:00Z"}`, expectedCode: http.StatusBadRequest, expectedBody: "expires_at must be in the future"},
+		{name: "срок действия до начала", method: http.MethodPost, body: `{"url": "http://yandex.ru", "active_from": "2999-02-01T00:00:00Z", "expires_at": "2999-01-01T00:00:00Z"}`, expectedCode: http.StatusBadRequest, expectedBody: "expires_at must be after active_from"},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -185,8 +325,8 @@ func TestCreateShortURL(t *testing.T) {
 func TestGzipCompression(t *testing.T) {
 	cfg := GetMockConfig()
 	providerMock := new(mocks.URLProvider)
-	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	service := New(providerMock, cfg)
+	providerMock.On("SaveURL", mock.AnythingOfType("*context.valueCtx"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
 	r := service.GetRouter()
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -254,3 +394,58 @@ func TestGzipCompression(t *testing.T) {
 		require.JSONEq(t, successBody, string(b))
 	})
 }
+
+// latencyProvider имитирует хранилище, каждое сохранение ссылки в котором ждёт
+// ответа базы данных latency. Сохранения не синхронизируются между собой, как
+// запросы к postgres через пул соединений.
+type latencyProvider struct {
+	storage.URLProvider
+	latency time.Duration
+}
+
+func (p *latencyProvider) SaveURL(ctx context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error {
+	time.Sleep(p.latency)
+	return nil
+}
+
+// BenchmarkCreateShortURLParallel измеряет пропускную способность создания ссылок
+// в зависимости от количества параллельных запросов (req/s). По умолчанию ссылки
+// сохраняются в хранилище с задержкой ответа 1 мс, поэтому пропускная способность
+// растёт с параллельностью, если обработчики не сериализуют создание ссылок.
+// Если задана переменная окружения BENCHMARK_DATABASE_DSN, ссылки сохраняются
+// в postgres. Для этого нужна отдельная база, так как созданные ссылки из неё не удаляются.
+func BenchmarkCreateShortURLParallel(b *testing.B) {
+	cfg := GetMockConfig()
+	var provider storage.URLProvider = &latencyProvider{latency: time.Millisecond}
+	if dsn := os.Getenv("BENCHMARK_DATABASE_DSN"); dsn != "" {
+		cfg.DSN = dsn
+		pg, err := postgres.New(cfg)
+		require.NoError(b, err)
+		defer pg.Close()
+		require.NoError(b, pg.Init())
+		provider = pg
+	}
+
+	router := New(provider, cfg, GetMockGenerator(), nil).GetRouter()
+	// полные URL уникальны между запусками, чтобы не получать конфликты с прошлыми ссылками
+	prefix := time.Now().UnixNano()
+	var counter atomic.Int64
+
+	for _, parallelism := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("parallelism-%d", parallelism), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					body := fmt.Sprintf(`{"url":"http://example.com/%d/%d"}`, prefix, counter.Add(1))
+					rr := httptest.NewRecorder()
+					router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+					if rr.Code != http.StatusCreated {
+						b.Errorf("unexpected status %d", rr.Code)
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
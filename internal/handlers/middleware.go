@@ -110,6 +110,12 @@ func (r *responseRecorder) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Unwrap возвращает исходный http.ResponseWriter, чтобы http.ResponseController
+// мог отправлять потоковые ответы по частям
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (h *HandlerService) cookieSettingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("auth-token")
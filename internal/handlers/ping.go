@@ -2,17 +2,26 @@ package handlers
 
 import (
 	"net/http"
+
+	"github.com/zYoma/go-url-shortener/internal/storage"
 )
 
+// circuitStateHeader - заголовок ответа Ping с состоянием выключателя хранилища.
+const circuitStateHeader = "X-Circuit-State"
+
 // Ping проверяет доступность и работоспособность хранилища данных,
 // используя провайдер хранилища. Метод предназначен для использования в качестве
 // простого эндпоинта проверки состояния сервиса (health check).
 //
 // В случае успешной проверки возвращает HTTP-статус 200 (OK) и тело "OK",
 // указывая на то, что сервис и его зависимости функционируют нормально.
-// Если проверка не удалась, клиенту возвращается HTTP-статус 500 (Internal Server Error),
+// Если проверка не удалась, клиенту возвращается HTTP-статус, соответствующий ошибке хранилища
+// (503 Service Unavailable при недоступности хранилища или 500 Internal Server Error),
 // сигнализируя о возникших проблемах с доступностью или работоспособностью хранилища данных.
 //
+// Если хранилище обёрнуто выключателем, его состояние передаётся в заголовке
+// X-Circuit-State, а пока выключатель разомкнут, ответ содержит заголовок Retry-After.
+//
 // Параметры:
 //
 //	w http.ResponseWriter: интерфейс для отправки HTTP ответов.
@@ -20,8 +29,13 @@ import (
 func (h *HandlerService) Ping(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	err := h.provider.Ping(ctx)
+	if breaker, ok := storage.As[storage.CircuitBreaker](h.provider); ok {
+		w.Header().Set(circuitStateHeader, string(breaker.CircuitState()))
+	}
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		setRetryAfter(w, err)
+		status := storageErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
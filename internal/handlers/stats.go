@@ -5,7 +5,6 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
-	"github.com/zYoma/go-url-shortener/internal/models"
 )
 
 // GetStats обрабатывает запрос /api/internal/stats.
@@ -22,16 +21,10 @@ func (h *HandlerService) GetStats(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Получение IP-адреса клиента из заголовка X-Real-IP
-	clientIP := req.Header.Get("X-Real-IP")
-	if clientIP == "" {
-		// Если заголовок X-Real-IP отсутствует, получаем IP-адрес из RemoteAddr
-		var err error
-		clientIP, _, err = net.SplitHostPort(req.RemoteAddr)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
+	clientAddr, err := clientIP(req)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 
 	// Проверка, принадлежит ли IP-адрес клиента доверенной подсети
@@ -41,7 +34,6 @@ func (h *HandlerService) GetStats(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	clientAddr := net.ParseIP(clientIP)
 	if !trustedIPNet.Contains(clientAddr) {
 		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
@@ -49,9 +41,25 @@ func (h *HandlerService) GetStats(w http.ResponseWriter, req *http.Request) {
 
 	response, err := h.provider.GetServiceStats(ctx)
 	if err != nil {
-		render.JSON(w, req, models.Error("failed get stats from db"))
+		renderStorageError(w, req, err, "failed get stats from db")
 		return
 	}
 
 	render.JSON(w, req, response)
 }
+
+// clientIP возвращает IP-адрес клиента из заголовка X-Real-IP, а если его нет -
+// из RemoteAddr запроса. Для некорректного значения X-Real-IP возвращает nil.
+func clientIP(req *http.Request) (net.IP, error) {
+	// Получение IP-адреса клиента из заголовка X-Real-IP
+	if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+		return net.ParseIP(realIP), nil
+	}
+
+	// Если заголовок X-Real-IP отсутствует, получаем IP-адрес из RemoteAddr
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return net.ParseIP(host), nil
+}
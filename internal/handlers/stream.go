@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/batch"
+	"go.uber.org/zap"
+)
+
+const (
+	// streamChunkSize - количество строк потокового запроса, которые проверяются
+	// и сохраняются одним пакетом.
+	streamChunkSize = 500
+	// maxStreamLineSize - максимальная длина строки NDJSON в байтах.
+	maxStreamLineSize = 1 << 20
+)
+
+// форматы тела потокового запроса
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+)
+
+// errStreamLine описывает строку, которую не удалось разобрать.
+var errStreamLine = errors.New("failed to decode line")
+
+// streamLine - строка потокового запроса.
+type streamLine struct {
+	number int                // Номер строки, начиная с 1.
+	url    models.OriginalURL // Ссылка из строки.
+	err    error              // Ошибка разбора строки.
+}
+
+// streamReader последовательно читает строки потокового запроса.
+type streamReader interface {
+	// next возвращает следующую непустую строку или io.EOF после последней.
+	next() (streamLine, error)
+}
+
+// CreateShortURLStream обрабатывает HTTP POST запросы для создания коротких URL из потока
+// ссылок. Тело запроса читается построчно в формате NDJSON (по объекту
+// {"correlation_id", "original_url"} в строке) или CSV (Content-Type: text/csv,
+// столбцы correlation_id и original_url, строка заголовка необязательна).
+//
+// Строки проверяются и сохраняются пакетами по streamChunkSize, а результаты отправляются
+// клиенту в формате NDJSON сразу после сохранения каждого пакета, поэтому потребляемая
+// память не зависит от размера запроса. Каждый результат содержит номер строки line.
+// Если обработка прервалась, запрос можно повторить с параметром from_line, равным номеру
+// последней полученной строки: строки до неё включительно будут пропущены.
+//
+// Некорректные строки возвращаются со статусом invalid и не прерывают обработку. Ошибка
+// хранилища прерывает обработку, последней строкой ответа передаётся описание ошибки.
+//
+// Параметры:
+//
+//	w http.ResponseWriter: интерфейс для отправки HTTP ответов.
+//	r *http.Request: структура, представляющая HTTP запрос.
+func (h *HandlerService) CreateShortURLStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := getUserFromRequest(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fromLine := 0
+	if value := r.URL.Query().Get("from_line"); value != "" {
+		fromLine, err = strconv.Atoi(value)
+		if err != nil || fromLine < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, models.Error("invalid from_line"))
+			return
+		}
+	}
+
+	var reader streamReader
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case contentTypeCSV:
+		reader = newCSVStreamReader(r.Body)
+	case contentTypeNDJSON, "application/json", "":
+		reader = newNDJSONStreamReader(r.Body)
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		render.JSON(w, r, models.Error("unsupported content type"))
+		return
+	}
+	defer r.Body.Close()
+
+	rc := http.NewResponseController(w)
+	// по HTTP/1.1 сервер перестаёт читать тело запроса после начала ответа,
+	// поэтому для потоковой обработки включаем одновременное чтение и запись
+	if err = rc.EnableFullDuplex(); err != nil {
+		logger.Log.Debug("cannot enable full duplex", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := jsoniter.NewEncoder(w)
+	chunk := make([]streamLine, 0, streamChunkSize)
+	saveChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		items, err := h.shortenStreamChunk(r, chunk, userID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err = encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		chunk = chunk[:0]
+		return rc.Flush()
+	}
+
+	for {
+		line, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			abortStream(encoder, err, "cannot read body")
+			return
+		}
+		if line.number <= fromLine {
+			continue
+		}
+
+		chunk = append(chunk, line)
+		if len(chunk) == streamChunkSize {
+			if err = saveChunk(); err != nil {
+				abortStream(encoder, err, "failed save link to db")
+				return
+			}
+		}
+	}
+	if err = saveChunk(); err != nil {
+		abortStream(encoder, err, "failed save link to db")
+	}
+}
+
+// shortenStreamChunk сохраняет ссылки пакета строк и возвращает результаты в порядке строк.
+func (h *HandlerService) shortenStreamChunk(r *http.Request, chunk []streamLine, userID string) ([]models.StreamItem, error) {
+	items := make([]models.StreamItem, len(chunk))
+	urls := make([]models.OriginalURL, 0, len(chunk))
+	for i, line := range chunk {
+		items[i].Line = line.number
+		if line.err != nil {
+			items[i].Status = models.BulkSaveInvalid
+			items[i].Error = line.err.Error()
+			continue
+		}
+		urls = append(urls, line.url)
+	}
+	if len(urls) == 0 {
+		return items, nil
+	}
+
+	results, err := batch.Shorten(r.Context(), h.provider, h.generator, h.cfg, urls, userID)
+	if err != nil {
+		return nil, err
+	}
+	j := 0
+	for i := range items {
+		if chunk[i].err == nil {
+			items[i].BatchItem = results[j]
+			j++
+		}
+	}
+	return items, nil
+}
+
+// abortStream завершает потоковый ответ строкой с описанием ошибки msg.
+func abortStream(encoder *jsoniter.Encoder, err error, msg string) {
+	logger.Log.Error("cannot process stream", zap.Error(err))
+	if encodeErr := encoder.Encode(models.Error(msg)); encodeErr != nil {
+		logger.Log.Debug("cannot write stream error", zap.Error(encodeErr))
+	}
+}
+
+// ndjsonStreamReader читает поток в формате NDJSON.
+type ndjsonStreamReader struct {
+	scanner *bufio.Scanner
+	number  int
+}
+
+func newNDJSONStreamReader(body io.Reader) *ndjsonStreamReader {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	return &ndjsonStreamReader{scanner: scanner}
+}
+
+func (s *ndjsonStreamReader) next() (streamLine, error) {
+	for s.scanner.Scan() {
+		s.number++
+		data := bytes.TrimSpace(s.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		line := streamLine{number: s.number}
+		if err := jsoniter.Unmarshal(data, &line.url); err != nil {
+			line.err = errStreamLine
+		}
+		return line, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return streamLine{}, err
+	}
+	return streamLine{}, io.EOF
+}
+
+// csvStreamReader читает поток в формате CSV.
+type csvStreamReader struct {
+	reader *csv.Reader
+	first  bool // Следующая запись - первая в потоке и может быть заголовком.
+}
+
+func newCSVStreamReader(body io.Reader) *csvStreamReader {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvStreamReader{reader: reader, first: true}
+}
+
+func (s *csvStreamReader) next() (streamLine, error) {
+	for {
+		record, err := s.reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// после ошибки разбора чтение продолжается со следующей записи
+			s.first = false
+			return streamLine{number: parseErr.StartLine, err: errStreamLine}, nil
+		}
+		if err != nil {
+			return streamLine{}, err
+		}
+
+		number, _ := s.reader.FieldPos(0)
+		isFirst := s.first
+		s.first = false
+		if isFirst && len(record) == 2 && record[0] == "correlation_id" && record[1] == "original_url" {
+			continue
+		}
+
+		line := streamLine{number: number}
+		if len(record) != 2 {
+			line.err = errStreamLine
+			return line, nil
+		}
+		line.url = models.OriginalURL{CorrelationID: record[0], OriginalURL: record[1]}
+		return line, nil
+	}
+}
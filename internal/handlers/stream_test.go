@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/mocks"
+	"github.com/zYoma/go-url-shortener/internal/models"
+)
+
+func TestCreateShortURLStream(t *testing.T) {
+	cfg := GetMockConfig()
+
+	providerMock := new(mocks.URLProvider)
+	providerMock.On("BulkSaveURL", mock.Anything, mock.Anything, mock.Anything).Return(createdResults, nil)
+
+	service := New(providerMock, cfg, GetMockGenerator(), nil)
+	srv := httptest.NewServer(service.GetRouter())
+	defer srv.Close()
+
+	ndjson := `{"correlation_id":"1","original_url":"http://ya.ru"}
+
+{"correlation_id":"2","original_url":"ya.ru"}
+not json
+{"correlation_id":"3","original_url":"http://go.dev"}
+`
+	csvBody := "correlation_id,original_url\n1,http://ya.ru\n2\n3,http://go.dev\n"
+
+	testCases := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		expected    []models.StreamItem
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        ndjson,
+			expected: []models.StreamItem{
+				{Line: 1, BatchItem: models.BatchItem{CorrelationID: "1", Status: models.BulkSaveCreated}},
+				{Line: 3, BatchItem: models.BatchItem{CorrelationID: "2", Status: models.BulkSaveInvalid, Error: "field OriginalURL is not a valid URL"}},
+				{Line: 4, BatchItem: models.BatchItem{Status: models.BulkSaveInvalid, Error: "failed to decode line"}},
+				{Line: 5, BatchItem: models.BatchItem{CorrelationID: "3", Status: models.BulkSaveCreated}},
+			},
+		},
+		{
+			name:        "продолжение с последней полученной строки",
+			contentType: "application/x-ndjson",
+			query:       "?from_line=4",
+			body:        ndjson,
+			expected: []models.StreamItem{
+				{Line: 5, BatchItem: models.BatchItem{CorrelationID: "3", Status: models.BulkSaveCreated}},
+			},
+		},
+		{
+			name:        "csv",
+			contentType: "text/csv",
+			body:        csvBody,
+			expected: []models.StreamItem{
+				{Line: 2, BatchItem: models.BatchItem{CorrelationID: "1", Status: models.BulkSaveCreated}},
+				{Line: 3, BatchItem: models.BatchItem{Status: models.BulkSaveInvalid, Error: "failed to decode line"}},
+				{Line: 4, BatchItem: models.BatchItem{CorrelationID: "3", Status: models.BulkSaveCreated}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// клиент по умолчанию запрашивает сжатый ответ, что проверяет отправку частей через gzip
+			resp, err := http.Post(fmt.Sprintf("%s/api/shorten/stream%s", srv.URL, tc.query), tc.contentType, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+			var items []models.StreamItem
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var item models.StreamItem
+				require.NoError(t, jsoniter.Unmarshal(scanner.Bytes(), &item))
+				if item.Status == models.BulkSaveCreated {
+					assert.True(t, strings.HasPrefix(item.ShortURL, cfg.BaseShortURL+"/"))
+					item.ShortURL = ""
+				}
+				items = append(items, item)
+			}
+			require.NoError(t, scanner.Err())
+			assert.Equal(t, tc.expected, items)
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/linkstats"
 )
 
 // GetUserURL обрабатывает HTTP-запросы для получения списка коротких URL, созданных пользователем.
@@ -33,7 +40,7 @@ func (h *HandlerService) GetUserURL(w http.ResponseWriter, req *http.Request) {
 
 	response, err := h.provider.GetUserURLs(ctx, h.cfg.BaseShortURL, userID)
 	if err != nil {
-		render.JSON(w, req, models.Error("failed get link from db"))
+		renderStorageError(w, req, err, "failed get link from db")
 		return
 	}
 
@@ -44,3 +51,85 @@ func (h *HandlerService) GetUserURL(w http.ResponseWriter, req *http.Request) {
 
 	render.JSON(w, req, response)
 }
+
+// GetUserURLStats обрабатывает HTTP-запросы для получения статистики переходов
+// по короткой ссылке пользователя: общего количества переходов, количества
+// уникальных посетителей, переходов по часам или суткам и самых частых источников
+// переходов, браузеров и стран клиентов.
+//
+// Параметры запроса необязательны: from и to задают период в формате RFC 3339,
+// interval - шаг hour или day, top - количество самых частых значений.
+// По умолчанию возвращается статистика по суткам за последние 30 дней.
+//
+// Статистику может получить только владелец ссылки: для неаутентифицированного
+// пользователя возвращается HTTP-статус 401 (Unauthorized), для чужой ссылки -
+// 403 (Forbidden), для несуществующей - 404 (Not Found), а при недопустимых
+// параметрах запроса - 400 (Bad Request).
+//
+// Параметры:
+//
+//	w http.ResponseWriter: интерфейс для отправки HTTP ответов.
+//	req *http.Request: структура, представляющая HTTP запрос.
+func (h *HandlerService) GetUserURLStats(w http.ResponseWriter, req *http.Request) {
+	userID, err := getUserFromRequest(req.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query, err := statsQueryFromRequest(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, req, models.Error(err.Error()))
+		return
+	}
+
+	stats, err := linkstats.Get(req.Context(), h.provider, userID, query)
+	if err != nil {
+		if errors.Is(err, linkstats.ErrForbidden) {
+			w.WriteHeader(http.StatusForbidden)
+			render.JSON(w, req, models.Error(err.Error()))
+			return
+		}
+		renderStorageError(w, req, err, "failed get link stats from db")
+		return
+	}
+
+	render.JSON(w, req, stats)
+}
+
+// statsQueryFromRequest разбирает параметры запроса статистики ссылки.
+func statsQueryFromRequest(req *http.Request) (models.LinkStatsQuery, error) {
+	params := req.URL.Query()
+
+	from, err := timeParam(params, "from")
+	if err != nil {
+		return models.LinkStatsQuery{}, err
+	}
+	to, err := timeParam(params, "to")
+	if err != nil {
+		return models.LinkStatsQuery{}, err
+	}
+
+	var top int
+	if value := params.Get("top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil {
+			return models.LinkStatsQuery{}, fmt.Errorf("%w: top must be a number", linkstats.ErrInvalidQuery)
+		}
+	}
+
+	return linkstats.NewQuery(chi.URLParam(req, "id"), from, to, params.Get("interval"), top, time.Now())
+}
+
+// timeParam разбирает необязательный параметр запроса name в формате RFC 3339.
+func timeParam(params url.Values, name string) (*time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be in RFC 3339 format", linkstats.ErrInvalidQuery, name)
+	}
+	return &t, nil
+}
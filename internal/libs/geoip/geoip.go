@@ -0,0 +1,153 @@
+// Package geoip определяет страну и город клиента по IP-адресу с помощью локальной
+// базы MaxMind (.mmdb), не обращаясь к внешним сервисам.
+package geoip
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// defaultReloadInterval - период проверки изменения файла базы по умолчанию.
+const defaultReloadInterval = time.Minute
+
+// возможные ошибки пакета
+var (
+	// ErrOpenDB описывает ошибку чтения файла базы GeoIP.
+	ErrOpenDB = errors.New("unable to open GeoIP database")
+)
+
+// Location описывает местоположение клиента. Пустое поле означает, что
+// местоположение не удалось определить.
+type Location struct {
+	Country string // Код страны ISO 3166-1 alpha-2, например RU.
+	City    string // Название города на английском языке.
+}
+
+// record описывает поля записи базы GeoLite2/GeoIP2 City или Country, которые
+// нужны сервису. В базе Country поле city отсутствует.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// file описывает загруженную версию файла базы.
+type file struct {
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// DB определяет местоположение по базе из файла и подхватывает новую версию
+// файла без перезапуска приложения. Файл читается в память целиком, поэтому
+// замена файла не влияет на выполняющиеся поиски.
+//
+// Методы nil *DB безопасны: Lookup возвращает пустое местоположение, а Run
+// сразу завершается. Так обработчикам не нужно проверять, задана ли база.
+type DB struct {
+	path     string
+	interval time.Duration
+	current  atomic.Pointer[file]
+}
+
+// Open загружает базу из файла path. Период проверки изменения файла берётся
+// из interval, а если он не задан - используется defaultReloadInterval.
+func Open(path string, interval time.Duration) (*DB, error) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	db := &DB{path: path, interval: interval}
+	f, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	db.current.Store(f)
+	return db, nil
+}
+
+// load читает файл базы path.
+func load(path string) (*file, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Join(ErrOpenDB, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(ErrOpenDB, err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, errors.Join(ErrOpenDB, err)
+	}
+	return &file{reader: reader, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// Lookup возвращает местоположение IP-адреса ip. Если адреса нет в базе
+// или база не задана, возвращается пустое местоположение.
+func (db *DB) Lookup(ip net.IP) Location {
+	if db == nil || ip == nil {
+		return Location{}
+	}
+	var r record
+	if err := db.current.Load().reader.Lookup(ip, &r); err != nil {
+		logger.Log.Sugar().Debugf("Не удалось определить местоположение: %s", err)
+		return Location{}
+	}
+	return Location{Country: r.Country.ISOCode, City: r.City.Names["en"]}
+}
+
+// Reload загружает файл базы заново, если он изменился с последней загрузки.
+// Если новый файл не удалось прочитать, продолжает работать прежняя версия базы.
+func (db *DB) Reload() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return errors.Join(ErrOpenDB, err)
+	}
+	current := db.current.Load()
+	if info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+		return nil
+	}
+
+	f, err := load(db.path)
+	if err != nil {
+		return err
+	}
+	db.current.Store(f)
+	logger.Log.Sugar().Infof("База GeoIP загружена заново: %s", db.path)
+	return nil
+}
+
+// Run периодически проверяет, изменился ли файл базы, и загружает его новую версию.
+//
+// wg *sync.WaitGroup: группа ожидания для синхронизации завершения горутины.
+// stopChan chan int64: канал для получения сигнала о необходимости завершения работы.
+func (db *DB) Run(wg *sync.WaitGroup, stopChan chan int64) {
+	defer wg.Done()
+	if db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(db.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.Reload(); err != nil {
+				logger.Log.Sugar().Errorf("Не удалось загрузить базу GeoIP заново: %s", err)
+			}
+		case <-stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbString кодирует короткую строку в формате данных MaxMind DB.
+func mmdbString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+// mmdbUint16 кодирует число в формате данных MaxMind DB.
+func mmdbUint16(v uint16) []byte {
+	return []byte{0xa2, byte(v >> 8), byte(v)}
+}
+
+// writeDB записывает базу IPv4 из одного узла: адресам 0.0.0.0/1 соответствует
+// страна country и город city, остальных адресов в базе нет.
+func writeDB(t *testing.T, path, country, city string) {
+	const nodeCount = 1
+
+	var data []byte
+	data = append(data, 0xe2) // запись из двух полей
+	data = append(data, mmdbString("country")...)
+	data = append(data, 0xe1)
+	data = append(data, mmdbString("iso_code")...)
+	data = append(data, mmdbString(country)...)
+	data = append(data, mmdbString("city")...)
+	data = append(data, 0xe1)
+	data = append(data, mmdbString("names")...)
+	data = append(data, 0xe1)
+	data = append(data, mmdbString("en")...)
+	data = append(data, mmdbString(city)...)
+
+	var buf []byte
+	// узел дерева из двух 24-битных ссылок: левая указывает на запись в начале
+	// раздела данных, правая означает отсутствие записи
+	left := nodeCount + 16
+	buf = append(buf, 0, 0, byte(left), 0, 0, nodeCount)
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, "\xab\xcd\xefMaxMind.com"...)
+	buf = append(buf, 0xe5)
+	buf = append(buf, mmdbString("node_count")...)
+	buf = append(buf, 0xc1, nodeCount)
+	buf = append(buf, mmdbString("record_size")...)
+	buf = append(buf, mmdbUint16(24)...)
+	buf = append(buf, mmdbString("ip_version")...)
+	buf = append(buf, mmdbUint16(4)...)
+	buf = append(buf, mmdbString("database_type")...)
+	buf = append(buf, mmdbString("Test-City")...)
+	buf = append(buf, mmdbString("binary_format_major_version")...)
+	buf = append(buf, mmdbUint16(2)...)
+
+	require.NoError(t, os.WriteFile(path, buf, 0644))
+}
+
+func TestDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDB(t, path, "RU", "Moscow")
+
+	db, err := Open(path, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, Location{Country: "RU", City: "Moscow"}, db.Lookup(net.ParseIP("10.1.2.3")))
+	assert.Equal(t, Location{}, db.Lookup(net.ParseIP("192.168.1.1")))
+
+	// неизменившийся файл заново не загружается, изменившийся - загружается
+	require.NoError(t, db.Reload())
+	writeDB(t, path, "DE", "Berlin")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	require.NoError(t, db.Reload())
+	assert.Equal(t, Location{Country: "DE", City: "Berlin"}, db.Lookup(net.ParseIP("10.1.2.3")))
+
+	// повреждённый файл не заменяет загруженную базу
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0644))
+	assert.ErrorIs(t, db.Reload(), ErrOpenDB)
+	assert.Equal(t, Location{Country: "DE", City: "Berlin"}, db.Lookup(net.ParseIP("10.1.2.3")))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"), 0)
+	assert.ErrorIs(t, err, ErrOpenDB)
+
+	// без базы местоположение не определяется
+	var empty *DB
+	assert.Equal(t, Location{}, empty.Lookup(net.ParseIP("10.1.2.3")))
+}
@@ -57,6 +57,20 @@ func (c *compressWriter) Close() error {
 	return c.zw.Close()
 }
 
+// FlushError отправляет клиенту уже сжатые данные. Используется http.ResponseController
+// при потоковой передаче ответа.
+func (c *compressWriter) FlushError() error {
+	if err := c.zw.Flush(); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
 // compressReader реализует интерфейс io.ReadCloser для чтения сжатых gzip данных.
 // Позволяет декомпрессировать данные, принимаемые от клиента, прозрачно для сервера.
 type compressReader struct {
@@ -0,0 +1,75 @@
+// Package hll реализует HyperLogLog - оценку количества уникальных значений
+// в фиксированном объёме памяти. Оценки нескольких множеств объединяются без
+// пересчёта значений, например оценки пользователей разных шардов.
+package hll
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision - количество бит хеша, выбирающих регистр.
+	Precision = 14
+	// Registers - количество регистров оценки. Стандартная ошибка оценки - около 0.8%.
+	Registers = 1 << Precision
+	// rankBits - количество бит 32-битного хеша, по которым считается ранг значения.
+	rankBits = 32 - Precision
+)
+
+// Sketch - регистры оценки: для каждого регистра наибольший ранг добавленных хешей.
+type Sketch []uint8
+
+// New создаёт пустую оценку.
+func New() Sketch {
+	return make(Sketch, Registers)
+}
+
+// Add добавляет значение по его 32-битному хешу. Младшие Precision бит хеша выбирают
+// регистр, ранг - позиция старшего единичного бита среди остальных бит, начиная с 1.
+func (s Sketch) Add(hash uint32) {
+	s.Set(int(hash&(Registers-1)), Rank(hash>>Precision))
+}
+
+// Rank возвращает ранг старших rankBits бит хеша w.
+func Rank(w uint32) uint8 {
+	return uint8(rankBits - bits.Len32(w) + 1)
+}
+
+// Set поднимает ранг регистра register до rank.
+func (s Sketch) Set(register int, rank uint8) {
+	if register >= 0 && register < len(s) && rank > s[register] {
+		s[register] = rank
+	}
+}
+
+// Merge объединяет оценку с other: результат оценивает объединение множеств.
+func (s Sketch) Merge(other Sketch) {
+	for i, rank := range other {
+		s.Set(i, rank)
+	}
+}
+
+// Estimate возвращает оценку количества уникальных значений.
+func (s Sketch) Estimate() int {
+	m := float64(len(s))
+	sum, zeros := 0.0, 0
+	for _, rank := range s {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	switch {
+	case estimate <= 2.5*m && zeros > 0:
+		// для малых множеств точнее подсчёт пустых регистров
+		estimate = m * math.Log(m/float64(zeros))
+	case estimate > math.Exp2(32)/30:
+		// поправка на коллизии 32-битного хеша
+		estimate = -math.Exp2(32) * math.Log(1-estimate/math.Exp2(32))
+	}
+	return int(math.Round(estimate))
+}
@@ -0,0 +1,47 @@
+package hll
+
+import (
+	"hash/fnv"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hash возвращает хеш FNV-1a, перемешанный финализатором MurmurHash3,
+// чтобы младшие биты хешей соседних строк не были похожи.
+func hash(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+func TestSketch(t *testing.T) {
+	assert.Zero(t, New().Estimate())
+
+	// два множества пересекаются наполовину
+	first, second := New(), New()
+	for i := 0; i < 100000; i++ {
+		first.Add(hash(strconv.Itoa(i)))
+		second.Add(hash(strconv.Itoa(i + 50000)))
+	}
+	assert.InDelta(t, 100000, first.Estimate(), 3000)
+
+	// повторные значения не увеличивают оценку объединения
+	first.Merge(second)
+	assert.InDelta(t, 150000, first.Estimate(), 4500)
+
+	// малые множества считаются почти точно
+	small := New()
+	for i := 0; i < 10; i++ {
+		small.Add(hash(strconv.Itoa(i)))
+		small.Add(hash(strconv.Itoa(i)))
+	}
+	assert.Equal(t, 10, small.Estimate())
+}
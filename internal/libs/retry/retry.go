@@ -0,0 +1,54 @@
+// Package retry реализует повтор операций с экспоненциальной паузой между попытками.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy описывает политику повторов.
+type Policy struct {
+	// Attempts - максимальное количество попыток, включая первую. Ноль означает,
+	// что попытки повторяются, пока не будет отменён контекст.
+	Attempts int
+	// InitialDelay - пауза перед второй попыткой. Каждая следующая пауза вдвое больше.
+	InitialDelay time.Duration
+	// MaxDelay ограничивает паузу между попытками.
+	MaxDelay time.Duration
+}
+
+// Do вызывает fn, пока она возвращает ошибку, для которой retryable возвращает true,
+// но не более policy.Attempts раз. Паузы между попытками растут экспоненциально
+// и случайно уменьшаются до половины, чтобы экземпляры приложения не повторяли
+// запросы одновременно. Возвращает результат последней попытки, в том числе
+// если контекст был отменён во время паузы.
+func Do(ctx context.Context, policy Policy, retryable func(error) bool, fn func() error) error {
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		if policy.Attempts > 0 && attempt >= policy.Attempts {
+			return err
+		}
+
+		pause := delay
+		if pause > 0 {
+			pause = pause/2 + time.Duration(rand.Int63n(int64(pause/2)+1))
+		}
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
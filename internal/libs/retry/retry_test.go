@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTransient = errors.New("transient")
+
+func isTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	policy := Policy{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	// временная ошибка повторяется
+	calls := 0
+	err := Do(ctx, policy, isTransient, func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// количество попыток ограничено
+	calls = 0
+	err = Do(ctx, policy, isTransient, func() error {
+		calls++
+		return errTransient
+	})
+	assert.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 3, calls)
+
+	// остальные ошибки не повторяются
+	calls = 0
+	errFatal := errors.New("fatal")
+	err = Do(ctx, policy, isTransient, func() error {
+		calls++
+		return errFatal
+	})
+	assert.ErrorIs(t, err, errFatal)
+	assert.Equal(t, 1, calls)
+
+	// без ограничения попыток повторы прекращаются при отмене контекста
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	calls = 0
+	err = Do(ctx, Policy{InitialDelay: time.Millisecond}, isTransient, func() error {
+		calls++
+		return errTransient
+	})
+	assert.ErrorIs(t, err, errTransient)
+	assert.Greater(t, calls, 1)
+}
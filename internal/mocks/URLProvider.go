@@ -15,21 +15,33 @@ type URLProvider struct {
 }
 
 // BulkSaveURL provides a mock function with given fields: ctx, data, userID
-func (_m *URLProvider) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) error {
+func (_m *URLProvider) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
 	ret := _m.Called(ctx, data, userID)
 
 	if len(ret) == 0 {
 		panic("no return value specified for BulkSaveURL")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []models.InsertData, string) error); ok {
+	var r0 []models.BulkSaveResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.InsertData, string) ([]models.BulkSaveResult, error)); ok {
+		return rf(ctx, data, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []models.InsertData, string) []models.BulkSaveResult); ok {
 		r0 = rf(ctx, data, userID)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.BulkSaveResult)
+		}
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context, []models.InsertData, string) error); ok {
+		r1 = rf(ctx, data, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // DeleteListURL provides a mock function with given fields: ctx, messages
@@ -200,17 +212,17 @@ func (_m *URLProvider) Ping(ctx context.Context) error {
 	return r0
 }
 
-// SaveURL provides a mock function with given fields: ctx, fullURL, shortURL, userID
-func (_m *URLProvider) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string) error {
-	ret := _m.Called(ctx, fullURL, shortURL, userID)
+// SaveURL provides a mock function with given fields: ctx, fullURL, shortURL, userID, schedule
+func (_m *URLProvider) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string, schedule models.Schedule) error {
+	ret := _m.Called(ctx, fullURL, shortURL, userID, schedule)
 
 	if len(ret) == 0 {
 		panic("no return value specified for SaveURL")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
-		r0 = rf(ctx, fullURL, shortURL, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, models.Schedule) error); ok {
+		r0 = rf(ctx, fullURL, shortURL, userID, schedule)
 	} else {
 		r0 = ret.Error(0)
 	}
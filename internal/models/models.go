@@ -1,8 +1,10 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -51,10 +53,92 @@ func ValidationError(errs validator.ValidationErrors) ErrorResponse {
 	}
 }
 
+// ValidateOriginalURL проверяет ссылку из пакетного запроса: обязательные поля,
+// формат URL и его длину. Возвращает описание ошибки для клиента или пустую строку,
+// если ссылка корректна.
+func ValidateOriginalURL(validate *validator.Validate, url OriginalURL, maxLength int) string {
+	if err := validate.Struct(url); err != nil {
+		var validateErr validator.ValidationErrors
+		if errors.As(err, &validateErr) {
+			return ValidationError(validateErr).Error
+		}
+		return err.Error()
+	}
+	if err := ValidateURLLength(url.OriginalURL, maxLength); err != nil {
+		return err.Error()
+	}
+	if err := url.Schedule().Validate(time.Now()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// ErrURLTooLong описывает ошибку превышения максимально допустимой длины URL.
+var ErrURLTooLong = errors.New("URL exceeds maximum length")
+
+// ValidateURLLength проверяет, что длина URL не превышает maxLength символов.
+// Значение maxLength меньше или равное нулю означает отсутствие ограничения.
+func ValidateURLLength(url string, maxLength int) error {
+	if maxLength > 0 && len(url) > maxLength {
+		return fmt.Errorf("%w of %d characters", ErrURLTooLong, maxLength)
+	}
+	return nil
+}
+
+// возможные ошибки проверки срока действия ссылки
+var (
+	// ErrExpiresInPast описывает ошибку создания ссылки с уже истёкшим сроком действия.
+	ErrExpiresInPast = errors.New("expires_at must be in the future")
+	// ErrScheduleOrder описывает ошибку создания ссылки, которая истекает раньше, чем открывается.
+	ErrScheduleOrder = errors.New("expires_at must be after active_from")
+)
+
+// Schedule описывает срок действия ссылки. Нулевое время означает, что
+// соответствующего ограничения нет.
+type Schedule struct {
+	ActiveFrom time.Time // Момент, с которого ссылка открывается.
+	ExpiresAt  time.Time // Момент, начиная с которого ссылка больше не открывается.
+}
+
+// NewSchedule создаёт срок действия ссылки из необязательных полей запроса.
+func NewSchedule(activeFrom, expiresAt *time.Time) Schedule {
+	var schedule Schedule
+	if activeFrom != nil {
+		schedule.ActiveFrom = activeFrom.UTC()
+	}
+	if expiresAt != nil {
+		schedule.ExpiresAt = expiresAt.UTC()
+	}
+	return schedule
+}
+
+// Validate проверяет срок действия новой ссылки: ссылка должна истекать
+// в будущем и после того, как откроется.
+func (s Schedule) Validate(now time.Time) error {
+	if s.ExpiresAt.IsZero() {
+		return nil
+	}
+	if !s.ExpiresAt.After(now) {
+		return ErrExpiresInPast
+	}
+	if !s.ActiveFrom.IsZero() && !s.ExpiresAt.After(s.ActiveFrom) {
+		return ErrScheduleOrder
+	}
+	return nil
+}
+
 // CreateShortURLRequest описывает структуру входящего запроса на создание короткой ссылки.
-// Содержит URL, который требуется сократить.
+// Содержит URL, который требуется сократить, необязательный псевдоним и срок действия.
 type CreateShortURLRequest struct {
-	URL string `json:"url" validate:"required,url"` // URL для сокращения, должен быть валидным и указан.
+	URL        string     `json:"url" validate:"required,url"` // URL для сокращения, должен быть валидным и указан.
+	Alias      string     `json:"alias,omitempty"`             // Псевдоним, который станет коротким URL вместо сгенерированного.
+	ActiveFrom *time.Time `json:"active_from,omitempty"`       // Момент, с которого ссылка открывается.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`        // Момент, начиная с которого ссылка больше не открывается.
+}
+
+// Schedule возвращает срок действия ссылки из запроса.
+func (r CreateShortURLRequest) Schedule() Schedule {
+	return NewSchedule(r.ActiveFrom, r.ExpiresAt)
 }
 
 // CreateShortURLResponse описывает структуру ответа на запрос создания короткой ссылки.
@@ -71,14 +155,141 @@ type ShortURL struct {
 
 // OriginalURL описывает структуру с исходным URL и связанным идентификатором корреляции.
 type OriginalURL struct {
-	CorrelationID string `json:"correlation_id" validate:"required"`   // Идентификатор для корреляции.
-	OriginalURL   string `json:"original_url" validate:"required,url"` // Исходный URL, который был сокращен.
+	CorrelationID string     `json:"correlation_id" validate:"required"`   // Идентификатор для корреляции.
+	OriginalURL   string     `json:"original_url" validate:"required,url"` // Исходный URL, который был сокращен.
+	ActiveFrom    *time.Time `json:"active_from,omitempty"`                // Момент, с которого ссылка открывается.
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`                 // Момент, начиная с которого ссылка больше не открывается.
 }
 
-// InsertData содержит данные для вставки в хранилище: оригинальный и короткий URL.
+// Schedule возвращает срок действия ссылки из запроса.
+func (u OriginalURL) Schedule() Schedule {
+	return NewSchedule(u.ActiveFrom, u.ExpiresAt)
+}
+
+// InsertData содержит данные для вставки в хранилище: оригинальный и короткий URL
+// и срок действия ссылки.
 type InsertData struct {
 	OriginalURL string // Исходный URL.
 	ShortURL    string // Сокращенный URL.
+	Schedule
+}
+
+// Link описывает сохранённую ссылку целиком, например для переноса между шардами.
+type Link struct {
+	ShortURL    string    // Короткий URL.
+	OriginalURL string    // Исходный URL.
+	UserID      string    // Идентификатор владельца ссылки.
+	IsDeleted   bool      // Признак удаления ссылки.
+	Created     time.Time // Время создания ссылки.
+	Schedule
+}
+
+// Click описывает переход по короткой ссылке. Вместо IP-адреса клиента хранится
+// только его сеть, чтобы не сохранять персональные данные.
+type Click struct {
+	ShortURL  string    `json:"short_url"`            // Короткий URL, по которому выполнен переход.
+	Time      time.Time `json:"time"`                 // Время перехода.
+	Referrer  string    `json:"referrer,omitempty"`   // Заголовок Referer запроса.
+	UserAgent string    `json:"user_agent,omitempty"` // Заголовок User-Agent запроса.
+	IPPrefix  string    `json:"ip_prefix,omitempty"`  // Сеть клиента: /24 для IPv4 и /48 для IPv6.
+	Country   string    `json:"country,omitempty"`    // Код страны клиента, если задана база GeoIP.
+	City      string    `json:"city,omitempty"`       // Город клиента, если задана база GeoIP.
+}
+
+// StatsInterval описывает шаг, с которым переходы по ссылке группируются по времени.
+type StatsInterval string
+
+const (
+	// StatsHour - переходы считаются по часам.
+	StatsHour StatsInterval = "hour"
+	// StatsDay - переходы считаются по суткам (UTC).
+	StatsDay StatsInterval = "day"
+)
+
+// Duration возвращает длительность шага или 0 для неизвестного шага.
+func (i StatsInterval) Duration() time.Duration {
+	switch i {
+	case StatsHour:
+		return time.Hour
+	case StatsDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// LinkStatsQuery описывает запрос статистики переходов по ссылке
+// за полуинтервал [From, To).
+type LinkStatsQuery struct {
+	ShortURL string        // Короткий URL ссылки.
+	From     time.Time     // Начало периода, выровненное по шагу Interval.
+	To       time.Time     // Конец периода, не включается.
+	Interval StatsInterval // Шаг, с которым переходы группируются по времени.
+	Top      int           // Сколько самых частых значений каждого вида вернуть.
+}
+
+// ClickBucket описывает количество переходов за один шаг периода.
+type ClickBucket struct {
+	Time   time.Time `json:"time"`   // Начало шага.
+	Clicks int       `json:"clicks"` // Количество переходов.
+}
+
+// ClickSource описывает количество переходов с одним значением заголовка,
+// например с одного источника перехода.
+type ClickSource struct {
+	Value  string `json:"value"`  // Значение заголовка, пустое, если заголовок не передан.
+	Clicks int    `json:"clicks"` // Количество переходов.
+}
+
+// LinkStats описывает статистику переходов по ссылке за период.
+// Уникальный посетитель - это пара сети клиента и User-Agent.
+type LinkStats struct {
+	ShortURL   string        `json:"short_url"`       // Короткий URL ссылки.
+	From       time.Time     `json:"from"`            // Начало периода.
+	To         time.Time     `json:"to"`              // Конец периода, не включается.
+	Interval   StatsInterval `json:"interval"`        // Шаг, с которым переходы группируются по времени.
+	Clicks     int           `json:"clicks"`          // Количество переходов за период.
+	Visitors   int           `json:"unique_visitors"` // Количество уникальных посетителей за период.
+	Timeline   []ClickBucket `json:"timeline"`        // Переходы по шагам периода в порядке времени.
+	Referrers  []ClickSource `json:"top_referrers"`   // Самые частые источники переходов.
+	UserAgents []ClickSource `json:"top_user_agents"` // Самые частые браузеры.
+	Countries  []ClickSource `json:"top_countries"`   // Самые частые страны клиентов.
+}
+
+// BulkSaveStatus описывает результат сохранения одной ссылки из пакета.
+type BulkSaveStatus string
+
+// Возможные результаты сохранения ссылки из пакета.
+const (
+	// BulkSaveCreated - ссылка сохранена с переданным коротким URL.
+	BulkSaveCreated BulkSaveStatus = "created"
+	// BulkSaveExisting - полный URL уже сохранён, ShortURL содержит существующий короткий URL.
+	BulkSaveExisting BulkSaveStatus = "existing"
+	// BulkSaveCollision - короткий URL занят другой ссылкой, нужно сгенерировать новый.
+	BulkSaveCollision BulkSaveStatus = "collision"
+	// BulkSaveInvalid - ссылка не прошла проверку и не сохранялась.
+	BulkSaveInvalid BulkSaveStatus = "invalid"
+)
+
+// BulkSaveResult описывает результат сохранения одной ссылки из пакета.
+type BulkSaveResult struct {
+	Status   BulkSaveStatus // Результат сохранения.
+	ShortURL string         // Короткий URL ссылки: новый или существующий, пустой при коллизии.
+}
+
+// BatchItem описывает результат обработки одной ссылки пакетного запроса
+// в режиме поэлементных ответов.
+type BatchItem struct {
+	CorrelationID string         `json:"correlation_id"`      // Идентификатор для корреляции.
+	Status        BulkSaveStatus `json:"status"`              // Результат: created, existing или invalid.
+	ShortURL      string         `json:"short_url,omitempty"` // Сокращенный URL новой или существующей ссылки.
+	Error         string         `json:"error,omitempty"`     // Причина, по которой ссылка не прошла проверку.
+}
+
+// StreamItem описывает результат обработки одной строки потокового запроса.
+type StreamItem struct {
+	Line int `json:"line"` // Номер строки в теле запроса, начиная с 1.
+	BatchItem
 }
 
 // UserURLS описывает структуру данных, возвращаемую пользователю, содержащую короткий и исходный URL.
@@ -95,6 +306,16 @@ type UserListURLForDelete struct {
 
 // ServiceStat описывает структуру данных для запроса статистики сервера.
 type ServiceStat struct {
-	Users int `json:"users"` // количество пользователей в сервисе.
-	URLS  int `json:"urls"`  // количество сокращённых URL в сервисе.
+	Users int        `json:"users"`           // количество пользователей в сервисе.
+	URLS  int        `json:"urls"`            // количество сокращённых URL в сервисе.
+	Cache *CacheStat `json:"cache,omitempty"` // статистика кеша переходов, если он включен.
+}
+
+// CacheStat описывает статистику кеша переходов по коротким ссылкам.
+type CacheStat struct {
+	Hits      uint64 `json:"hits"`      // количество запросов, обслуженных из кеша.
+	Misses    uint64 `json:"misses"`    // количество запросов, переданных в хранилище.
+	Stale     uint64 `json:"stale"`     // количество переходов по устаревшим записям, пока хранилище недоступно.
+	Evictions uint64 `json:"evictions"` // количество записей, вытесненных из-за переполнения.
+	Size      int    `json:"size"`      // текущее количество записей в кеше.
 }
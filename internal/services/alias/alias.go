@@ -0,0 +1,105 @@
+// Package alias проверяет и сохраняет пользовательские псевдонимы коротких ссылок,
+// например /spring-sale вместо сгенерированного короткого URL.
+package alias
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// DefaultCharset - символы, из которых по умолчанию может состоять псевдоним.
+	DefaultCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+	// DefaultMinLength - минимальная длина псевдонима по умолчанию.
+	DefaultMinLength = 3
+	// DefaultMaxLength - максимальная длина псевдонима по умолчанию.
+	DefaultMaxLength = 64
+)
+
+// builtinReserved - первые сегменты маршрутов сервиса, которые не могут быть псевдонимами.
+var builtinReserved = []string{"api", "ping"}
+
+// возможные ошибки пакета
+var (
+	// ErrLength описывает ошибку недопустимой длины псевдонима.
+	ErrLength = errors.New("alias length must be")
+	// ErrCharset описывает ошибку псевдонима с недопустимыми символами.
+	ErrCharset = errors.New("alias contains forbidden character")
+	// ErrReserved описывает ошибку псевдонима, совпадающего с зарезервированным словом.
+	ErrReserved = errors.New("alias is reserved")
+	// ErrTaken описывает ошибку сохранения ссылки с псевдонимом, который уже занят
+	// другой ссылкой. В отличие от storage.ErrConflict, полный URL при этом не сохранён.
+	ErrTaken = errors.New("alias already taken")
+)
+
+// Validator проверяет псевдонимы по допустимым символам, длине и списку
+// зарезервированных слов из конфигурации.
+type Validator struct {
+	charset   string
+	minLength int
+	maxLength int
+	reserved  map[string]struct{} // Зарезервированные слова в нижнем регистре.
+}
+
+// New создаёт Validator по настройкам псевдонимов из конфигурации. Незаданные
+// настройки заменяются значениями по умолчанию, к зарезервированным словам из
+// конфигурации добавляются маршруты сервиса.
+func New(cfg *config.Config) *Validator {
+	v := &Validator{
+		charset:   cfg.AliasCharset,
+		minLength: cfg.AliasMinLength,
+		maxLength: cfg.AliasMaxLength,
+		reserved:  make(map[string]struct{}),
+	}
+	if v.charset == "" {
+		v.charset = DefaultCharset
+	}
+	if v.minLength <= 0 {
+		v.minLength = DefaultMinLength
+	}
+	if v.maxLength <= 0 {
+		v.maxLength = DefaultMaxLength
+	}
+	for _, words := range [][]string{builtinReserved, cfg.ReservedAliases} {
+		for _, word := range words {
+			v.reserved[strings.ToLower(word)] = struct{}{}
+		}
+	}
+	return v
+}
+
+// Validate проверяет, что псевдоним можно использовать как короткий URL.
+// Зарезервированные слова сравниваются без учёта регистра.
+func (v *Validator) Validate(alias string) error {
+	if length := utf8.RuneCountInString(alias); length < v.minLength || length > v.maxLength {
+		return fmt.Errorf("%w from %d to %d characters", ErrLength, v.minLength, v.maxLength)
+	}
+	for _, r := range alias {
+		if !strings.ContainsRune(v.charset, r) {
+			return fmt.Errorf("%w %q", ErrCharset, r)
+		}
+	}
+	if _, ok := v.reserved[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("%w: %s", ErrReserved, alias)
+	}
+	return nil
+}
+
+// Save сохраняет ссылку с псевдонимом alias в качестве короткого URL. Уникальность
+// короткого URL обеспечивает хранилище, поэтому занятый псевдоним определяется
+// атомарно при сохранении и возвращается как ErrTaken. Если полный URL уже сохранён,
+// возвращается ошибка хранилища storage.ErrConflict.
+func Save(ctx context.Context, provider storage.URLProvider, fullURL, alias, userID string, schedule models.Schedule) error {
+	err := provider.SaveURL(ctx, fullURL, alias, userID, schedule)
+	if errors.Is(err, storage.ErrShortURLCollision) {
+		return ErrTaken
+	}
+	return err
+}
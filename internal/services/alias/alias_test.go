@@ -0,0 +1,35 @@
+package alias
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zYoma/go-url-shortener/internal/config"
+)
+
+func TestValidate(t *testing.T) {
+	v := New(&config.Config{AliasMaxLength: 12, ReservedAliases: []string{"admin"}})
+
+	testCases := []struct {
+		name  string
+		alias string
+		err   error
+	}{
+		{name: "допустимый псевдоним", alias: "spring-sale"},
+		{name: "слишком короткий", alias: "ab", err: ErrLength},
+		{name: "слишком длинный", alias: "spring-sale-2024", err: ErrLength},
+		{name: "недопустимый символ", alias: "spring/sale", err: ErrCharset},
+		{name: "маршрут сервиса", alias: "ping", err: ErrReserved},
+		{name: "зарезервированное слово в другом регистре", alias: "Admin", err: ErrReserved},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate(tc.alias)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Package batch реализует пакетное создание коротких URL с поэлементными результатами.
+package batch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// Shorten проверяет каждую ссылку пакета, включая её срок действия, и сохраняет
+// корректные. Некорректные ссылки не прерывают обработку пакета и возвращаются
+// со статусом invalid и причиной, остальные - со статусом created или existing
+// и полным коротким URL.
+// Ошибка возвращается, только если не удалось сохранить пакет в хранилище.
+func Shorten(
+	ctx context.Context,
+	provider storage.URLProvider,
+	gen generator.Generator,
+	cfg *config.Config,
+	urls []models.OriginalURL,
+	userID string,
+) ([]models.BatchItem, error) {
+	items := make([]models.BatchItem, len(urls))
+	valid := make([]int, 0, len(urls))
+	validate := validator.New()
+	for i, url := range urls {
+		items[i].CorrelationID = url.CorrelationID
+		if reason := models.ValidateOriginalURL(validate, url, cfg.MaxURLLength); reason != "" {
+			items[i].Status = models.BulkSaveInvalid
+			items[i].Error = reason
+			continue
+		}
+		valid = append(valid, i)
+	}
+	if len(valid) == 0 {
+		return items, nil
+	}
+
+	links := make([]models.InsertData, 0, len(valid))
+	for _, i := range valid {
+		links = append(links, models.InsertData{OriginalURL: urls[i].OriginalURL, Schedule: urls[i].Schedule()})
+	}
+	results, err := generator.SaveBatch(ctx, gen, provider, links, userID)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range valid {
+		items[i].Status = results[j].Status
+		items[i].ShortURL = fmt.Sprintf("%s/%s", cfg.BaseShortURL, results[j].ShortURL)
+	}
+	return items, nil
+}
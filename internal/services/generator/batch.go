@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"context"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// SaveBatch генерирует короткие URL для ссылок links и сохраняет их одним пакетом.
+// Из links используются полный URL и срок действия, короткий URL заполняется генератором.
+// При коллизиях короткие URL генерируются заново только для ссылок, короткий URL
+// которых оказался занят, не более MaxAttempts раз. Возвращает результат каждой
+// ссылки в порядке links; статус BulkSaveCollision в результатах не встречается.
+func SaveBatch(ctx context.Context, gen Generator, provider storage.URLProvider, links []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	results := make([]models.BulkSaveResult, len(links))
+	pending := make([]int, len(links))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	err := Retry(func(attempt int) error {
+		data := make([]models.InsertData, 0, len(pending))
+		for _, i := range pending {
+			link := links[i]
+			shortURL, err := gen.Generate(link.OriginalURL, attempt)
+			if err != nil {
+				return err
+			}
+			link.ShortURL = shortURL
+			data = append(data, link)
+		}
+
+		saved, err := provider.BulkSaveURL(ctx, data, userID)
+		if err != nil {
+			return err
+		}
+
+		var collided []int
+		for j, result := range saved {
+			if result.Status == models.BulkSaveCollision {
+				collided = append(collided, pending[j])
+				continue
+			}
+			results[pending[j]] = result
+		}
+		pending = collided
+		if len(pending) > 0 {
+			return storage.ErrShortURLCollision
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
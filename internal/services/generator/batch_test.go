@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage/mem"
+)
+
+// attemptGenerator на первой попытке возвращает занятый короткий URL для ссылки busy.
+type attemptGenerator struct {
+	busy  string
+	calls int
+}
+
+func (g *attemptGenerator) Generate(fullURL string, attempt int) (string, error) {
+	g.calls++
+	if attempt == 0 && fullURL == g.busy {
+		return "ya", nil
+	}
+	return fmt.Sprintf("%s-%d", fullURL, attempt), nil
+}
+
+func TestSaveBatch(t *testing.T) {
+	ctx := context.Background()
+	provider, err := mem.New(&config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json")})
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	defer provider.Close()
+	require.NoError(t, provider.SaveURL(ctx, "http://ya.ru", "ya", "user", models.Schedule{}))
+
+	gen := &attemptGenerator{busy: "http://go.dev"}
+	links := []models.InsertData{{OriginalURL: "http://go.dev"}, {OriginalURL: "http://ya.ru"}, {OriginalURL: "http://vk.com"}}
+	results, err := SaveBatch(ctx, gen, provider, links, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{
+		{Status: models.BulkSaveCreated, ShortURL: "http://go.dev-1"},
+		{Status: models.BulkSaveExisting, ShortURL: "ya"},
+		{Status: models.BulkSaveCreated, ShortURL: "http://vk.com-0"},
+	}, results)
+	// на второй попытке короткий URL генерируется только для ссылки с коллизией
+	assert.Equal(t, 4, gen.calls)
+}
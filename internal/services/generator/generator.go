@@ -1,19 +1,98 @@
 package generator
 
-import "math/rand"
-
-const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-// GenerateShortURL генерирует уникальный короткий идентификатор URL.
-// Используется для создания короткой ссылки из произвольного набора символов.
-// Генерируемый идентификатор имеет фиксированную длину 6 символов и формируется
-// из безопасного набора символов, подходящих для URL.
-//
-// Возвращает строку, представляющую собой короткий URL.
-func GenerateShortURL() string {
-	shortURL := make([]byte, 6)
-	for i := range shortURL {
-		shortURL[i] = letters[rand.Intn(len(letters))]
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+)
+
+// Стратегии генерации коротких URL, которые можно выбрать в конфигурации.
+const (
+	// TypeRandom - криптографически случайные короткие URL.
+	TypeRandom = "random"
+	// TypeSequence - порядковый номер ссылки, перемешанный обратимым преобразованием.
+	TypeSequence = "sequence"
+	// TypeHash - короткий URL, вычисленный по хешу полного URL.
+	TypeHash = "hash"
+)
+
+const (
+	// DefaultAlphabet - алфавит коротких URL по умолчанию (base62).
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// DefaultLength - длина короткого URL по умолчанию.
+	DefaultLength = 6
+	// MaxLength - максимальная длина короткого URL.
+	MaxLength = 64
+)
+
+// возможные ошибки пакета
+var (
+	// ErrUnknownGenerator описывает ошибку выбора неизвестной стратегии генерации.
+	ErrUnknownGenerator = errors.New("unknown short url generator")
+	// ErrInvalidAlphabet описывает ошибку неподходящего алфавита коротких URL.
+	ErrInvalidAlphabet = errors.New("alphabet must contain at least 2 unique characters from A-Z, a-z, 0-9, '-', '.', '_', '~'")
+	// ErrInvalidLength описывает ошибку недопустимой длины короткого URL.
+	ErrInvalidLength = errors.New("invalid short url length")
+)
+
+// Generator описывает стратегию генерации коротких URL.
+type Generator interface {
+	// Generate возвращает короткий URL для полного URL fullURL. Номер попытки attempt
+	// начинается с нуля и увеличивается после каждой коллизии короткого URL, чтобы
+	// детерминированные стратегии могли выдать другой результат.
+	Generate(fullURL string, attempt int) (string, error)
+}
+
+// New создаёт генератор коротких URL, выбранный в конфигурации.
+// По умолчанию используются случайные короткие URL длиной DefaultLength из DefaultAlphabet.
+func New(cfg *config.Config) (Generator, error) {
+	length := cfg.ShortURLLength
+	if length == 0 {
+		length = DefaultLength
+	}
+	alphabet := cfg.ShortURLAlphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+
+	switch cfg.ShortURLGenerator {
+	case "", TypeRandom:
+		return NewRandom(length, alphabet)
+	case TypeSequence:
+		return NewSequence(length, alphabet, cfg.TokenSecret)
+	case TypeHash:
+		return NewHash(length, alphabet)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownGenerator, cfg.ShortURLGenerator)
+	}
+}
+
+// validate проверяет длину короткого URL и алфавит. Алфавит состоит только из
+// незарезервированных символов URL (RFC 3986), так как короткие URL собираются
+// из отдельных байтов алфавита и подставляются в путь без экранирования.
+func validate(length int, alphabet string) error {
+	if length <= 0 || length > MaxLength {
+		return fmt.Errorf("%w: %d", ErrInvalidLength, length)
+	}
+	if len(alphabet) < 2 {
+		return ErrInvalidAlphabet
+	}
+	var seen [256]bool
+	for i := 0; i < len(alphabet); i++ {
+		if !isUnreserved(alphabet[i]) || seen[alphabet[i]] {
+			return ErrInvalidAlphabet
+		}
+		seen[alphabet[i]] = true
+	}
+	return nil
+}
+
+// isUnreserved проверяет, что c - незарезервированный символ URL.
+func isUnreserved(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
 	}
-	return string(shortURL)
+	return c == '-' || c == '.' || c == '_' || c == '~'
 }
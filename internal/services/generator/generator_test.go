@@ -1,24 +1,202 @@
 package generator
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/storage"
 )
 
-func TestGenerateShortURL(t *testing.T) {
+func TestNew(t *testing.T) {
+	gen, err := New(&config.Config{})
+	require.NoError(t, err)
+	assert.IsType(t, &Random{}, gen)
+
+	gen, err = New(&config.Config{ShortURLGenerator: TypeSequence, TokenSecret: "secret"})
+	require.NoError(t, err)
+	assert.IsType(t, &Sequence{}, gen)
+
+	gen, err = New(&config.Config{ShortURLGenerator: TypeHash})
+	require.NoError(t, err)
+	assert.IsType(t, &Hash{}, gen)
+
+	_, err = New(&config.Config{ShortURLGenerator: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownGenerator)
+	_, err = New(&config.Config{ShortURLAlphabet: "aab"})
+	assert.ErrorIs(t, err, ErrInvalidAlphabet)
+	// многобайтовые символы и символы, значимые в URL, не допускаются
+	for _, alphabet := range []string{"abcя", "ab/", "ab?", "ab#", "ab%"} {
+		_, err = New(&config.Config{ShortURLAlphabet: alphabet})
+		assert.ErrorIs(t, err, ErrInvalidAlphabet, alphabet)
+	}
+	_, err = New(&config.Config{ShortURLAlphabet: "ab-._~"})
+	assert.NoError(t, err)
+	_, err = New(&config.Config{ShortURLLength: -1})
+	assert.ErrorIs(t, err, ErrInvalidLength)
+	_, err = New(&config.Config{ShortURLGenerator: TypeSequence})
+	assert.ErrorIs(t, err, ErrNoSecret)
+}
+
+func TestRandom(t *testing.T) {
+	gen, err := NewRandom(8, "abc")
+	require.NoError(t, err)
 	for i := 0; i < 5; i++ {
-		url := GenerateShortURL()
-		// проверяем что получаем строку
-		assert.IsType(t, "", url)
-		// проверяем, что строка содержит 6 символов
-		assert.Len(t, url, 6)
+		url, err := gen.Generate("http://ya.ru", 0)
+		require.NoError(t, err)
+		// проверяем длину и алфавит
+		assert.Len(t, url, 8)
+		assert.Empty(t, strings.Trim(url, "abc"))
+	}
+}
+
+func TestSequence(t *testing.T) {
+	gen, err := NewSequence(2, "0123456789", "secret")
+	require.NoError(t, err)
 
+	// все номера из домена дают различные короткие URL, которые декодируются обратно
+	seen := make(map[string]struct{})
+	for i := uint64(0); i < 100; i++ {
+		url, err := gen.Generate("http://ya.ru", 0)
+		require.NoError(t, err)
+		assert.Len(t, url, 2)
+		seen[url] = struct{}{}
+
+		n, err := gen.Decode(url)
+		require.NoError(t, err)
+		assert.Equal(t, i, n)
 	}
+	assert.Len(t, seen, 100)
+
+	_, err = gen.Generate("http://ya.ru", 0)
+	assert.ErrorIs(t, err, ErrSequenceExhausted)
+
+	// счётчик продолжается с заданного значения
+	gen, err = NewSequence(DefaultLength, DefaultAlphabet, "secret")
+	require.NoError(t, err)
+	gen.Seed(1000)
+	url, err := gen.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	n, err := gen.Decode(url)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), n)
+
+	// другой секрет даёт другую перестановку
+	other, err := NewSequence(DefaultLength, DefaultAlphabet, "other")
+	require.NoError(t, err)
+	other.Seed(1000)
+	otherURL, err := other.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, url, otherURL)
 }
 
-func BenchmarkGenerateShortURL(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		GenerateShortURL()
+// rangeStore раздаёт диапазоны порядковых номеров из общего счётчика.
+type rangeStore struct {
+	next uint64
+	err  error
+}
+
+func (s *rangeStore) ReserveSequence(_ context.Context, n uint64) (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	start := s.next
+	s.next += n
+	return start, nil
+}
+
+func TestSequenceRanges(t *testing.T) {
+	store := &rangeStore{next: 5}
+	first, err := NewSequence(DefaultLength, DefaultAlphabet, "secret")
+	require.NoError(t, err)
+	first.UseRanges(store)
+	second, err := NewSequence(DefaultLength, DefaultAlphabet, "secret")
+	require.NoError(t, err)
+	second.UseRanges(store)
+
+	// экземпляры с одним хранилищем получают непересекающиеся диапазоны номеров
+	for i, gen := range []*Sequence{first, second, first} {
+		url, err := gen.Generate("http://ya.ru", 0)
+		require.NoError(t, err)
+		n, err := gen.Decode(url)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{5, 5 + sequenceRange, 6}[i], n)
+	}
+
+	// ошибка резервирования диапазона возвращается генератором
+	third, err := NewSequence(DefaultLength, DefaultAlphabet, "secret")
+	require.NoError(t, err)
+	third.UseRanges(&rangeStore{err: storage.ErrUnavailable})
+	_, err = third.Generate("http://ya.ru", 0)
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+}
+
+func TestHash(t *testing.T) {
+	gen, err := NewHash(DefaultLength, DefaultAlphabet)
+	require.NoError(t, err)
+
+	first, err := gen.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Len(t, first, DefaultLength)
+
+	// один и тот же URL даёт один и тот же короткий URL
+	again, err := gen.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// следующая попытка даёт другой короткий URL
+	retry, err := gen.Generate("http://ya.ru", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, retry)
+}
+
+func TestRetry(t *testing.T) {
+	// коллизия устраняется повторной генерацией
+	calls := 0
+	err := Retry(func(attempt int) error {
+		calls++
+		if attempt < 2 {
+			return storage.ErrShortURLCollision
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// количество попыток ограничено
+	calls = 0
+	err = Retry(func(int) error {
+		calls++
+		return storage.ErrShortURLCollision
+	})
+	assert.ErrorIs(t, err, ErrAttemptsExceeded)
+	assert.Equal(t, MaxAttempts, calls)
+
+	// остальные ошибки не повторяются
+	calls = 0
+	errSave := errors.New("save error")
+	err = Retry(func(int) error {
+		calls++
+		return errSave
+	})
+	assert.ErrorIs(t, err, errSave)
+	assert.Equal(t, 1, calls)
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	random, _ := NewRandom(DefaultLength, DefaultAlphabet)
+	sequence, _ := NewSequence(DefaultLength, DefaultAlphabet, "secret")
+	hash, _ := NewHash(DefaultLength, DefaultAlphabet)
+
+	for name, gen := range map[string]Generator{TypeRandom: random, TypeSequence: sequence, TypeHash: hash} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				gen.Generate("http://ya.ru", 0)
+			}
+		})
 	}
 }
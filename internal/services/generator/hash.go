@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"strconv"
+)
+
+// Hash вычисляет короткий URL по хешу SHA-256 полного URL, поэтому один и тот же
+// полный URL всегда получает один и тот же короткий URL.
+type Hash struct {
+	length   int    // Длина короткого URL.
+	alphabet string // Символы, из которых состоит короткий URL.
+}
+
+// NewHash создаёт генератор коротких URL по хешу полного URL.
+func NewHash(length int, alphabet string) (*Hash, error) {
+	if err := validate(length, alphabet); err != nil {
+		return nil, err
+	}
+	return &Hash{length: length, alphabet: alphabet}, nil
+}
+
+// Generate возвращает короткий URL, вычисленный по хешу fullURL. При повторных попытках
+// к полному URL добавляется номер попытки, чтобы разрешить коллизию.
+func (g *Hash) Generate(fullURL string, attempt int) (string, error) {
+	data := []byte(fullURL)
+	if attempt > 0 {
+		data = append(append(data, 0), strconv.Itoa(attempt)...)
+	}
+	sum := sha256.Sum256(data)
+
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(g.alphabet)))
+	digit := new(big.Int)
+	shortURL := make([]byte, g.length)
+	for i := range shortURL {
+		n.DivMod(n, base, digit)
+		shortURL[i] = g.alphabet[digit.Int64()]
+	}
+	return string(shortURL), nil
+}
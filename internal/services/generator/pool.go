@@ -0,0 +1,200 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// poolChunks - во сколько раз общий пул ключей больше пачки, забираемой экземпляром.
+	poolChunks = 10
+	// poolCheckInterval - период проверки заполненности общего пула.
+	poolCheckInterval = 30 * time.Second
+	// poolTimeout - таймаут операций с хранилищем ключей.
+	poolTimeout = 5 * time.Second
+)
+
+// ErrPoolSource описывает ошибку заполнения пула генератором, который выдаёт
+// одинаковые короткие URL для одинаковых полных URL.
+var ErrPoolSource = errors.New("key pool cannot be filled by hash generator")
+
+// Pool выдаёт короткие URL из пула заранее сгенерированных свободных ключей.
+// Экземпляр забирает ключи из хранилища пачками по chunkSize и раздаёт их из
+// локальной пачки без обращения к хранилищу. Фоновая горутина Run пополняет
+// общий пул ключами от генератора source и возвращает неиспользованные ключи
+// в пул при остановке приложения.
+//
+// Если пул пуст или уже остановлен, короткие URL генерируются напрямую через source.
+// Пока одна горутина забирает пачку из хранилища, остальные не ждут её, а тоже
+// генерируют короткие URL напрямую.
+type Pool struct {
+	store     storage.KeyStore // Хранилище пула ключей.
+	source    Generator        // Генератор, которым заполняется пул.
+	chunkSize int              // Количество ключей, забираемых из пула за раз.
+	mutex     sync.Mutex       // Мьютекс для локальной пачки ключей.
+	chunk     []string         // Локальная пачка ключей.
+	claiming  bool             // Признак того, что пачка уже забирается из хранилища.
+	stopped   bool             // Признак остановки пула.
+	fill      chan struct{}    // Сигнал о необходимости пополнить общий пул.
+}
+
+// NewPool создаёт генератор, раздающий ключи из пула store пачками по chunkSize.
+// Генератор source должен выдавать различные короткие URL на каждый вызов,
+// поэтому генератор по хешу URL для заполнения пула не подходит.
+func NewPool(store storage.KeyStore, source Generator, chunkSize int) (*Pool, error) {
+	if _, ok := source.(*Hash); ok {
+		return nil, ErrPoolSource
+	}
+	return &Pool{
+		store:     store,
+		source:    source,
+		chunkSize: chunkSize,
+		fill:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Generate возвращает следующий ключ из локальной пачки, при необходимости
+// забирая новую пачку из общего пула.
+func (p *Pool) Generate(fullURL string, attempt int) (string, error) {
+	p.mutex.Lock()
+	if len(p.chunk) == 0 && !p.stopped && !p.claiming {
+		p.claiming = true
+		p.mutex.Unlock()
+		p.claim()
+		p.mutex.Lock()
+	}
+	defer p.mutex.Unlock()
+
+	if len(p.chunk) == 0 {
+		return p.source.Generate(fullURL, attempt)
+	}
+
+	key := p.chunk[len(p.chunk)-1]
+	p.chunk = p.chunk[:len(p.chunk)-1]
+	return key, nil
+}
+
+// claim забирает пачку ключей из общего пула в локальную пачку. Вызывается без
+// мьютекса, чтобы обращение к хранилищу не блокировало выдачу ключей другим
+// запросам. Если пул остановился, пока пачка забиралась, ключи возвращаются обратно.
+func (p *Pool) claim() {
+	ctx, cancel := context.WithTimeout(context.Background(), poolTimeout)
+	defer cancel()
+
+	keys, err := p.store.ClaimKeys(ctx, p.chunkSize)
+	switch {
+	case errors.Is(err, storage.ErrUnavailable):
+		// пока хранилище недоступно, ошибка повторялась бы при создании каждой ссылки
+		logger.Log.Debug("key store is unavailable", zap.Error(err))
+	case err != nil:
+		logger.Log.Error("cannot claim keys", zap.Error(err))
+	}
+
+	p.mutex.Lock()
+	p.claiming = false
+	stopped := p.stopped
+	if !stopped {
+		p.chunk = append(p.chunk, keys...)
+	}
+	p.mutex.Unlock()
+
+	if stopped {
+		p.releaseKeys(keys)
+		return
+	}
+
+	if len(keys) < p.chunkSize {
+		// общий пул заканчивается, просим фоновую горутину пополнить его
+		select {
+		case p.fill <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run пополняет общий пул ключей, пока не будет закрыт stopChan. При остановке
+// неиспользованные ключи локальной пачки возвращаются в общий пул.
+//
+// wg *sync.WaitGroup: группа ожидания для синхронизации завершения горутины.
+func (p *Pool) Run(wg *sync.WaitGroup, stopChan chan int64) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+
+	p.refill()
+	for {
+		select {
+		case <-p.fill:
+			p.refill()
+		case <-ticker.C:
+			p.refill()
+		case <-stopChan:
+			p.release()
+			return
+		}
+	}
+}
+
+// refill дополняет общий пул до poolChunks пачек, если в нём осталось меньше половины.
+func (p *Pool) refill() {
+	ctx, cancel := context.WithTimeout(context.Background(), poolTimeout)
+	defer cancel()
+
+	target := p.chunkSize * poolChunks
+	count, err := p.store.CountFreeKeys(ctx)
+	if err != nil {
+		logger.Log.Error("cannot count free keys", zap.Error(err))
+		return
+	}
+	if count >= target/2 {
+		return
+	}
+
+	keys := make([]string, 0, target-count)
+	for len(keys) < target-count {
+		key, err := p.source.Generate("", 0)
+		if err != nil {
+			logger.Log.Error("cannot generate key", zap.Error(err))
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	added, err := p.store.AddKeys(ctx, keys)
+	if err != nil {
+		logger.Log.Error("cannot add keys", zap.Error(err))
+		return
+	}
+	logger.Log.Sugar().Debugf("в пул добавлено %d ключей", added)
+}
+
+// release останавливает выдачу ключей из пула и возвращает локальную пачку в общий пул.
+func (p *Pool) release() {
+	p.mutex.Lock()
+	keys := p.chunk
+	p.chunk = nil
+	p.stopped = true
+	p.mutex.Unlock()
+
+	p.releaseKeys(keys)
+}
+
+// releaseKeys возвращает ключи в общий пул.
+func (p *Pool) releaseKeys(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), poolTimeout)
+	defer cancel()
+	if err := p.store.ReleaseKeys(ctx, keys); err != nil {
+		logger.Log.Error("cannot release keys", zap.Error(err))
+	}
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"github.com/zYoma/go-url-shortener/internal/storage/mem"
+)
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+	provider, err := mem.New(&config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json")})
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	defer provider.Close()
+	store := provider.(storage.KeyStore)
+
+	source, err := NewRandom(DefaultLength, DefaultAlphabet)
+	require.NoError(t, err)
+	pool, err := NewPool(store, source, 10)
+	require.NoError(t, err)
+
+	// пул заполняется при запуске фоновой горутины
+	stopChan := make(chan int64)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go pool.Run(&wg, stopChan)
+	assert.Eventually(t, func() bool {
+		count, err := store.CountFreeKeys(ctx)
+		return err == nil && count == 10*poolChunks
+	}, time.Second, 10*time.Millisecond)
+
+	// ключи выдаются из локальной пачки, забранной из общего пула
+	seen := make(map[string]struct{})
+	for i := 0; i < 3; i++ {
+		key, err := pool.Generate("http://ya.ru", 0)
+		require.NoError(t, err)
+		seen[key] = struct{}{}
+	}
+	assert.Len(t, seen, 3)
+	count, err := store.CountFreeKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 10*poolChunks-10, count)
+
+	// при остановке неиспользованные ключи возвращаются в пул
+	close(stopChan)
+	wg.Wait()
+	count, err = store.CountFreeKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 10*poolChunks-3, count)
+
+	// после остановки ключи генерируются напрямую
+	key, err := pool.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Len(t, key, DefaultLength)
+	count, err = store.CountFreeKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 10*poolChunks-3, count)
+
+	hash, err := NewHash(DefaultLength, DefaultAlphabet)
+	require.NoError(t, err)
+	_, err = NewPool(store, hash, 10)
+	assert.ErrorIs(t, err, ErrPoolSource)
+}
+
+// slowKeyStore - хранилище ключей, которое отдаёт пачку только после закрытия unblock.
+type slowKeyStore struct {
+	storage.KeyStore
+	unblock chan struct{}
+}
+
+func (s *slowKeyStore) ClaimKeys(ctx context.Context, n int) ([]string, error) {
+	<-s.unblock
+	return s.KeyStore.ClaimKeys(ctx, n)
+}
+
+func TestPoolClaimDoesNotBlockGenerate(t *testing.T) {
+	ctx := context.Background()
+	provider, err := mem.New(&config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json")})
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	defer provider.Close()
+	store := &slowKeyStore{KeyStore: provider.(storage.KeyStore), unblock: make(chan struct{})}
+	_, err = store.AddKeys(ctx, []string{"key001", "key002"})
+	require.NoError(t, err)
+
+	source, err := NewRandom(DefaultLength, DefaultAlphabet)
+	require.NoError(t, err)
+	pool, err := NewPool(store, source, 10)
+	require.NoError(t, err)
+
+	// первый запрос забирает пачку из хранилища
+	claimed := make(chan string)
+	go func() {
+		key, _ := pool.Generate("http://ya.ru", 0)
+		claimed <- key
+	}()
+	assert.Eventually(t, func() bool {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return pool.claiming
+	}, time.Second, time.Millisecond)
+
+	// остальные запросы не ждут хранилище и генерируют короткие URL напрямую
+	key, err := pool.Generate("http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.NotContains(t, []string{"key001", "key002"}, key)
+
+	close(store.unblock)
+	assert.Contains(t, []string{"key001", "key002"}, <-claimed)
+}
@@ -0,0 +1,46 @@
+package generator
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// Random генерирует криптографически случайные короткие URL.
+type Random struct {
+	length   int    // Длина короткого URL.
+	alphabet string // Символы, из которых состоит короткий URL.
+	limit    int    // Байты не меньше limit отбрасываются, чтобы символы были равновероятны.
+}
+
+// NewRandom создаёт генератор случайных коротких URL заданной длины из символов alphabet.
+func NewRandom(length int, alphabet string) (*Random, error) {
+	if err := validate(length, alphabet); err != nil {
+		return nil, err
+	}
+	return &Random{
+		length:   length,
+		alphabet: alphabet,
+		limit:    256 - 256%len(alphabet),
+	}, nil
+}
+
+// Generate возвращает новый случайный короткий URL. Полный URL и номер попытки не учитываются.
+func (g *Random) Generate(fullURL string, attempt int) (string, error) {
+	shortURL := make([]byte, 0, g.length)
+	buf := make([]byte, g.length+g.length/2)
+	for len(shortURL) < g.length {
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= g.limit {
+				continue
+			}
+			shortURL = append(shortURL, g.alphabet[int(b)%len(g.alphabet)])
+			if len(shortURL) == g.length {
+				break
+			}
+		}
+	}
+	return string(shortURL), nil
+}
@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"errors"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// MaxAttempts - максимальное количество попыток сохранить ссылку с новым коротким URL
+// при коллизиях коротких URL.
+const MaxAttempts = 5
+
+// ErrAttemptsExceeded описывает ошибку, когда за MaxAttempts попыток не удалось
+// сгенерировать свободный короткий URL.
+var ErrAttemptsExceeded = errors.New("failed to generate unique short url")
+
+// Retry вызывает save, пока хранилище сообщает о коллизии короткого URL, но не более
+// MaxAttempts раз. Функция save должна на каждой попытке генерировать новые короткие URL;
+// номер попытки начинается с нуля.
+//
+// Любая ошибка, кроме storage.ErrShortURLCollision, возвращается без повторов.
+func Retry(save func(attempt int) error) error {
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		err := save(attempt)
+		if !errors.Is(err, storage.ErrShortURLCollision) {
+			return err
+		}
+		logger.Log.Sugar().Warnf("коллизия короткого URL, попытка %d из %d", attempt+1, MaxAttempts)
+	}
+	return errors.Join(ErrAttemptsExceeded, storage.ErrShortURLCollision)
+}
@@ -0,0 +1,235 @@
+package generator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// feistelRounds - количество раундов сети Фейстеля, перемешивающей порядковые номера.
+const feistelRounds = 4
+
+// maxSequenceDomain ограничивает количество различных порядковых номеров,
+// чтобы вычисления не переполняли uint64.
+const maxSequenceDomain = 1 << 62
+
+// sequenceRange - количество порядковых номеров, резервируемых экземпляром в хранилище за раз.
+const sequenceRange = 1000
+
+// возможные ошибки последовательного генератора
+var (
+	// ErrNoSecret описывает ошибку отсутствия секрета для перемешивания порядковых номеров.
+	ErrNoSecret = errors.New("sequence generator requires a token secret")
+	// ErrSequenceExhausted описывает ошибку, когда все короткие URL заданной длины уже выданы.
+	ErrSequenceExhausted = errors.New("short url sequence exhausted")
+	// ErrInvalidShortURL описывает ошибку декодирования короткого URL, выданного не этим генератором.
+	ErrInvalidShortURL = errors.New("invalid short url")
+)
+
+// Sequence выдаёт короткие URL по возрастающему счётчику. Номер перемешивается
+// сетью Фейстеля с ключом из секрета приложения, поэтому соседние короткие URL
+// не похожи друг на друга и их нельзя перебрать, зная один из них.
+// Преобразование обратимо: Decode восстанавливает порядковый номер.
+//
+// По умолчанию номера выдаются локальным счётчиком. После UseRanges номера берутся
+// из диапазонов, зарезервированных в хранилище, поэтому несколько экземпляров
+// приложения не выдают одинаковые номера.
+type Sequence struct {
+	length   int                   // Длина короткого URL.
+	alphabet string                // Символы, из которых состоит короткий URL.
+	key      []byte                // Ключ раундовой функции.
+	domain   uint64                // Количество различных коротких URL.
+	half     uint                  // Количество бит в половине блока сети Фейстеля.
+	counter  atomic.Uint64         // Следующий порядковый номер локального счётчика.
+	ranges   storage.SequenceStore // Хранилище диапазонов номеров.
+	mutex    sync.Mutex            // Мьютекс для текущего диапазона.
+	next     uint64                // Следующий номер текущего диапазона.
+	end      uint64                // Конец текущего диапазона.
+}
+
+// NewSequence создаёт последовательный генератор коротких URL. Секрет secret
+// определяет перестановку номеров и не должен меняться между запусками.
+func NewSequence(length int, alphabet string, secret string) (*Sequence, error) {
+	if err := validate(length, alphabet); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	// количество коротких URL равно len(alphabet)^length, но не больше maxSequenceDomain
+	domain := uint64(1)
+	for i := 0; i < length && domain < maxSequenceDomain; i++ {
+		hi, lo := bits.Mul64(domain, uint64(len(alphabet)))
+		if hi != 0 || lo > maxSequenceDomain {
+			domain = maxSequenceDomain
+			break
+		}
+		domain = lo
+	}
+
+	// блок сети Фейстеля состоит из двух половин одинаковой длины
+	width := uint(bits.Len64(domain - 1))
+	width += width % 2
+	if width < 2 {
+		width = 2
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("short url sequence"))
+
+	return &Sequence{
+		length:   length,
+		alphabet: alphabet,
+		key:      mac.Sum(nil),
+		domain:   domain,
+		half:     width / 2,
+	}, nil
+}
+
+// Seed устанавливает счётчик не меньше next, например по количеству уже сохранённых ссылок.
+// Значение счётчика никогда не уменьшается.
+func (g *Sequence) Seed(next uint64) {
+	for {
+		current := g.counter.Load()
+		if current >= next || g.counter.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// UseRanges переключает генератор на номера из диапазонов по sequenceRange номеров,
+// которые резервируются в store. Номера, не выданные до остановки экземпляра, пропускаются.
+func (g *Sequence) UseRanges(store storage.SequenceStore) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.ranges = store
+	g.next, g.end = 0, 0
+}
+
+// Generate возвращает короткий URL для следующего порядкового номера.
+// Полный URL и номер попытки не учитываются: после коллизии берётся следующий номер.
+func (g *Sequence) Generate(fullURL string, attempt int) (string, error) {
+	n, err := g.nextNumber()
+	if err != nil {
+		return "", err
+	}
+	if n >= g.domain {
+		return "", ErrSequenceExhausted
+	}
+	return g.encode(g.permute(n)), nil
+}
+
+// nextNumber возвращает следующий порядковый номер локального счётчика или текущего
+// диапазона, резервируя новый диапазон, когда текущий закончился.
+func (g *Sequence) nextNumber() (uint64, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.ranges == nil {
+		return g.counter.Add(1) - 1, nil
+	}
+
+	if g.next == g.end {
+		ctx, cancel := context.WithTimeout(context.Background(), poolTimeout)
+		defer cancel()
+		start, err := g.ranges.ReserveSequence(ctx, sequenceRange)
+		if err != nil {
+			return 0, err
+		}
+		g.next, g.end = start, start+sequenceRange
+	}
+	n := g.next
+	g.next++
+	return n, nil
+}
+
+// Decode восстанавливает порядковый номер по короткому URL.
+func (g *Sequence) Decode(shortURL string) (uint64, error) {
+	if len(shortURL) != g.length {
+		return 0, ErrInvalidShortURL
+	}
+	var v uint64
+	for i := len(shortURL) - 1; i >= 0; i-- {
+		digit := strings.IndexByte(g.alphabet, shortURL[i])
+		if digit < 0 {
+			return 0, ErrInvalidShortURL
+		}
+		hi, lo := bits.Mul64(v, uint64(len(g.alphabet)))
+		if hi != 0 || lo+uint64(digit) < lo {
+			return 0, ErrInvalidShortURL
+		}
+		v = lo + uint64(digit)
+	}
+	if v >= g.domain {
+		return 0, ErrInvalidShortURL
+	}
+	return g.unpermute(v), nil
+}
+
+// permute переставляет номера внутри [0, domain). Сеть Фейстеля переставляет
+// блок из 2*half бит, а значения за пределами domain пропускаются через
+// повторное применение перестановки (cycle walking).
+func (g *Sequence) permute(v uint64) uint64 {
+	v = g.feistel(v)
+	for v >= g.domain {
+		v = g.feistel(v)
+	}
+	return v
+}
+
+// unpermute выполняет перестановку, обратную permute.
+func (g *Sequence) unpermute(v uint64) uint64 {
+	v = g.feistelInverse(v)
+	for v >= g.domain {
+		v = g.feistelInverse(v)
+	}
+	return v
+}
+
+func (g *Sequence) feistel(v uint64) uint64 {
+	mask := uint64(1)<<g.half - 1
+	l, r := v>>g.half, v&mask
+	for i := 0; i < feistelRounds; i++ {
+		l, r = r, l^g.round(i, r)
+	}
+	return l<<g.half | r
+}
+
+func (g *Sequence) feistelInverse(v uint64) uint64 {
+	mask := uint64(1)<<g.half - 1
+	l, r := v>>g.half, v&mask
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^g.round(i, l), l
+	}
+	return l<<g.half | r
+}
+
+// round - раундовая функция сети Фейстеля: хеш SHA-256 от ключа, номера раунда и половины блока.
+func (g *Sequence) round(i int, v uint64) uint64 {
+	buf := make([]byte, len(g.key)+9)
+	copy(buf, g.key)
+	buf[len(g.key)] = byte(i)
+	binary.BigEndian.PutUint64(buf[len(g.key)+1:], v)
+	sum := sha256.Sum256(buf)
+	return binary.BigEndian.Uint64(sum[:8]) & (uint64(1)<<g.half - 1)
+}
+
+// encode записывает число в системе счисления по алфавиту, младшими разрядами вперёд,
+// дополняя короткий URL до фиксированной длины.
+func (g *Sequence) encode(v uint64) string {
+	base := uint64(len(g.alphabet))
+	shortURL := make([]byte, g.length)
+	for i := range shortURL {
+		shortURL[i] = g.alphabet[v%base]
+		v /= base
+	}
+	return string(shortURL)
+}
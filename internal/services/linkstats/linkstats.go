@@ -0,0 +1,118 @@
+// Package linkstats строит статистику переходов по ссылке для её владельца.
+package linkstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// DefaultTop - сколько самых частых значений каждого вида возвращается по умолчанию.
+	DefaultTop = 10
+	// MaxTop - сколько самых частых значений каждого вида можно запросить.
+	MaxTop = 100
+	// MaxBuckets - максимальное количество шагов в периоде статистики.
+	MaxBuckets = 1000
+)
+
+// defaultPeriods - период статистики по умолчанию для каждого шага.
+var defaultPeriods = map[models.StatsInterval]time.Duration{
+	models.StatsHour: 24 * time.Hour,
+	models.StatsDay:  30 * 24 * time.Hour,
+}
+
+// возможные ошибки пакета
+var (
+	// ErrForbidden описывает ошибку чтения статистики ссылки другого пользователя.
+	ErrForbidden = errors.New("link belongs to another user")
+	// ErrInvalidQuery описывает ошибку недопустимых параметров запроса статистики.
+	ErrInvalidQuery = errors.New("invalid stats query")
+)
+
+// NewQuery проверяет параметры запроса статистики и заполняет незаданные значениями
+// по умолчанию: шаг - сутки, период заканчивается в момент now, количество самых
+// частых значений - DefaultTop. Начало периода выравнивается по шагу.
+func NewQuery(shortURL string, from, to *time.Time, interval string, top int, now time.Time) (models.LinkStatsQuery, error) {
+	query := models.LinkStatsQuery{
+		ShortURL: shortURL,
+		Interval: models.StatsInterval(interval),
+		Top:      top,
+	}
+	if query.Interval == "" {
+		query.Interval = models.StatsDay
+	}
+	step := query.Interval.Duration()
+	if step == 0 {
+		return models.LinkStatsQuery{}, fmt.Errorf("%w: interval must be %s or %s", ErrInvalidQuery, models.StatsHour, models.StatsDay)
+	}
+	if query.Top == 0 {
+		query.Top = DefaultTop
+	}
+	if query.Top < 0 || query.Top > MaxTop {
+		return models.LinkStatsQuery{}, fmt.Errorf("%w: top must be between 1 and %d", ErrInvalidQuery, MaxTop)
+	}
+
+	query.To = now.UTC()
+	if to != nil {
+		query.To = to.UTC()
+	}
+	query.From = query.To.Add(-defaultPeriods[query.Interval])
+	if from != nil {
+		query.From = from.UTC()
+	}
+	if !query.From.Before(query.To) {
+		return models.LinkStatsQuery{}, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	query.From = query.From.Truncate(step)
+	if query.To.Sub(query.From) > MaxBuckets*step {
+		return models.LinkStatsQuery{}, fmt.Errorf("%w: period must not exceed %d %s intervals", ErrInvalidQuery, MaxBuckets, query.Interval)
+	}
+	return query, nil
+}
+
+// Get возвращает статистику переходов по ссылке, если ссылка принадлежит
+// пользователю userID, иначе - ErrForbidden. В Timeline попадают все шаги
+// периода, включая шаги без переходов. Если хранилище не хранит переходы,
+// возвращается storage.ErrNotSupported.
+func Get(ctx context.Context, provider storage.URLProvider, userID string, query models.LinkStatsQuery) (models.LinkStats, error) {
+	reader, ok := storage.As[storage.LinkStatsReader](provider)
+	if !ok {
+		return models.LinkStats{}, storage.ErrNotSupported
+	}
+
+	owner, err := reader.GetLinkOwner(ctx, query.ShortURL)
+	if err != nil {
+		return models.LinkStats{}, err
+	}
+	if owner != userID {
+		return models.LinkStats{}, ErrForbidden
+	}
+
+	stats, err := reader.GetLinkStats(ctx, query)
+	if err != nil {
+		return models.LinkStats{}, err
+	}
+	stats.Timeline = fillTimeline(query, stats.Timeline)
+	return stats, nil
+}
+
+// fillTimeline дополняет упорядоченные по времени шаги с переходами шагами
+// без переходов, чтобы в результате был каждый шаг периода.
+func fillTimeline(query models.LinkStatsQuery, buckets []models.ClickBucket) []models.ClickBucket {
+	step := query.Interval.Duration()
+	timeline := make([]models.ClickBucket, 0, int(query.To.Sub(query.From)/step)+1)
+	for t := query.From; t.Before(query.To); t = t.Add(step) {
+		bucket := models.ClickBucket{Time: t}
+		for len(buckets) > 0 && buckets[0].Time.Before(t.Add(step)) {
+			bucket.Clicks += buckets[0].Clicks
+			buckets = buckets[1:]
+		}
+		timeline = append(timeline, bucket)
+	}
+	return timeline
+}
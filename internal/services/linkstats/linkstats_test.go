@@ -0,0 +1,90 @@
+package linkstats
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"github.com/zYoma/go-url-shortener/internal/storage/mem"
+)
+
+func TestNewQuery(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+
+	// по умолчанию статистика по суткам за 30 дней, начало выровнено по суткам
+	query, err := NewQuery("short", nil, nil, "", 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkStatsQuery{
+		ShortURL: "short",
+		From:     time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC),
+		To:       now,
+		Interval: models.StatsDay,
+		Top:      DefaultTop,
+	}, query)
+
+	from := now.Add(-90 * time.Minute)
+	query, err = NewQuery("short", &from, nil, "hour", 3, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 10, 14, 0, 0, 0, time.UTC), query.From)
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		interval string
+		top      int
+	}{
+		{name: "неизвестный шаг", from: from, interval: "week"},
+		{name: "начало после конца", from: now.Add(time.Hour)},
+		{name: "слишком длинный период", from: now.Add(-MaxBuckets * 2 * time.Hour), interval: "hour"},
+		{name: "слишком много значений", from: from, top: MaxTop + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewQuery("short", &tt.from, nil, tt.interval, tt.top, now)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	provider, err := mem.New(&config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json")})
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	defer provider.Close()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, provider.SaveURL(ctx, "http://ya.ru", "short", "owner", models.Schedule{}))
+	require.NoError(t, provider.(storage.ClickStore).SaveClicks(ctx, []models.Click{
+		{ShortURL: "short", Time: day.Add(time.Hour), Referrer: "https://a.ru", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+		{ShortURL: "short", Time: day.Add(50 * time.Hour), UserAgent: "curl", IPPrefix: "10.0.1.0/24"},
+	}))
+
+	query := models.LinkStatsQuery{ShortURL: "short", From: day, To: day.Add(72 * time.Hour), Interval: models.StatsDay, Top: DefaultTop}
+	stats, err := Get(ctx, provider, "owner", query)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Clicks)
+	assert.Equal(t, 2, stats.Visitors)
+	// шаги без переходов тоже попадают в результат
+	assert.Equal(t, []models.ClickBucket{
+		{Time: day, Clicks: 1},
+		{Time: day.Add(24 * time.Hour), Clicks: 0},
+		{Time: day.Add(48 * time.Hour), Clicks: 1},
+	}, stats.Timeline)
+	assert.Equal(t, []models.ClickSource{{Value: "", Clicks: 1}, {Value: "https://a.ru", Clicks: 1}}, stats.Referrers)
+	assert.Equal(t, []models.ClickSource{{Value: "curl", Clicks: 2}}, stats.UserAgents)
+
+	// статистику чужой ссылки получить нельзя
+	_, err = Get(ctx, provider, "stranger", query)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	query.ShortURL = "missing"
+	_, err = Get(ctx, provider, "owner", query)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,38 @@
+// Package shorten создаёт одну короткую ссылку с псевдонимом пользователя или
+// коротким URL от генератора. Используется и HTTP, и gRPC обработчиками.
+package shorten
+
+import (
+	"context"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/alias"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// Save сохраняет ссылку со сроком действия schedule и псевдонимом customAlias
+// или, если он не задан, с коротким URL от генератора gen, и возвращает короткий URL.
+// При коллизии сгенерированного короткого URL генерируется новый. Занятый псевдоним
+// возвращается как alias.ErrTaken, уже сохранённый полный URL - как storage.ErrConflict.
+func Save(
+	ctx context.Context,
+	provider storage.URLProvider,
+	gen generator.Generator,
+	fullURL, customAlias, userID string,
+	schedule models.Schedule,
+) (string, error) {
+	if customAlias != "" {
+		return customAlias, alias.Save(ctx, provider, fullURL, customAlias, userID, schedule)
+	}
+
+	var shortURL string
+	err := generator.Retry(func(attempt int) error {
+		var err error
+		if shortURL, err = gen.Generate(fullURL, attempt); err != nil {
+			return err
+		}
+		return provider.SaveURL(ctx, fullURL, shortURL, userID, schedule)
+	})
+	return shortURL, err
+}
@@ -0,0 +1,48 @@
+package shorten
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/mocks"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/alias"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+func TestSave(t *testing.T) {
+	ctx := context.Background()
+	gen, err := generator.New(&config.Config{ShortURLGenerator: generator.TypeHash})
+	require.NoError(t, err)
+
+	t.Run("псевдоним занят", func(t *testing.T) {
+		provider := new(mocks.URLProvider)
+		provider.On("SaveURL", ctx, "https://example.com/", "spring-sale", "user", models.Schedule{}).
+			Return(storage.ErrShortURLCollision)
+
+		shortURL, err := Save(ctx, provider, gen, "https://example.com/", "spring-sale", "user", models.Schedule{})
+		assert.ErrorIs(t, err, alias.ErrTaken)
+		assert.Equal(t, "spring-sale", shortURL)
+	})
+
+	t.Run("коллизия сгенерированного URL", func(t *testing.T) {
+		first, err := gen.Generate("https://example.com/", 0)
+		require.NoError(t, err)
+
+		provider := new(mocks.URLProvider)
+		provider.On("SaveURL", ctx, "https://example.com/", first, "user", models.Schedule{}).
+			Return(storage.ErrShortURLCollision).Once()
+		provider.On("SaveURL", ctx, "https://example.com/", mock.Anything, "user", models.Schedule{}).
+			Return(nil).Once()
+
+		shortURL, err := Save(ctx, provider, gen, "https://example.com/", "", "user", models.Schedule{})
+		require.NoError(t, err)
+		assert.NotEqual(t, first, shortURL)
+		provider.AssertNumberOfCalls(t, "SaveURL", 2)
+	})
+}
@@ -0,0 +1,383 @@
+// Package breaker реализует автоматический выключатель над любым хранилищем URL.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// DefaultProbeInterval - период проверки недоступного хранилища по умолчанию.
+const DefaultProbeInterval = 5 * time.Second
+
+// Storage размыкается после threshold ошибок соединения с обёрнутым хранилищем подряд.
+// Таймауты медленных запросов (storage.ErrTimeout) и ошибки фоновой записи переходов
+// не учитываются, чтобы они не отключали переходы и создание ссылок.
+// Пока выключатель разомкнут, запросы сразу завершаются ошибкой storage.UnavailableError,
+// не дожидаясь соединения с хранилищем, а доступность хранилища раз в probeInterval
+// проверяется через Ping. Первая успешная проверка замыкает выключатель.
+//
+// Переходы по ранее открытым ссылкам в это время обслуживает кеш: он оборачивает
+// выключатель и отдаёт устаревшие записи, когда хранилище недоступно. Поэтому
+// выключатель включается только вместе с кешем.
+type Storage struct {
+	storage.StorageProvider // Обёрнутое хранилище.
+
+	threshold     int
+	probeInterval time.Duration
+
+	mutex     sync.Mutex
+	state     storage.CircuitState
+	failures  int           // Ошибки недоступности подряд в замкнутом состоянии.
+	nextProbe time.Time     // Время следующей проверки в разомкнутом состоянии.
+	stop      chan struct{} // Закрывается при закрытии хранилища, останавливает проверки.
+	done      chan struct{} // Закрывается после остановки проверок, nil если они не запущены.
+	now       func() time.Time
+}
+
+// New оборачивает provider выключателем, который размыкается после cfg.BreakerThreshold
+// ошибок недоступности подряд.
+func New(provider storage.StorageProvider, cfg *config.Config) *Storage {
+	probeInterval := cfg.BreakerProbeInterval
+	if probeInterval <= 0 {
+		probeInterval = DefaultProbeInterval
+	}
+	return &Storage{
+		StorageProvider: provider,
+		threshold:       cfg.BreakerThreshold,
+		probeInterval:   probeInterval,
+		state:           storage.CircuitClosed,
+		stop:            make(chan struct{}),
+		now:             time.Now,
+	}
+}
+
+// Unwrap возвращает обёрнутое хранилище.
+func (s *Storage) Unwrap() storage.StorageProvider {
+	return s.StorageProvider
+}
+
+// CircuitState возвращает текущее состояние выключателя.
+func (s *Storage) CircuitState() storage.CircuitState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state
+}
+
+// do выполняет запрос fn к хранилищу, если выключатель замкнут, и учитывает его результат.
+func (s *Storage) do(fn func() error) error {
+	if err := s.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	s.record(err)
+	return err
+}
+
+// allow возвращает storage.UnavailableError, если выключатель разомкнут.
+func (s *Storage) allow() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == storage.CircuitClosed {
+		return nil
+	}
+	// клиенту сообщается время до следующей проверки, но не меньше секунды,
+	// так как Retry-After передаётся в целых секундах
+	retryAfter := max(s.nextProbe.Sub(s.now()), time.Second)
+	return &storage.UnavailableError{RetryAfter: retryAfter.Round(time.Second)}
+}
+
+// record учитывает результат запроса к хранилищу и размыкает выключатель
+// после threshold ошибок соединения подряд. Таймаут запроса не меняет счётчик ошибок.
+func (s *Storage) record(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state != storage.CircuitClosed || errors.Is(err, storage.ErrTimeout) {
+		return
+	}
+	if !errors.Is(err, storage.ErrUnavailable) {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures < s.threshold {
+		return
+	}
+
+	logger.Log.Sugar().Warnf("Хранилище недоступно, выключатель разомкнут: %s", err)
+	s.state = storage.CircuitOpen
+	s.failures = 0
+	s.nextProbe = s.now().Add(s.probeInterval)
+	s.done = make(chan struct{})
+	go s.probe(s.done)
+}
+
+// probe проверяет доступность хранилища каждые probeInterval и замыкает
+// выключатель после первой успешной проверки.
+func (s *Storage) probe(done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.probeInterval)
+		err := s.StorageProvider.Ping(ctx)
+		cancel()
+
+		s.mutex.Lock()
+		if err == nil {
+			logger.Log.Sugar().Infoln("Хранилище снова доступно, выключатель замкнут")
+			s.state = storage.CircuitClosed
+			s.mutex.Unlock()
+			return
+		}
+		s.nextProbe = s.now().Add(s.probeInterval)
+		s.mutex.Unlock()
+	}
+}
+
+// SaveURL сохраняет ссылку, если выключатель замкнут.
+func (s *Storage) SaveURL(ctx context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error {
+	return s.do(func() error {
+		return s.StorageProvider.SaveURL(ctx, fullURL, shortURL, userID, schedule)
+	})
+}
+
+// BulkSaveURL сохраняет пакет ссылок, если выключатель замкнут.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	var results []models.BulkSaveResult
+	err := s.do(func() (err error) {
+		results, err = s.StorageProvider.BulkSaveURL(ctx, data, userID)
+		return err
+	})
+	return results, err
+}
+
+// GetURL возвращает полный URL, если выключатель замкнут.
+func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	var fullURL string
+	err := s.do(func() (err error) {
+		fullURL, err = s.StorageProvider.GetURL(ctx, shortURL)
+		return err
+	})
+	return fullURL, err
+}
+
+// GetURLSchedule возвращает полный URL и срок действия ссылки, если выключатель
+// замкнут. Если обёрнутое хранилище не возвращает срок действия, срок действия
+// проверяется в нём, а возвращается пустым.
+func (s *Storage) GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error) {
+	var (
+		fullURL  string
+		schedule models.Schedule
+	)
+	err := s.do(func() (err error) {
+		if reader, ok := storage.As[storage.ScheduleReader](s.StorageProvider); ok {
+			fullURL, schedule, err = reader.GetURLSchedule(ctx, shortURL)
+			return err
+		}
+		fullURL, err = s.StorageProvider.GetURL(ctx, shortURL)
+		return err
+	})
+	return fullURL, schedule, err
+}
+
+// GetShortURL возвращает короткий URL, если выключатель замкнут.
+func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
+	var shortURL string
+	err := s.do(func() (err error) {
+		shortURL, err = s.StorageProvider.GetShortURL(ctx, fullURL)
+		return err
+	})
+	return shortURL, err
+}
+
+// GetUserURLs возвращает ссылки пользователя, если выключатель замкнут.
+func (s *Storage) GetUserURLs(ctx context.Context, baseURL, userID string) ([]models.UserURLS, error) {
+	var urls []models.UserURLS
+	err := s.do(func() (err error) {
+		urls, err = s.StorageProvider.GetUserURLs(ctx, baseURL, userID)
+		return err
+	})
+	return urls, err
+}
+
+// DeleteListURL удаляет ссылки, если выключатель замкнут.
+func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListURLForDelete) error {
+	return s.do(func() error {
+		return s.StorageProvider.DeleteListURL(ctx, messages)
+	})
+}
+
+// ExpireURLs помечает удалёнными ссылки с истёкшим сроком действия, если выключатель
+// замкнут и обёрнутое хранилище это поддерживает.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	expirer, ok := storage.As[storage.Expirer](s.StorageProvider)
+	if !ok {
+		return nil, nil
+	}
+	var expired []string
+	err := s.do(func() (err error) {
+		expired, err = expirer.ExpireURLs(ctx, limit)
+		return err
+	})
+	return expired, err
+}
+
+// AddKeys добавляет ключи в пул, если выключатель замкнут. Если обёрнутое хранилище
+// не поддерживает пул ключей, возвращается storage.ErrNotSupported.
+func (s *Storage) AddKeys(ctx context.Context, keys []string) (int, error) {
+	store, ok := storage.As[storage.KeyStore](s.StorageProvider)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	var added int
+	err := s.do(func() (err error) {
+		added, err = store.AddKeys(ctx, keys)
+		return err
+	})
+	return added, err
+}
+
+// ClaimKeys забирает ключи из пула, если выключатель замкнут, поэтому пока хранилище
+// недоступно, генератор сразу создаёт короткие URL сам, не дожидаясь хранилища.
+func (s *Storage) ClaimKeys(ctx context.Context, n int) ([]string, error) {
+	store, ok := storage.As[storage.KeyStore](s.StorageProvider)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	var keys []string
+	err := s.do(func() (err error) {
+		keys, err = store.ClaimKeys(ctx, n)
+		return err
+	})
+	return keys, err
+}
+
+// ReleaseKeys возвращает ключи в пул, если выключатель замкнут.
+func (s *Storage) ReleaseKeys(ctx context.Context, keys []string) error {
+	store, ok := storage.As[storage.KeyStore](s.StorageProvider)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return s.do(func() error {
+		return store.ReleaseKeys(ctx, keys)
+	})
+}
+
+// CountFreeKeys возвращает количество ключей в пуле, если выключатель замкнут.
+func (s *Storage) CountFreeKeys(ctx context.Context) (int, error) {
+	store, ok := storage.As[storage.KeyStore](s.StorageProvider)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	var count int
+	err := s.do(func() (err error) {
+		count, err = store.CountFreeKeys(ctx)
+		return err
+	})
+	return count, err
+}
+
+// ReserveSequence резервирует порядковые номера, если выключатель замкнут. Если обёрнутое
+// хранилище не раздаёт диапазоны номеров, возвращается storage.ErrNotSupported.
+func (s *Storage) ReserveSequence(ctx context.Context, n uint64) (uint64, error) {
+	store, ok := storage.As[storage.SequenceStore](s.StorageProvider)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	var start uint64
+	err := s.do(func() (err error) {
+		start, err = store.ReserveSequence(ctx, n)
+		return err
+	})
+	return start, err
+}
+
+// SaveClicks сохраняет переходы по ссылкам, если выключатель замкнут и обёрнутое
+// хранилище это поддерживает. Переходы записываются в фоне, поэтому ошибки их
+// записи не учитываются выключателем.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	store, ok := storage.As[storage.ClickStore](s.StorageProvider)
+	if !ok {
+		return nil
+	}
+	if err := s.allow(); err != nil {
+		return err
+	}
+	return store.SaveClicks(ctx, clicks)
+}
+
+// GetLinkOwner возвращает владельца ссылки, если выключатель замкнут. Если обёрнутое
+// хранилище не хранит статистику переходов, возвращается storage.ErrNotSupported.
+func (s *Storage) GetLinkOwner(ctx context.Context, shortURL string) (string, error) {
+	reader, ok := storage.As[storage.LinkStatsReader](s.StorageProvider)
+	if !ok {
+		return "", storage.ErrNotSupported
+	}
+	var userID string
+	err := s.do(func() (err error) {
+		userID, err = reader.GetLinkOwner(ctx, shortURL)
+		return err
+	})
+	return userID, err
+}
+
+// GetLinkStats возвращает статистику переходов по ссылке, если выключатель замкнут.
+func (s *Storage) GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error) {
+	reader, ok := storage.As[storage.LinkStatsReader](s.StorageProvider)
+	if !ok {
+		return models.LinkStats{}, storage.ErrNotSupported
+	}
+	var stats models.LinkStats
+	err := s.do(func() (err error) {
+		stats, err = reader.GetLinkStats(ctx, query)
+		return err
+	})
+	return stats, err
+}
+
+// GetServiceStats возвращает статистику сервиса, если выключатель замкнут.
+func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
+	var stats models.ServiceStat
+	err := s.do(func() (err error) {
+		stats, err = s.StorageProvider.GetServiceStats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+// Ping проверяет доступность хранилища. Пока выключатель разомкнут, хранилище
+// не проверяется: это делают фоновые проверки.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.do(func() error {
+		return s.StorageProvider.Ping(ctx)
+	})
+}
+
+// Close останавливает проверки доступности и закрывает обёрнутое хранилище.
+func (s *Storage) Close() error {
+	close(s.stop)
+	s.mutex.Lock()
+	done := s.done
+	s.mutex.Unlock()
+	if done != nil {
+		<-done
+	}
+	return s.StorageProvider.Close()
+}
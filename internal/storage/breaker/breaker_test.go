@@ -0,0 +1,187 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/services/generator"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"github.com/zYoma/go-url-shortener/internal/storage/mem"
+)
+
+// flakyStorage возвращает storage.ErrUnavailable, пока down равен true.
+type flakyStorage struct {
+	storage.StorageProvider
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (s *flakyStorage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	s.calls.Add(1)
+	if s.down.Load() {
+		return "", storage.ErrUnavailable
+	}
+	return s.StorageProvider.GetURL(ctx, shortURL)
+}
+
+func (s *flakyStorage) Ping(ctx context.Context) error {
+	if s.down.Load() {
+		return storage.ErrUnavailable
+	}
+	return s.StorageProvider.Ping(ctx)
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		StorageFile:          filepath.Join(t.TempDir(), "db.json"),
+		BreakerThreshold:     2,
+		BreakerProbeInterval: 10 * time.Millisecond,
+	}
+	provider, err := mem.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+	require.NoError(t, provider.SaveURL(ctx, "https://ya.ru", "ya", "user", models.Schedule{}))
+
+	flaky := &flakyStorage{StorageProvider: provider}
+	b := New(flaky, cfg)
+	defer b.Close()
+
+	// ошибки, не связанные с доступностью, не размыкают выключатель
+	for i := 0; i < 3; i++ {
+		_, err = b.GetURL(ctx, "go")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	assert.Equal(t, storage.CircuitClosed, b.CircuitState())
+
+	// выключатель размыкается после двух ошибок недоступности подряд
+	flaky.down.Store(true)
+	for i := 0; i < 2; i++ {
+		_, err = b.GetURL(ctx, "ya")
+		assert.ErrorIs(t, err, storage.ErrUnavailable)
+	}
+	assert.Equal(t, storage.CircuitOpen, b.CircuitState())
+
+	// пока выключатель разомкнут, запросы не доходят до хранилища
+	calls := flaky.calls.Load()
+	_, err = b.GetURL(ctx, "ya")
+	var unavailable *storage.UnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.Equal(t, time.Second, unavailable.RetryAfter)
+	assert.Equal(t, calls, flaky.calls.Load())
+	assert.ErrorIs(t, b.Ping(ctx), storage.ErrUnavailable)
+
+	// выключатель замыкается после успешной проверки
+	flaky.down.Store(false)
+	assert.Eventually(t, func() bool {
+		return b.CircuitState() == storage.CircuitClosed
+	}, time.Second, 5*time.Millisecond)
+	fullURL, err := b.GetURL(ctx, "ya")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", fullURL)
+}
+
+// slowStorage - хранилище, запросы к которому не укладываются в таймаут,
+// а запись переходов завершается ошибкой недоступности.
+type slowStorage struct {
+	storage.StorageProvider
+}
+
+func (s slowStorage) GetServiceStats(context.Context) (models.ServiceStat, error) {
+	return models.ServiceStat{}, storage.ErrTimeout
+}
+
+func (s slowStorage) SaveClicks(context.Context, []models.Click) error {
+	return storage.ErrUnavailable
+}
+
+func TestBreakerIgnoresTimeouts(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		StorageFile:      filepath.Join(t.TempDir(), "db.json"),
+		BreakerThreshold: 1,
+	}
+	provider, err := mem.New(cfg)
+	require.NoError(t, err)
+	b := New(slowStorage{provider}, cfg)
+	defer b.Close()
+
+	// таймауты медленных запросов и ошибки фоновой записи переходов не размыкают выключатель
+	_, err = b.GetServiceStats(ctx)
+	assert.ErrorIs(t, err, storage.ErrTimeout)
+	assert.ErrorIs(t, b.SaveClicks(ctx, []models.Click{{ShortURL: "ya"}}), storage.ErrUnavailable)
+	assert.Equal(t, storage.CircuitClosed, b.CircuitState())
+}
+
+// downKeyStore - недоступное хранилище с пулом ключей, которое отвечает только по истечении ctx.
+type downKeyStore struct {
+	storage.StorageProvider
+	claims atomic.Int32
+}
+
+func (s *downKeyStore) ClaimKeys(ctx context.Context, _ int) ([]string, error) {
+	s.claims.Add(1)
+	<-ctx.Done()
+	return nil, storage.ErrUnavailable
+}
+
+func (s *downKeyStore) AddKeys(context.Context, []string) (int, error) {
+	return 0, storage.ErrUnavailable
+}
+
+func (s *downKeyStore) ReleaseKeys(context.Context, []string) error {
+	return storage.ErrUnavailable
+}
+
+func (s *downKeyStore) CountFreeKeys(context.Context) (int, error) {
+	return 0, storage.ErrUnavailable
+}
+
+func (s *downKeyStore) Ping(context.Context) error {
+	return storage.ErrUnavailable
+}
+
+func TestBreakerKeyPool(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		StorageFile:          filepath.Join(t.TempDir(), "db.json"),
+		BreakerThreshold:     1,
+		BreakerProbeInterval: time.Hour,
+	}
+	provider, err := mem.New(cfg)
+	require.NoError(t, err)
+	down := &downKeyStore{StorageProvider: provider}
+	b := New(down, cfg)
+	defer b.Close()
+
+	// выключатель размыкается, пока хранилище недоступно
+	_, err = b.CountFreeKeys(ctx)
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+	require.Equal(t, storage.CircuitOpen, b.CircuitState())
+
+	// пул ключей забирает ключи через выключатель, поэтому короткие URL создаются
+	// сразу, не дожидаясь недоступного хранилища
+	keyStore, ok := storage.As[storage.KeyStore](b)
+	require.True(t, ok)
+	source, err := generator.NewRandom(generator.DefaultLength, generator.DefaultAlphabet)
+	require.NoError(t, err)
+	pool, err := generator.NewPool(keyStore, source, 10)
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		key, err := pool.Generate("https://ya.ru", 0)
+		require.NoError(t, err)
+		assert.Len(t, key, generator.DefaultLength)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Zero(t, down.claims.Load())
+}
@@ -0,0 +1,60 @@
+package storage
+
+import "github.com/zYoma/go-url-shortener/internal/models"
+
+// BulkBatch помогает реализациям BulkSaveURL обработать повторы внутри пакета.
+// Сохранять нужно только элементы с индексами из Unique: первые вхождения каждого
+// полного URL. Элементы, короткий URL которых уже встретился в пакете у другого
+// полного URL, сразу помечаются как коллизии.
+type BulkBatch struct {
+	Data    []models.InsertData     // Исходный пакет.
+	Results []models.BulkSaveResult // Результаты в порядке Data.
+	Unique  []int                   // Индексы элементов Data, которые нужно сохранить.
+
+	first []int // Для каждого элемента индекс первого вхождения его полного URL.
+}
+
+// NewBulkBatch разбирает пакет data на уникальные элементы и повторы.
+func NewBulkBatch(data []models.InsertData) *BulkBatch {
+	b := &BulkBatch{
+		Data:    data,
+		Results: make([]models.BulkSaveResult, len(data)),
+		Unique:  make([]int, 0, len(data)),
+		first:   make([]int, len(data)),
+	}
+
+	byURL := make(map[string]int, len(data))
+	shortURLs := make(map[string]struct{}, len(data))
+	for i, d := range data {
+		if j, ok := byURL[d.OriginalURL]; ok {
+			b.first[i] = j
+			continue
+		}
+		byURL[d.OriginalURL] = i
+		b.first[i] = i
+
+		if _, ok := shortURLs[d.ShortURL]; ok {
+			b.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCollision}
+			continue
+		}
+		shortURLs[d.ShortURL] = struct{}{}
+		b.Unique = append(b.Unique, i)
+	}
+	return b
+}
+
+// Finish копирует результаты первых вхождений в повторы полного URL и возвращает
+// результаты всего пакета. Повтор созданной ссылки считается существующей ссылкой.
+func (b *BulkBatch) Finish() []models.BulkSaveResult {
+	for i, j := range b.first {
+		if i == j {
+			continue
+		}
+		result := b.Results[j]
+		if result.Status == models.BulkSaveCreated {
+			result.Status = models.BulkSaveExisting
+		}
+		b.Results[i] = result
+	}
+	return b.Results
+}
@@ -0,0 +1,214 @@
+// Package cache реализует кеширующую обёртку над любым хранилищем URL.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// DefaultTTL - время жизни найденной ссылки в кеше по умолчанию.
+	DefaultTTL = 5 * time.Minute
+	// DefaultNegativeTTL - время жизни отметки о ненайденной ссылке по умолчанию.
+	DefaultNegativeTTL = 30 * time.Second
+)
+
+// Storage кеширует результаты GetURL обёрнутого хранилища в ограниченном LRU-кеше.
+// Найденные и удалённые ссылки хранятся TTL, ненайденные - NegativeTTL, чтобы
+// перебор несуществующих коротких URL не нагружал хранилище. Ссылки со сроком
+// действия кешируются вместе с ним, если хранилище реализует storage.ScheduleReader. Остальные методы
+// передаются обёрнутому хранилищу без изменений.
+//
+// Сохранение ссылки сбрасывает отрицательную запись её короткого URL, удаление
+// ссылок сбрасывает их записи. Сброс записи отменяет незавершённое чтение этой
+// ссылки из хранилища, поэтому прочитанный до изменения результат не попадает в кеш. Изменения, сделанные другими экземплярами
+// приложения, сбрасываются через HandleChange, если хранилище рассылает события
+// изменений, иначе становятся видны после истечения TTL.
+//
+// Пока хранилище недоступно, переходы по найденным и удалённым ссылкам
+// обслуживаются по записям кеша, даже устаревшим.
+type Storage struct {
+	storage.StorageProvider // Обёрнутое хранилище.
+
+	entries     *lru
+	ttl         time.Duration
+	negativeTTL time.Duration
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	staleHits   atomic.Uint64
+	now         func() time.Time // Источник времени, подменяется в тестах.
+}
+
+// New оборачивает provider кешем размером cfg.CacheSize записей.
+func New(provider storage.StorageProvider, cfg *config.Config) *Storage {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	negativeTTL := cfg.CacheNegativeTTL
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultNegativeTTL
+	}
+	return &Storage{
+		StorageProvider: provider,
+		entries:         newLRU(cfg.CacheSize),
+		ttl:             ttl,
+		negativeTTL:     negativeTTL,
+		now:             time.Now,
+	}
+}
+
+// Unwrap возвращает обёрнутое хранилище.
+func (s *Storage) Unwrap() storage.StorageProvider {
+	return s.StorageProvider
+}
+
+// GetURL возвращает полный URL из кеша или из обёрнутого хранилища.
+// В кеш попадают найденные, удалённые и ненайденные ссылки; ошибки
+// хранилища не кешируются. Срок действия найденной ссылки хранится в записи
+// и проверяется при каждом чтении, поэтому ссылка открывается и истекает вовремя
+// независимо от TTL. Если хранилище недоступно, возвращается устаревшая запись
+// найденной или удалённой ссылки.
+func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	now := s.now()
+	if entry, ok := s.entries.get(shortURL, now); ok {
+		s.hits.Add(1)
+		return entry.result(now)
+	}
+	s.misses.Add(1)
+
+	// результат не попадёт в кеш, если ссылку изменят, пока она читается из хранилища
+	fill := s.entries.begin(shortURL)
+	entry, err := s.load(ctx, shortURL)
+	switch {
+	case err == nil, errors.Is(err, storage.ErrGone):
+		entry.expires = now.Add(s.ttl)
+		s.entries.add(entry, fill)
+	case errors.Is(err, storage.ErrNotActive):
+		// хранилище не вернуло срок действия, а ссылка скоро откроется, поэтому не кешируется
+		s.entries.cancel(shortURL, fill)
+	case errors.Is(err, storage.ErrNotFound):
+		entry.expires = now.Add(s.negativeTTL)
+		s.entries.add(entry, fill)
+	case errors.Is(err, storage.ErrUnavailable):
+		s.entries.cancel(shortURL, fill)
+		// ссылка могла быть создана после отметки о ненайденной ссылке,
+		// поэтому отрицательные записи не используются
+		if stale, ok := s.entries.stale(shortURL); ok && !errors.Is(stale.err, storage.ErrNotFound) {
+			s.staleHits.Add(1)
+			return stale.result(now)
+		}
+	default:
+		s.entries.cancel(shortURL, fill)
+	}
+	if err != nil {
+		return "", err
+	}
+	return entry.result(now)
+}
+
+// load читает ссылку из обёрнутого хранилища. Если хранилище возвращает срок
+// действия ссылки, он сохраняется в записи, иначе срок действия проверяет хранилище.
+func (s *Storage) load(ctx context.Context, shortURL string) (lruEntry, error) {
+	entry := lruEntry{shortURL: shortURL}
+	var err error
+	if reader, ok := storage.As[storage.ScheduleReader](s.StorageProvider); ok {
+		entry.fullURL, entry.schedule, err = reader.GetURLSchedule(ctx, shortURL)
+	} else {
+		entry.fullURL, err = s.StorageProvider.GetURL(ctx, shortURL)
+	}
+	entry.err = err
+	return entry, err
+}
+
+// SaveURL сохраняет ссылку и сбрасывает отрицательную запись её короткого URL.
+func (s *Storage) SaveURL(ctx context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error {
+	err := s.StorageProvider.SaveURL(ctx, fullURL, shortURL, userID, schedule)
+	s.entries.remove(shortURL)
+	return err
+}
+
+// BulkSaveURL сохраняет ссылки и сбрасывает отрицательные записи их коротких URL.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	results, err := s.StorageProvider.BulkSaveURL(ctx, data, userID)
+	for _, d := range data {
+		s.entries.remove(d.ShortURL)
+	}
+	return results, err
+}
+
+// DeleteListURL удаляет ссылки и сбрасывает их записи в кеше.
+func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListURLForDelete) error {
+	err := s.StorageProvider.DeleteListURL(ctx, messages)
+	// записи сбрасываются и при ошибке: часть ссылок могла быть удалена
+	s.Invalidate(messages...)
+	return err
+}
+
+// ExpireURLs помечает удалёнными ссылки с истёкшим сроком действия, если обёрнутое
+// хранилище это поддерживает, и сбрасывает их записи в кеше.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	expirer, ok := storage.As[storage.Expirer](s.StorageProvider)
+	if !ok {
+		return nil, nil
+	}
+	expired, err := expirer.ExpireURLs(ctx, limit)
+	for _, shortURL := range expired {
+		s.entries.remove(shortURL)
+	}
+	return expired, err
+}
+
+// Invalidate сбрасывает записи кеша для коротких URL из messages.
+func (s *Storage) Invalidate(messages ...models.UserListURLForDelete) {
+	for _, message := range messages {
+		for _, shortURL := range message.URLS {
+			s.entries.remove(shortURL)
+		}
+	}
+}
+
+// HandleChange сбрасывает записи кеша по событию изменения ссылок, полученному
+// от хранилища. Событие storage.ChangeReset сбрасывает весь кеш.
+func (s *Storage) HandleChange(event storage.ChangeEvent) {
+	if event.Op == storage.ChangeReset {
+		s.Purge()
+		return
+	}
+	for _, shortURL := range event.ShortURLs {
+		s.entries.remove(shortURL)
+	}
+}
+
+// Purge сбрасывает все записи кеша.
+func (s *Storage) Purge() {
+	s.entries.purge()
+}
+
+// GetServiceStats возвращает статистику обёрнутого хранилища, дополненную статистикой кеша.
+func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
+	stats, err := s.StorageProvider.GetServiceStats(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.Cache = s.Stats()
+	return stats, nil
+}
+
+// Stats возвращает счётчики попаданий и промахов кеша.
+func (s *Storage) Stats() *models.CacheStat {
+	size, evictions := s.entries.stats()
+	return &models.CacheStat{
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Stale:     s.staleHits.Load(),
+		Evictions: evictions,
+		Size:      size,
+	}
+}
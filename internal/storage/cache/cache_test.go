@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"github.com/zYoma/go-url-shortener/internal/storage/mem"
+)
+
+func newTestCache(t *testing.T, size int) (*Storage, *time.Time) {
+	cfg := &config.Config{StorageFile: filepath.Join(t.TempDir(), "db.json"), CacheSize: size}
+	provider, err := mem.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, provider.Init())
+
+	now := time.Now()
+	c := New(provider, cfg)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCacheGetURL(t *testing.T) {
+	ctx := context.Background()
+	c, now := newTestCache(t, 10)
+
+	require.NoError(t, c.SaveURL(ctx, "https://ya.ru", "ya", "user", models.Schedule{}))
+
+	for i := 0; i < 3; i++ {
+		fullURL, err := c.GetURL(ctx, "ya")
+		require.NoError(t, err)
+		assert.Equal(t, "https://ya.ru", fullURL)
+	}
+	assert.Equal(t, &models.CacheStat{Hits: 2, Misses: 1, Size: 1}, c.Stats())
+
+	// отрицательная запись сбрасывается при сохранении ссылки
+	_, err := c.GetURL(ctx, "go")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = c.GetURL(ctx, "go")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	require.NoError(t, c.SaveURL(ctx, "https://go.dev", "go", "user", models.Schedule{}))
+	fullURL, err := c.GetURL(ctx, "go")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev", fullURL)
+
+	// удаление сбрасывает запись
+	require.NoError(t, c.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"ya"}}}))
+	_, err = c.GetURL(ctx, "ya")
+	assert.ErrorIs(t, err, storage.ErrGone)
+
+	// после истечения TTL запись читается из хранилища
+	hits := c.Stats().Hits
+	*now = now.Add(DefaultTTL)
+	_, err = c.GetURL(ctx, "go")
+	require.NoError(t, err)
+	assert.Equal(t, hits, c.Stats().Hits)
+
+	stats, err := c.GetServiceStats(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, stats.Cache)
+	assert.Equal(t, 2, stats.URLS)
+}
+
+func TestCacheSchedule(t *testing.T) {
+	ctx := context.Background()
+	c, now := newTestCache(t, 10)
+
+	schedule := models.Schedule{ActiveFrom: now.Add(time.Minute), ExpiresAt: now.Add(2 * time.Minute)}
+	require.NoError(t, c.SaveURL(ctx, "https://ya.ru", "ya", "user", schedule))
+
+	_, err := c.GetURL(ctx, "ya")
+	assert.ErrorIs(t, err, storage.ErrNotActive)
+
+	// ссылка открывается вовремя, хотя запись ещё в кеше
+	*now = now.Add(time.Minute)
+	fullURL, err := c.GetURL(ctx, "ya")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", fullURL)
+
+	// и вовремя истекает
+	*now = now.Add(time.Minute)
+	_, err = c.GetURL(ctx, "ya")
+	assert.ErrorIs(t, err, storage.ErrExpired)
+	assert.Equal(t, &models.CacheStat{Hits: 2, Misses: 1, Size: 1}, c.Stats())
+}
+
+// unavailableStorage имитирует недоступное хранилище.
+type unavailableStorage struct {
+	storage.StorageProvider
+}
+
+func (s unavailableStorage) GetURL(context.Context, string) (string, error) {
+	return "", storage.ErrUnavailable
+}
+
+func TestCacheStale(t *testing.T) {
+	ctx := context.Background()
+	c, now := newTestCache(t, 10)
+
+	require.NoError(t, c.SaveURL(ctx, "https://ya.ru", "ya", "user", models.Schedule{}))
+	_, err := c.GetURL(ctx, "ya")
+	require.NoError(t, err)
+	_, err = c.GetURL(ctx, "go")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// пока хранилище недоступно, переход выполняется по устаревшей записи
+	c.StorageProvider = unavailableStorage{c.StorageProvider}
+	*now = now.Add(DefaultTTL)
+	fullURL, err := c.GetURL(ctx, "ya")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", fullURL)
+	assert.Equal(t, uint64(1), c.Stats().Stale)
+
+	// отрицательные записи не используются
+	_, err = c.GetURL(ctx, "go")
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+
+	// неизвестные короткие URL не занимают место в кеше и не вытесняют записи
+	_, err = c.GetURL(ctx, "unknown")
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+	assert.Equal(t, 2, c.Stats().Size)
+}
+
+// pausedStorage приостанавливает GetURL после чтения ссылки из хранилища.
+type pausedStorage struct {
+	storage.StorageProvider
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s pausedStorage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	fullURL, err := s.StorageProvider.GetURL(ctx, shortURL)
+	s.read <- struct{}{}
+	<-s.release
+	return fullURL, err
+}
+
+func TestCacheDeleteDuringRead(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, 10)
+	require.NoError(t, c.SaveURL(ctx, "https://ya.ru", "ya", "user", models.Schedule{}))
+
+	inner := c.StorageProvider
+	c.StorageProvider = pausedStorage{inner, make(chan struct{}), make(chan struct{})}
+	paused := c.StorageProvider.(pausedStorage)
+
+	// ссылка удаляется, пока её прочитанный до удаления результат ещё не попал в кеш
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fullURL, err := c.GetURL(ctx, "ya")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://ya.ru", fullURL)
+	}()
+	<-paused.read
+	c.StorageProvider = inner
+	require.NoError(t, c.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"ya"}}}))
+	close(paused.release)
+	<-done
+
+	// устаревший результат не закеширован
+	_, err := c.GetURL(ctx, "ya")
+	assert.ErrorIs(t, err, storage.ErrGone)
+}
+
+func TestCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, 2)
+
+	for _, code := range []string{"a", "b", "a", "c"} {
+		_, err := c.GetURL(ctx, code)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+
+	// "b" использовалась давнее всех и вытеснена
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	_, ok := c.entries.get("b", time.Now())
+	assert.False(t, ok)
+	_, ok = c.entries.get("a", time.Now())
+	assert.True(t, ok)
+}
+
+func TestCacheHandleChange(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, 10)
+
+	for _, code := range []string{"a", "b", "c"} {
+		_, err := c.GetURL(ctx, code)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+
+	c.HandleChange(storage.ChangeEvent{Op: storage.ChangeDelete, ShortURLs: []string{"a", "b"}})
+	assert.Equal(t, 1, c.Stats().Size)
+
+	c.HandleChange(storage.ChangeEvent{Op: storage.ChangeReset})
+	assert.Equal(t, 0, c.Stats().Size)
+}
+
+func TestAs(t *testing.T) {
+	c, _ := newTestCache(t, 1)
+
+	keyStore, ok := storage.As[storage.KeyStore](c)
+	assert.True(t, ok)
+	assert.Equal(t, c.Unwrap(), keyStore)
+}
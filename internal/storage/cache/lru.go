@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// lruEntry - запись кеша: результат GetURL для короткого URL.
+type lruEntry struct {
+	shortURL string          // Короткий URL, ключ записи.
+	fullURL  string          // Полный URL, если ссылка найдена.
+	schedule models.Schedule // Срок действия ссылки, проверяется при каждом чтении записи.
+	err      error           // storage.ErrNotFound или storage.ErrGone для отрицательных записей.
+	expires  time.Time       // Момент, после которого запись устаревает.
+	fill     uint64          // Номер незавершённого чтения из хранилища, 0 если его нет.
+	reserved bool            // Признак записи без результата, созданной только для чтения из хранилища.
+}
+
+// result возвращает результат GetURL для записи с учётом срока действия ссылки в момент now.
+func (e lruEntry) result(now time.Time) (string, error) {
+	if e.err != nil {
+		return "", e.err
+	}
+	if err := storage.CheckSchedule(e.schedule, now); err != nil {
+		return "", err
+	}
+	return e.fullURL, nil
+}
+
+// lru - ограниченный по размеру кеш с вытеснением давно не использованных записей.
+type lru struct {
+	mutex     sync.Mutex
+	capacity  int
+	items     map[string]*list.Element
+	order     *list.List // Записи от недавно использованных к давно не использованным.
+	evictions uint64
+	fills     uint64 // Номер последнего начатого чтения из хранилища.
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get возвращает актуальную запись и помечает её как недавно использованную.
+// Устаревшая запись остаётся в кеше до вытеснения или замены, чтобы её можно
+// было получить через stale, пока хранилище недоступно.
+func (c *lru) get(shortURL string, now time.Time) (lruEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[shortURL]
+	if !ok {
+		return lruEntry{}, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.reserved || !now.Before(entry.expires) {
+		return lruEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *entry, true
+}
+
+// stale возвращает запись независимо от того, устарела ли она.
+func (c *lru) stale(shortURL string) (lruEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[shortURL]
+	if !ok || elem.Value.(*lruEntry).reserved {
+		return lruEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*lruEntry), true
+}
+
+// begin отмечает начало чтения короткого URL из хранилища и возвращает номер
+// чтения для add или cancel. Если записи нет, добавляется пустая запись, которую не видят
+// get и stale. Сброс записи через remove или purge до вызова add отменяет чтение,
+// чтобы результат, прочитанный до изменения ссылки, не попал в кеш.
+func (c *lru) begin(shortURL string) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.fills++
+	if elem, ok := c.items[shortURL]; ok {
+		// устаревшая запись остаётся доступна через stale до завершения чтения
+		elem.Value.(*lruEntry).fill = c.fills
+		return c.fills
+	}
+	c.push(&lruEntry{shortURL: shortURL, fill: c.fills, reserved: true})
+	return c.fills
+}
+
+// add сохраняет результат чтения с номером fill, начатого вызовом begin. Если запись
+// была сброшена или чтение начато заново, результат отбрасывается.
+func (c *lru) add(entry lruEntry, fill uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[entry.shortURL]
+	if !ok || elem.Value.(*lruEntry).fill != fill {
+		return
+	}
+	*elem.Value.(*lruEntry) = entry
+	c.order.MoveToFront(elem)
+}
+
+// cancel завершает чтение с номером fill, результат которого не кешируется. Пустая
+// запись, добавленная begin, удаляется, чтобы не занимать место в кеше.
+func (c *lru) cancel(shortURL string, fill uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[shortURL]
+	if !ok || elem.Value.(*lruEntry).fill != fill {
+		return
+	}
+	if elem.Value.(*lruEntry).reserved {
+		c.removeElement(elem)
+		return
+	}
+	elem.Value.(*lruEntry).fill = 0
+}
+
+// push добавляет новую запись, вытесняя самые давно использованные при переполнении.
+func (c *lru) push(entry *lruEntry) {
+	c.items[entry.shortURL] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+// remove удаляет запись.
+func (c *lru) remove(shortURL string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.items[shortURL]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// purge удаляет все записи.
+func (c *lru) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[string]*list.Element, c.capacity)
+	c.order.Init()
+}
+
+// stats возвращает количество записей и вытеснений.
+func (c *lru) stats() (int, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len(), c.evictions
+}
+
+func (c *lru) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry).shortURL)
+}
@@ -0,0 +1,31 @@
+package storage
+
+import "sync"
+
+// ChangeOp описывает вид изменения ссылок.
+type ChangeOp string
+
+// Виды изменений ссылок.
+const (
+	// ChangeDelete - ссылки удалены пользователем.
+	ChangeDelete ChangeOp = "delete"
+	// ChangeExpire - у ссылок истёк срок действия.
+	ChangeExpire ChangeOp = "expire"
+	// ChangeReset - события могли быть пропущены, например при потере соединения,
+	// поэтому все закешированные ссылки нужно считать устаревшими.
+	ChangeReset ChangeOp = "reset"
+)
+
+// ChangeEvent описывает изменение ссылок, сделанное одним из экземпляров приложения.
+type ChangeEvent struct {
+	Op        ChangeOp `json:"op"`         // Вид изменения.
+	ShortURLs []string `json:"short_urls"` // Изменённые короткие URL, пустой для ChangeReset.
+}
+
+// ChangeListener реализуют хранилища, которые рассылают всем экземплярам
+// приложения события об изменении ссылок.
+type ChangeListener interface {
+	// ListenChanges вызывает handle для каждого события, пока не будет закрыт stopChan.
+	// После восстановления потерянного соединения вызывает handle с событием ChangeReset.
+	ListenChanges(wg *sync.WaitGroup, stopChan chan int64, handle func(ChangeEvent))
+}
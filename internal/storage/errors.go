@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+)
+
+// Ошибки, которые возвращают все реализации хранилища. Обработчики HTTP и gRPC
+// сопоставляют их с кодами ответа, не завися от конкретного провайдера.
+var (
+	// ErrNotFound описывает ошибку, возникающую, когда URL не найден в хранилище.
+	ErrNotFound = errors.New("url not found")
+	// ErrConflict описывает ошибку конфликта при попытке сохранить URL, который уже существует.
+	ErrConflict = errors.New("url already exist")
+	// ErrShortURLCollision описывает ошибку сохранения ссылки с уже занятым коротким URL.
+	// В отличие от ErrConflict, означает, что нужно сгенерировать другой короткий URL.
+	ErrShortURLCollision = errors.New("short url already exist")
+	// ErrGone описывает ошибку, возникающую при попытке доступа к удалённому URL.
+	ErrGone = errors.New("URL was deleted")
+	// ErrQuotaExceeded описывает ошибку превышения квоты хранилища.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrUnavailable описывает ошибку временной недоступности хранилища.
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrExpired описывает ошибку доступа к ссылке с истёкшим сроком действия.
+	// Удовлетворяет errors.Is(err, ErrGone).
+	ErrExpired = fmt.Errorf("%w: link expired", ErrGone)
+	// ErrNotActive описывает ошибку доступа к ссылке, которая ещё не открылась.
+	// Удовлетворяет errors.Is(err, ErrNotFound).
+	ErrNotActive = fmt.Errorf("%w: link is not active yet", ErrNotFound)
+	// ErrTimeout описывает ошибку запроса, который не уложился в отведённое время, хотя
+	// соединение с хранилищем не потеряно. Удовлетворяет errors.Is(err, ErrUnavailable).
+	ErrTimeout = fmt.Errorf("%w: request timed out", ErrUnavailable)
+	// ErrNotSupported описывает ошибку вызова операции, которую хранилище не поддерживает.
+	ErrNotSupported = errors.New("operation is not supported by storage")
+)
+
+// CheckSchedule проверяет, открывается ли ссылка со сроком действия schedule
+// в момент now. Возвращает ErrNotActive до начала срока действия и ErrExpired
+// после его окончания.
+func CheckSchedule(schedule models.Schedule, now time.Time) error {
+	if !schedule.ActiveFrom.IsZero() && now.Before(schedule.ActiveFrom) {
+		return ErrNotActive
+	}
+	if !schedule.ExpiresAt.IsZero() && !now.Before(schedule.ExpiresAt) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// ConflictError описывает конфликт при сохранении URL и содержит короткий URL
+// уже существующей ссылки. Ошибка удовлетворяет errors.Is(err, ErrConflict).
+type ConflictError struct {
+	ShortURL string // Короткий URL существующей ссылки.
+}
+
+// Error возвращает текстовое описание ошибки.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConflict, e.ShortURL)
+}
+
+// Is позволяет сравнивать ошибку с ErrConflict через errors.Is.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// UnavailableError описывает временную недоступность хранилища и содержит время,
+// через которое запрос стоит повторить. Ошибка удовлетворяет errors.Is(err, ErrUnavailable).
+type UnavailableError struct {
+	RetryAfter time.Duration // Через сколько хранилище будет проверено снова.
+}
+
+// Error возвращает текстовое описание ошибки.
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrUnavailable, e.RetryAfter)
+}
+
+// Is позволяет сравнивать ошибку с ErrUnavailable через errors.Is.
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
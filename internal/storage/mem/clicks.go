@@ -0,0 +1,200 @@
+package mem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// clicksSuffix - суффикс файла переходов по ссылкам, который лежит рядом с файлом журнала.
+const clicksSuffix = ".clicks"
+
+// clickLog дописывает переходы по ссылкам в отдельный файл в формате JSONL.
+// Переходы не хранятся в памяти: статистика ссылки подсчитывается чтением файла,
+// поэтому память не растёт вместе с количеством переходов.
+// Собственный мьютекс не даёт записи переходов задерживать изменения ссылок.
+type clickLog struct {
+	mutex sync.RWMutex
+	path  string   // Путь к файлу переходов.
+	file  *os.File // Файл переходов, открытый на дозапись.
+}
+
+// open открывает файл переходов path на дозапись.
+func (l *clickLog) open(path string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось открыть файл переходов: %s", err)
+		return ErrOpenFile
+	}
+
+	// недописанная последняя строка не должна склеиться со следующей записью
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err = file.Write([]byte("\n")); err != nil {
+				file.Close()
+				return ErrWriteFile
+			}
+		}
+	}
+
+	l.path = path
+	l.file = file
+	return nil
+}
+
+// save дописывает переходы в файл одним вызовом записи.
+func (l *clickLog) save(clicks []models.Click) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, click := range clicks {
+		if err := encoder.Encode(click); err != nil {
+			return err
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return ErrSaveFile
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось записать переходы: %s", err)
+		return ErrSaveFile
+	}
+	return nil
+}
+
+// scan вызывает fn для каждого перехода по короткому URL shortURL из файла.
+// Читаются только записи, полностью записанные к началу чтения. Повреждённые
+// строки, например недописанная при аварийном завершении строка, пропускаются.
+func (l *clickLog) scan(shortURL string, fn func(models.Click)) error {
+	l.mutex.RLock()
+	if l.file == nil {
+		l.mutex.RUnlock()
+		return ErrOpenFile
+	}
+	info, err := l.file.Stat()
+	l.mutex.RUnlock()
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить информацию о файле переходов: %s", err)
+		return ErrInfoFile
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось открыть файл переходов: %s", err)
+		return ErrOpenFile
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(io.LimitReader(file, info.Size()))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var click models.Click
+		if err := json.Unmarshal(line, &click); err != nil || click.ShortURL != shortURL {
+			continue
+		}
+		fn(click)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка чтения файла переходов: %s", err)
+		return ErrDecodeFile
+	}
+	return nil
+}
+
+// close закрывает файл переходов.
+func (l *clickLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// SaveClicks сохраняет переходы по ссылкам в файл переходов рядом с журналом.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	return s.clickLog.save(clicks)
+}
+
+// clicksPath возвращает путь к файлу переходов.
+func (s *Storage) clicksPath() string {
+	return s.storagePath + clicksSuffix
+}
+
+// GetLinkOwner возвращает владельца ссылки, в том числе удалённой.
+func (s *Storage) GetLinkOwner(ctx context.Context, shortURL string) (string, error) {
+	entry, ok := s.db.Load(shortURL)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return entry.UserID, nil
+}
+
+// GetLinkStats подсчитывает статистику переходов по ссылке, читая файл переходов.
+func (s *Storage) GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error) {
+	stats := models.LinkStats{
+		ShortURL: query.ShortURL,
+		From:     query.From,
+		To:       query.To,
+		Interval: query.Interval,
+	}
+	step := query.Interval.Duration()
+	timeline := make(map[time.Time]int)
+	visitors := make(map[[2]string]struct{})
+	referrers := make(map[string]int)
+	userAgents := make(map[string]int)
+	countries := make(map[string]int)
+
+	err := s.clickLog.scan(query.ShortURL, func(click models.Click) {
+		if click.Time.Before(query.From) || !click.Time.Before(query.To) {
+			return
+		}
+		stats.Clicks++
+		timeline[click.Time.UTC().Truncate(step)]++
+		visitors[[2]string{click.IPPrefix, click.UserAgent}] = struct{}{}
+		referrers[click.Referrer]++
+		userAgents[click.UserAgent]++
+		countries[click.Country]++
+	})
+	if err != nil {
+		return models.LinkStats{}, err
+	}
+
+	stats.Visitors = len(visitors)
+	for bucket, clicks := range timeline {
+		stats.Timeline = append(stats.Timeline, models.ClickBucket{Time: bucket, Clicks: clicks})
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool {
+		return stats.Timeline[i].Time.Before(stats.Timeline[j].Time)
+	})
+	stats.Referrers = storage.CountClickSources(referrers, query.Top)
+	stats.UserAgents = storage.CountClickSources(userAgents, query.Top)
+	stats.Countries = storage.CountClickSources(countries, query.Top)
+	return stats, nil
+}
@@ -0,0 +1,58 @@
+package mem
+
+import "context"
+
+// Пул свободных коротких URL хранится только в памяти и не попадает в журнал:
+// после перезапуска он заполняется заново.
+
+// AddKeys добавляет ключи в пул, пропуская ключи, которые уже есть в пуле
+// или заняты сохранёнными ссылками.
+func (s *Storage) AddKeys(ctx context.Context, keys []string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	added := 0
+	for _, key := range keys {
+		if _, ok := s.db.Load(key); ok {
+			continue
+		}
+		if _, ok := s.keySet[key]; ok {
+			continue
+		}
+		s.keySet[key] = struct{}{}
+		s.freeKeys = append(s.freeKeys, key)
+		added++
+	}
+	return added, nil
+}
+
+// ClaimKeys забирает из пула не более n самых старых ключей.
+func (s *Storage) ClaimKeys(ctx context.Context, n int) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n = min(n, len(s.freeKeys))
+	keys := make([]string, n)
+	copy(keys, s.freeKeys)
+	// Оставшиеся ключи копируются в новый срез, чтобы выданные ключи не
+	// удерживались в памяти старым массивом.
+	s.freeKeys = append([]string(nil), s.freeKeys[n:]...)
+	for _, key := range keys {
+		delete(s.keySet, key)
+	}
+	return keys, nil
+}
+
+// ReleaseKeys возвращает в пул неиспользованные ключи.
+func (s *Storage) ReleaseKeys(ctx context.Context, keys []string) error {
+	_, err := s.AddKeys(ctx, keys)
+	return err
+}
+
+// CountFreeKeys возвращает количество ключей в пуле.
+func (s *Storage) CountFreeKeys(ctx context.Context) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.freeKeys), nil
+}
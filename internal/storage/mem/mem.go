@@ -1,11 +1,18 @@
 package mem
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/zYoma/go-url-shortener/internal/config"
 	"github.com/zYoma/go-url-shortener/internal/logger"
@@ -15,8 +22,6 @@ import (
 
 // возможные ошибки пакета
 var (
-	// ErrURLNotFound описывает ошибку, возникающую, когда URL не может быть найден в хранилище.
-	ErrURLNotFound = errors.New("url not found")
 	// ErrOpenFile описывает ошибку открытия файла хранилища.
 	ErrOpenFile = errors.New("failed to open file")
 	// ErrWriteFile описывает ошибку записи в файл хранилища.
@@ -29,80 +34,340 @@ var (
 	ErrSaveFile = errors.New("save file error")
 )
 
+// операции, записываемые в журнал хранилища
+const (
+	opSave   = "save"   // сохранение соответствия короткого и полного URL
+	opDelete = "delete" // пометка URL пользователя как удалённого
+)
+
+// compactMinRecords - минимальное количество записей в журнале, после которого
+// имеет смысл запускать компактизацию.
+const compactMinRecords = 1000
+
+// fileRecord описывает одну строку журнала хранилища в формате JSONL.
+type fileRecord struct {
+	Op          string     `json:"op"`                     // Тип операции.
+	ShortURL    string     `json:"short_url"`              // Короткий URL.
+	OriginalURL string     `json:"original_url,omitempty"` // Исходный URL.
+	UserID      string     `json:"user_id,omitempty"`      // Идентификатор владельца ссылки.
+	IsDeleted   bool       `json:"is_deleted,omitempty"`   // Признак удаления ссылки.
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`  // Момент, с которого ссылка открывается.
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // Момент, начиная с которого ссылка больше не открывается.
+}
+
+// newSaveRecord создаёт запись журнала о сохранении ссылки.
+func newSaveRecord(shortURL, fullURL, userID string, schedule models.Schedule) fileRecord {
+	return fileRecord{
+		Op:          opSave,
+		ShortURL:    shortURL,
+		OriginalURL: fullURL,
+		UserID:      userID,
+		ActiveFrom:  timeOrNil(schedule.ActiveFrom),
+		ExpiresAt:   timeOrNil(schedule.ExpiresAt),
+	}
+}
+
+// schedule возвращает срок действия ссылки из записи журнала.
+func (r fileRecord) schedule() models.Schedule {
+	return models.NewSchedule(r.ActiveFrom, r.ExpiresAt)
+}
+
+// timeOrNil возвращает nil для нулевого времени, чтобы оно не попадало в журнал.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// urlEntry описывает сохранённую ссылку вместе с её владельцем и признаком удаления.
+type urlEntry struct {
+	OriginalURL string // Исходный URL.
+	UserID      string // Идентификатор владельца ссылки.
+	IsDeleted   bool   // Признак удаления ссылки.
+	models.Schedule
+}
+
 // Storage реализует интерфейс StorageProvider для хранения URL в памяти
 // и поддерживает сохранение данных в файле.
+//
+// Файл хранилища представляет собой журнал в формате JSONL, в который
+// только дописываются новые записи. При инициализации журнал проигрывается
+// заново, а фоновая компактизация периодически заменяет его снимком текущего
+// состояния через запись во временный файл и атомарное переименование.
+//
+// Данные в памяти хранятся в сегментированных картах. Чтения берут блокировку
+// только своего сегмента, поэтому переходы по коротким ссылкам не ждут записи
+// в файл. Изменения выполняются последовательно под mutex: сначала запись
+// дописывается в журнал, затем применяется к картам, так что порядок записей
+// в журнале совпадает с порядком изменений в памяти.
 type Storage struct {
-	db          map[string]string // Карта для хранения соответствия коротких и полных URL.
-	storagePath string            // Путь к файлу для сохранения данных хранилища.
-	mutex       sync.Mutex        // Мьютекс для обеспечения потокобезопасности операций с хранилищем.
+	db          *shardedMap[urlEntry] // Соответствие коротких URL и ссылок.
+	byURL       *shardedMap[string]   // Обратный индекс неудалённых ссылок: полный URL -> короткий URL.
+	userURLs    *shardedMap[[]string] // Короткие URL каждого пользователя в порядке создания.
+	urlCount    atomic.Int64          // Количество сохранённых ссылок.
+	storagePath string                // Путь к файлу для сохранения данных хранилища.
+	mutex       sync.Mutex            // Мьютекс, упорядочивающий изменения хранилища и запись в журнал.
+
+	file       *os.File       // Файл журнала, открытый на дозапись.
+	logRecords int            // Количество записей в журнале.
+	compacting bool           // Признак выполняющейся компактизации.
+	pending    []fileRecord   // Записи, добавленные в журнал во время компактизации.
+	compactWG  sync.WaitGroup // Ожидание завершения фоновой компактизации.
+
+	freeKeys []string            // Пул свободных коротких URL в порядке добавления.
+	keySet   map[string]struct{} // Множество ключей из freeKeys.
+
+	clickLog clickLog // Переходы по ссылкам, хранятся в отдельном файле.
 }
 
 // New создаёт экземпляр хранилища с указанным путём файла конфигурации.
 func New(cfg *config.Config) (storage.StorageProvider, error) {
-	db := make(map[string]string)
-	return &Storage{db: db, storagePath: cfg.StorageFile}, nil
+	return &Storage{
+		db:          newShardedMap[urlEntry](),
+		byURL:       newShardedMap[string](),
+		userURLs:    newShardedMap[[]string](),
+		storagePath: cfg.StorageFile,
+		keySet:      make(map[string]struct{}),
+	}, nil
 }
 
 // SaveURL сохраняет соответствие полного URL и его короткой версии в хранилище.
-func (s *Storage) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string) error {
+// Если полный URL уже сохранён в неудалённой ссылке, возвращает storage.ConflictError
+// с её коротким URL, а если занят короткий URL - storage.ErrShortURLCollision.
+// Ссылка с тем же полным URL и истёкшим сроком действия помечается удалённой.
+func (s *Storage) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string, schedule models.Schedule) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.db[shortURL] = fullURL
-
-	if err := s.saveFile(); err != nil {
-		return ErrSaveFile
+	existing, released := s.liveLink(fullURL, time.Now())
+	if existing != "" {
+		return &storage.ConflictError{ShortURL: existing}
+	}
+	if _, ok := s.db.Load(shortURL); ok {
+		return storage.ErrShortURLCollision
 	}
 
-	return nil
+	return s.commit(append(released, newSaveRecord(shortURL, fullURL, userID, schedule))...)
 }
 
-// GetURL from db.
-func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
-	fullURL, ok := s.db[shortURL]
+// liveLink возвращает короткий URL неудалённой ссылки с полным URL fullURL. Если срок
+// действия такой ссылки истёк к моменту now, возвращается пустой короткий URL и запись,
+// помечающая ссылку удалённой, чтобы полный URL освободился, не дожидаясь ExpireURLs.
+// Должен вызываться при захваченном мьютексе.
+func (s *Storage) liveLink(fullURL string, now time.Time) (string, []fileRecord) {
+	shortURL, ok := s.byURL.Load(fullURL)
 	if !ok {
-		return "", ErrURLNotFound
+		return "", nil
+	}
+	entry, _ := s.db.Load(shortURL)
+	if entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt) {
+		return shortURL, nil
 	}
+	return "", []fileRecord{{Op: opDelete, ShortURL: shortURL, UserID: entry.UserID}}
+}
 
+// GetURL возвращает полный URL по короткому. Блокирует только сегмент,
+// в котором хранится короткий URL. Срок действия ссылки проверяется при каждом
+// переходе, поэтому истёкшая ссылка не открывается и до пометки удалённой.
+func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	fullURL, schedule, err := s.GetURLSchedule(ctx, shortURL)
+	if err != nil {
+		return "", err
+	}
+	if err = storage.CheckSchedule(schedule, time.Now()); err != nil {
+		return "", err
+	}
 	return fullURL, nil
 }
 
-// GetShortURL возвращает короткую версию URL по его полному адресу.
-func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
-	for shortURL, u := range s.db {
-		if u == fullURL {
-			return shortURL, nil
-		}
+// GetURLSchedule возвращает полный URL и срок действия ссылки.
+func (s *Storage) GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error) {
+	entry, ok := s.db.Load(shortURL)
+	if !ok {
+		return "", models.Schedule{}, storage.ErrNotFound
 	}
+	if entry.IsDeleted {
+		return "", models.Schedule{}, storage.ErrGone
+	}
+	return entry.OriginalURL, entry.Schedule, nil
+}
 
-	return "", ErrURLNotFound
+// GetShortURL возвращает короткую версию URL неудалённой ссылки по его полному адресу
+// из обратного индекса.
+func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
+	shortURL, ok := s.byURL.Load(fullURL)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
 
+	return shortURL, nil
 }
 
-// Init инициализирует хранилище, загружая данные из файла, если он существует.
+// Init инициализирует хранилище, проигрывая журнал из файла, если он существует.
+// Недописанная последняя строка журнала, оставшаяся после аварийного завершения,
+// отбрасывается. Файл в старом формате (единый JSON-объект) также поддерживается
+// и сразу же переписывается в формате журнала. Переходы по ссылкам загружаются
+// из отдельного файла рядом с журналом.
 func (s *Storage) Init() error {
-	// открываем файл для чтения
-	file, err := os.OpenFile(s.storagePath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err := s.clickLog.open(s.clicksPath()); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// временный файл мог остаться от прерванной компактизации
+	if err := os.Remove(s.tmpPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Log.Sugar().Errorf("Не удалось удалить временный файл: %s", err)
+	}
+
+	// открываем файл для чтения и дозаписи
+	file, err := os.OpenFile(s.storagePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		logger.Log.Sugar().Errorf("Не удалось открыть файл: %s", err)
 		return ErrOpenFile
 	}
-	defer file.Close()
 
-	// Получаем информацию о файле для проверки размера
-	fileInfo, err := file.Stat()
+	rewrite, err := s.replay(file)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Ошибка получения информации о файле: %s", err)
-		return ErrInfoFile
+		file.Close()
+		return err
+	}
+	s.file = file
+
+	if rewrite {
+		// переписываем файл старого формата или с повреждёнными записями в виде журнала
+		s.startCompaction()
+		return nil
 	}
+	s.maybeCompact()
+
+	return nil
+}
+
+// replay последовательно применяет записи журнала к хранилищу. Недописанная
+// последняя запись отрезается, повреждённые записи в середине журнала пропускаются.
+// Возвращает признак того, что файл нужно переписать: он записан в старом формате
+// или содержит повреждённые записи.
+func (s *Storage) replay(file *os.File) (bool, error) {
+	reader := bufio.NewReader(file)
+
+	var (
+		offset  int64
+		rewrite bool
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// последняя строка не дописана до конца
+				return rewrite, s.truncateTail(file, offset)
+			}
+			return rewrite, nil
+		}
+		if err != nil {
+			logger.Log.Sugar().Errorf("Ошибка чтения файла: %s", err)
+			return false, ErrDecodeFile
+		}
 
-	if fileInfo.Size() > 0 {
-		if err := json.NewDecoder(file).Decode(&s.db); err != nil {
-			logger.Log.Sugar().Errorf("Ошибка декодирования JSON: %s", err)
-			return ErrDecodeFile
+		lineStart := offset
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
 		}
+
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil || record.Op == "" {
+			// файл старого формата состоит из одного JSON-объекта
+			var legacyDB map[string]string
+			if lineStart == 0 && json.Unmarshal(line, &legacyDB) == nil {
+				for shortURL, fullURL := range legacyDB {
+					s.apply(fileRecord{Op: opSave, ShortURL: shortURL, OriginalURL: fullURL})
+				}
+				s.logRecords = len(legacyDB)
+				rewrite = true
+				continue
+			}
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				// повреждена последняя строка, отбрасываем её
+				return rewrite, s.truncateTail(file, lineStart)
+			}
+			// повреждённая запись теряется, но остальные данные остаются доступны
+			logger.Log.Sugar().Warnf("Пропущена повреждённая запись журнала на смещении %d: %v", lineStart, err)
+			rewrite = true
+			continue
+		}
+
+		s.apply(record)
+		s.logRecords++
 	}
+}
 
+// truncateTail обрезает файл журнала до последней целой записи.
+func (s *Storage) truncateTail(file *os.File, size int64) error {
+	logger.Log.Sugar().Warnf("Журнал хранилища обрезан до %d байт: последняя запись повреждена", size)
+	if err := file.Truncate(size); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось обрезать файл: %s", err)
+		return ErrWriteFile
+	}
+	return nil
+}
+
+// apply применяет запись журнала к данным в памяти. Повторное применение
+// той же записи не меняет состояние, поэтому журнал можно проигрывать заново.
+// Должен вызываться при захваченном мьютексе или до начала работы хранилища.
+func (s *Storage) apply(record fileRecord) {
+	switch record.Op {
+	case opSave:
+		prev, ok := s.db.Load(record.ShortURL)
+		if ok {
+			if existing, _ := s.byURL.Load(prev.OriginalURL); existing == record.ShortURL {
+				s.byURL.Delete(prev.OriginalURL)
+			}
+		} else {
+			s.urlCount.Add(1)
+		}
+		if !ok || prev.UserID != record.UserID {
+			// срез читателей не меняется: append пишет только за пределами их длины
+			urls, _ := s.userURLs.Load(record.UserID)
+			s.userURLs.Store(record.UserID, append(urls, record.ShortURL))
+		}
+		if !record.IsDeleted {
+			s.byURL.Store(record.OriginalURL, record.ShortURL)
+		}
+		s.db.Store(record.ShortURL, urlEntry{
+			OriginalURL: record.OriginalURL,
+			UserID:      record.UserID,
+			IsDeleted:   record.IsDeleted,
+			Schedule:    record.schedule(),
+		})
+	case opDelete:
+		entry, ok := s.db.Load(record.ShortURL)
+		if ok && entry.UserID == record.UserID {
+			entry.IsDeleted = true
+			s.db.Store(record.ShortURL, entry)
+			// полный URL удалённой ссылки можно сократить снова
+			if existing, _ := s.byURL.Load(entry.OriginalURL); existing == record.ShortURL {
+				s.byURL.Delete(entry.OriginalURL)
+			}
+		}
+	}
+}
+
+// commit дописывает записи в журнал и только после успешной записи применяет
+// их к данным в памяти. Должен вызываться при захваченном мьютексе.
+func (s *Storage) commit(records ...fileRecord) error {
+	if err := s.appendRecords(records...); err != nil {
+		return ErrSaveFile
+	}
+	for _, record := range records {
+		s.apply(record)
+	}
+	// компактизация запускается после применения, чтобы снимок содержал новые записи
+	if !s.compacting {
+		s.maybeCompact()
+	}
 	return nil
 }
 
@@ -111,55 +376,302 @@ func (s *Storage) Ping(ctx context.Context) error {
 	return nil
 }
 
-// BulkSaveURL массово сохраняет данные о нескольких URL.
-func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) error {
-	for _, url := range data {
-		s.db[url.ShortURL] = url.OriginalURL
+// BulkSaveURL массово сохраняет данные о нескольких URL. Полные URL неудалённых ссылок
+// возвращаются с существующим коротким URL, занятые короткие URL - как коллизии,
+// остальные ссылки сохраняются одной записью в журнал вместе с пометкой удалёнными
+// истёкших ссылок с теми же полными URL.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch := storage.NewBulkBatch(data)
+	records := make([]fileRecord, 0, len(batch.Unique))
+	now := time.Now()
+	for _, i := range batch.Unique {
+		url := data[i]
+		existing, released := s.liveLink(url.OriginalURL, now)
+		if existing != "" {
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveExisting, ShortURL: existing}
+			continue
+		}
+		if _, ok := s.db.Load(url.ShortURL); ok {
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCollision}
+			continue
+		}
+		batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCreated, ShortURL: url.ShortURL}
+		records = append(records, released...)
+		records = append(records, newSaveRecord(url.ShortURL, url.OriginalURL, userID, url.Schedule))
 	}
 
-	if err := s.saveFile(); err != nil {
-		return ErrSaveFile
+	if err := s.commit(records...); err != nil {
+		return nil, err
+	}
+	return batch.Finish(), nil
+}
+
+// appendRecords дописывает записи в конец журнала одним вызовом записи
+// и сбрасывает их на диск. Должен вызываться при захваченном мьютексе.
+func (s *Storage) appendRecords(records ...fileRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			logger.Log.Sugar().Errorf("Ошибка кодирования записи: %s", err)
+			return ErrWriteFile
+		}
+	}
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка записи в файл: %s", err)
+		return ErrWriteFile
+	}
+	// изменение считается сохранённым, только когда запись дошла до диска
+	if err := s.file.Sync(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка сброса файла на диск: %s", err)
+		return ErrWriteFile
+	}
+	s.logRecords += len(records)
+
+	if s.compacting {
+		// записи попадут в новый файл после завершения компактизации
+		s.pending = append(s.pending, records...)
 	}
 
 	return nil
 }
 
-// saveFile сохраняет текущее состояние хранилища в файл.
-func (s *Storage) saveFile() error {
-	// обновляем нашу БД в фале
-	file, err := os.OpenFile(s.storagePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+// maybeCompact запускает компактизацию, если журнал заметно больше текущего состояния.
+// Должен вызываться при захваченном мьютексе.
+func (s *Storage) maybeCompact() {
+	if s.compacting || s.logRecords < compactMinRecords || int64(s.logRecords) <= 2*s.urlCount.Load() {
+		return
+	}
+	s.startCompaction()
+}
+
+// startCompaction делает копию текущего состояния и запускает фоновую запись снимка.
+// Ссылки каждого пользователя записываются в порядке их создания.
+// Должен вызываться при захваченном мьютексе, поэтому данные не меняются во время копирования.
+func (s *Storage) startCompaction() {
+	snapshot := make([]fileRecord, 0, s.urlCount.Load())
+	s.userURLs.Range(func(userID string, shortURLs []string) {
+		for _, shortURL := range shortURLs {
+			entry, _ := s.db.Load(shortURL)
+			if entry.UserID != userID {
+				// ссылка была перезаписана другим пользователем
+				continue
+			}
+			record := newSaveRecord(shortURL, entry.OriginalURL, entry.UserID, entry.Schedule)
+			record.IsDeleted = entry.IsDeleted
+			snapshot = append(snapshot, record)
+		}
+	})
+
+	s.compacting = true
+	s.pending = nil
+	s.compactWG.Add(1)
+	go s.compact(snapshot)
+}
+
+// compact записывает снимок состояния во временный файл, дописывает в него записи,
+// появившиеся за время компактизации, и атомарно заменяет им файл журнала.
+// При любой ошибке прежний журнал остаётся нетронутым.
+func (s *Storage) compact(snapshot []fileRecord) {
+	defer s.compactWG.Done()
+
+	tmp, err := s.writeSnapshot(snapshot)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.pending
+	s.compacting = false
+	s.pending = nil
+
 	if err != nil {
-		logger.Log.Sugar().Errorf("Не удалось открыть файл: %s", err)
-		return ErrOpenFile
+		logger.Log.Sugar().Errorf("Не удалось выполнить компактизацию: %s", err)
+		return
 	}
-	defer file.Close()
 
-	// Сериализуем map в JSON и записываем в файл
-	if err := json.NewEncoder(file).Encode(&s.db); err != nil {
-		logger.Log.Sugar().Errorf("Ошибка записи в файл: %s", err)
-		return ErrWriteFile
+	if err = s.finishSnapshot(tmp, pending); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить компактизацию: %s", err)
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err = s.file.Close(); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось закрыть файл: %s", err)
+	}
+	s.file = tmp
+	s.logRecords = len(snapshot) + len(pending)
+
+	// за время компактизации журнал мог снова разрастись
+	s.maybeCompact()
+}
+
+// writeSnapshot записывает снимок состояния во временный файл.
+func (s *Storage) writeSnapshot(snapshot []fileRecord) (*os.File, error) {
+	tmp, err := os.OpenFile(s.tmpPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, record := range snapshot {
+		if err = enc.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+// finishSnapshot дописывает в снимок записи, сделанные во время компактизации,
+// сбрасывает его на диск и переименовывает поверх файла журнала.
+// Должен вызываться при захваченном мьютексе.
+func (s *Storage) finishSnapshot(tmp *os.File, pending []fileRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range pending {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.storagePath); err != nil {
+		return err
+	}
+
+	// фиксируем переименование на диске
+	dir, err := os.Open(filepath.Dir(s.storagePath))
+	if err != nil {
+		logger.Log.Sugar().Warnf("Не удалось открыть каталог хранилища: %s", err)
+		return nil
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		logger.Log.Sugar().Warnf("Не удалось синхронизировать каталог хранилища: %s", err)
 	}
 
 	return nil
 }
 
+// tmpPath возвращает путь к временному файлу снимка.
+func (s *Storage) tmpPath() string {
+	return s.storagePath + ".tmp"
+}
+
+// Close дожидается завершения компактизации и закрывает файлы журнала и переходов.
+func (s *Storage) Close() error {
+	s.compactWG.Wait()
+	clicksErr := s.clickLog.close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return clicksErr
+	}
+	err := s.file.Close()
+	s.file = nil
+	return errors.Join(err, clicksErr)
+}
+
 // GetUserURLs возвращает список URL, принадлежащих пользователю.
-// В текущей реализации метод не поддерживается.
 func (s *Storage) GetUserURLs(ctx context.Context, baseURL string, userID string) ([]models.UserURLS, error) {
-	// не сделал поддержку данного метода в текущей реализации так как тестами она не проверяется, заленился
+	shortURLs, _ := s.userURLs.Load(userID)
+
 	var urls []models.UserURLS
+	for _, shortURL := range shortURLs {
+		entry, _ := s.db.Load(shortURL)
+		if entry.UserID != userID {
+			continue
+		}
+		urls = append(urls, models.UserURLS{
+			ShortURL:    fmt.Sprintf("%s/%s", baseURL, shortURL),
+			OriginalURL: entry.OriginalURL,
+		})
+	}
+
 	return urls, nil
 }
 
-// DeleteListURL удаляет список URL.
-// В текущей реализации метод не поддерживается.
+// DeleteListURL помечает удалёнными URL, принадлежащие указанным пользователям.
+// Ссылки других пользователей и несуществующие ссылки пропускаются.
 func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListURLForDelete) error {
-	// аналогично
-	return nil
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var records []fileRecord
+	deleted := make(map[string]struct{})
+	for _, message := range messages {
+		for _, shortURL := range message.URLS {
+			entry, ok := s.db.Load(shortURL)
+			if !ok || entry.UserID != message.UserID || entry.IsDeleted {
+				continue
+			}
+			if _, ok := deleted[shortURL]; ok {
+				continue
+			}
+			deleted[shortURL] = struct{}{}
+			records = append(records, fileRecord{Op: opDelete, ShortURL: shortURL, UserID: message.UserID})
+		}
+	}
+
+	return s.commit(records...)
+}
+
+// ExpireURLs помечает удалёнными не более limit ссылок с истёкшим сроком действия
+// одной записью в журнал и возвращает их короткие URL.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	var (
+		expired []string
+		records []fileRecord
+	)
+	s.db.Range(func(shortURL string, entry urlEntry) {
+		if len(expired) >= limit || entry.IsDeleted || entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt) {
+			return
+		}
+		expired = append(expired, shortURL)
+		records = append(records, fileRecord{Op: opDelete, ShortURL: shortURL, UserID: entry.UserID})
+	})
+
+	if err := s.commit(records...); err != nil {
+		return nil, err
+	}
+	return expired, nil
 }
 
 // GetServiceStats получает статистику сервиса.
 func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
-	// в mem реализации у меня нет разбиение ссылок по пользователям, поэтому захардкодил
-	return models.ServiceStat{URLS: len(s.db), Users: 10}, nil
+	users := s.userURLs.Len()
+	if _, ok := s.userURLs.Load(""); ok {
+		// ссылки из файла старого формата не имеют владельца
+		users--
+	}
+
+	return models.ServiceStat{URLS: int(s.urlCount.Load()), Users: users}, nil
 }
@@ -0,0 +1,432 @@
+package mem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+func newTestStorage(t *testing.T, path string) *Storage {
+	provider, err := New(&config.Config{StorageFile: path})
+	require.NoError(t, err)
+	s := provider.(*Storage)
+	require.NoError(t, s.Init())
+	return s
+}
+
+func TestStorageReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user", models.Schedule{}))
+	_, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "short2"},
+		{OriginalURL: "http://vk.com", ShortURL: "short3"},
+	}, "user")
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+	for short, full := range map[string]string{"short1": "http://ya.ru", "short2": "http://mail.ru", "short3": "http://vk.com"} {
+		got, err := s.GetURL(ctx, short)
+		require.NoError(t, err)
+		assert.Equal(t, full, got)
+	}
+}
+
+func TestStorageSchedule(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	now := time.Now()
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "expired", "user", models.Schedule{ExpiresAt: now.Add(-time.Minute)}))
+	_, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "later", Schedule: models.Schedule{ActiveFrom: now.Add(time.Hour)}},
+		{OriginalURL: "http://vk.com", ShortURL: "active", Schedule: models.Schedule{ExpiresAt: now.Add(time.Hour)}},
+	}, "user")
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// срок действия переживает перезапуск
+	s = newTestStorage(t, path)
+	defer s.Close()
+	_, err = s.GetURL(ctx, "expired")
+	assert.ErrorIs(t, err, storage.ErrExpired)
+	assert.ErrorIs(t, err, storage.ErrGone)
+	_, err = s.GetURL(ctx, "later")
+	assert.ErrorIs(t, err, storage.ErrNotActive)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	got, err := s.GetURL(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, "http://vk.com", got)
+
+	// истёкшая ссылка помечается удалённой один раз
+	expired, err := s.ExpireURLs(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expired"}, expired)
+	expired, err = s.ExpireURLs(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	_, err = s.GetURL(ctx, "expired")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	assert.NotErrorIs(t, err, storage.ErrExpired)
+}
+
+func TestStorageTruncatedTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	// имитируем аварийное завершение посреди записи
+	data := `{"op":"save","short_url":"short1","original_url":"http://ya.ru"}` + "\n" + `{"op":"save","short_u`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	s := newTestStorage(t, path)
+	got, err := s.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://ya.ru", got)
+
+	// новая запись должна начинаться с новой строки
+	require.NoError(t, s.SaveURL(ctx, "http://mail.ru", "short2", "user", models.Schedule{}))
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+	got, err = s.GetURL(ctx, "short2")
+	require.NoError(t, err)
+	assert.Equal(t, "http://mail.ru", got)
+}
+
+func TestStorageCorruptedRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	// повреждённая запись в середине журнала не мешает прочитать остальные
+	data := `{"op":"save","short_url":"short1","original_url":"http://ya.ru"}` + "\n" +
+		`{"op":"save","short_u` + "\n" +
+		`{"op":"save","short_url":"short2","original_url":"http://mail.ru"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	s := newTestStorage(t, path)
+	for shortURL, fullURL := range map[string]string{"short1": "http://ya.ru", "short2": "http://mail.ru"} {
+		got, err := s.GetURL(ctx, shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, fullURL, got)
+	}
+	require.NoError(t, s.Close())
+
+	// журнал переписывается без повреждённой записи
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+}
+
+func TestStorageClicks(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{
+		{ShortURL: "short1", Time: now, Referrer: "https://example.com/", IPPrefix: "192.168.10.0/24"},
+		{ShortURL: "short2", Time: now},
+	}))
+	require.NoError(t, s.Close())
+
+	// имитируем аварийное завершение посреди записи перехода
+	file, err := os.OpenFile(path+clicksSuffix, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"short_url":"sho`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	s = newTestStorage(t, path)
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: "short1", Time: now}}))
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+	query := models.LinkStatsQuery{
+		ShortURL: "short1",
+		From:     now.Truncate(time.Hour),
+		To:       now.Truncate(time.Hour).Add(time.Hour),
+		Interval: models.StatsHour,
+		Top:      10,
+	}
+	stats, err := s.GetLinkStats(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Clicks)
+	assert.Equal(t, 2, stats.Visitors)
+	assert.Equal(t, []models.ClickBucket{{Time: query.From, Clicks: 2}}, stats.Timeline)
+	assert.Contains(t, stats.Referrers, models.ClickSource{Value: "https://example.com/", Clicks: 1})
+
+	query.ShortURL = "short2"
+	stats, err = s.GetLinkStats(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Clicks)
+}
+
+func TestStorageLegacyFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"short1":"http://ya.ru"}`+"\n"), 0644))
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"op":"save"`)
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+	got, err := s.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://ya.ru", got)
+}
+
+func TestStorageCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	// журнал, в котором одни и те же ссылки многократно перезаписаны
+	var sb strings.Builder
+	for i := 0; i < 3*compactMinRecords; i++ {
+		fmt.Fprintf(&sb, `{"op":"save","short_url":"short%d","original_url":"http://example.com/%d","user_id":"user"}`+"\n", i%10, i)
+	}
+	require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0644))
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	got, err := s.GetURL(ctx, "short9")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("http://example.com/%d", 3*compactMinRecords-1), got)
+	require.NoError(t, s.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Less(t, strings.Count(string(content), "\n"), compactMinRecords)
+
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestStorageUserURLs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user1", models.Schedule{}))
+	require.NoError(t, s.SaveURL(ctx, "http://mail.ru", "short2", "user1", models.Schedule{}))
+	require.NoError(t, s.SaveURL(ctx, "http://vk.com", "short3", "user2", models.Schedule{}))
+
+	// чужие ссылки не удаляются
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{
+		{UserID: "user1", URLS: []string{"short1", "short3"}},
+	}))
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+
+	_, err := s.GetURL(ctx, "short1")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	got, err := s.GetURL(ctx, "short3")
+	require.NoError(t, err)
+	assert.Equal(t, "http://vk.com", got)
+
+	urls, err := s.GetUserURLs(ctx, "http://localhost:8080", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.UserURLS{
+		{ShortURL: "http://localhost:8080/short1", OriginalURL: "http://ya.ru"},
+		{ShortURL: "http://localhost:8080/short2", OriginalURL: "http://mail.ru"},
+	}, urls)
+
+	stats, err := s.GetServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.ServiceStat{URLS: 3, Users: 2}, stats)
+}
+
+func TestStorageConflict(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, filepath.Join(t.TempDir(), "db.json"))
+	defer s.Close()
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user1", models.Schedule{}))
+
+	err := s.SaveURL(ctx, "http://ya.ru", "short2", "user2", models.Schedule{})
+	var conflict *storage.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "short1", conflict.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+
+	// уже сохранённый URL не прерывает сохранение пакета
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "short3"},
+		{OriginalURL: "http://ya.ru", ShortURL: "short4"},
+		{OriginalURL: "http://mail.ru", ShortURL: "short5"},
+	}, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{
+		{Status: models.BulkSaveCreated, ShortURL: "short3"},
+		{Status: models.BulkSaveExisting, ShortURL: "short1"},
+		{Status: models.BulkSaveExisting, ShortURL: "short3"},
+	}, results)
+	_, err = s.GetURL(ctx, "short4")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestStorageReshorten(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	s := newTestStorage(t, path)
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user", models.Schedule{}))
+	require.NoError(t, s.SaveURL(ctx, "http://mail.ru", "short2", "user", models.Schedule{ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"short1"}}}))
+
+	// полный URL удалённой и истёкшей ссылки можно сократить снова
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short3", "user", models.Schedule{}))
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{{OriginalURL: "http://mail.ru", ShortURL: "short4"}}, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{{Status: models.BulkSaveCreated, ShortURL: "short4"}}, results)
+	require.NoError(t, s.Close())
+
+	s = newTestStorage(t, path)
+	defer s.Close()
+	for full, short := range map[string]string{"http://ya.ru": "short3", "http://mail.ru": "short4"} {
+		got, err := s.GetShortURL(ctx, full)
+		require.NoError(t, err)
+		assert.Equal(t, short, got)
+	}
+	_, err = s.GetURL(ctx, "short2")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	assert.NotErrorIs(t, err, storage.ErrExpired)
+}
+
+func TestStorageShortURLCollision(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, filepath.Join(t.TempDir(), "db.json"))
+	defer s.Close()
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user1", models.Schedule{}))
+
+	// занятый короткий URL не перезаписывает чужую ссылку
+	err := s.SaveURL(ctx, "http://mail.ru", "short1", "user2", models.Schedule{})
+	assert.ErrorIs(t, err, storage.ErrShortURLCollision)
+	assert.NotErrorIs(t, err, storage.ErrConflict)
+	got, err := s.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://ya.ru", got)
+
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "short2"},
+		{OriginalURL: "http://vk.com", ShortURL: "short2"},
+		{OriginalURL: "http://ok.ru", ShortURL: "short1"},
+	}, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{
+		{Status: models.BulkSaveCreated, ShortURL: "short2"},
+		{Status: models.BulkSaveCollision},
+		{Status: models.BulkSaveCollision},
+	}, results)
+	got, err = s.GetURL(ctx, "short2")
+	require.NoError(t, err)
+	assert.Equal(t, "http://mail.ru", got)
+}
+
+// TestStorageConcurrentAccess проверяет отсутствие гонок при одновременном создании,
+// чтении и удалении ссылок. Запускать с флагом -race.
+func TestStorageConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	s := newTestStorage(t, path)
+
+	const (
+		workers = 8
+		perUser = 300
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		userID := fmt.Sprintf("user%d", w)
+		wg.Add(3)
+
+		// создание ссылок по одной и пачками
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perUser; i += 3 {
+				short := fmt.Sprintf("s%d-%d", w, i)
+				assert.NoError(t, s.SaveURL(ctx, "http://example.com/"+short, short, userID, models.Schedule{}))
+				_, err := s.BulkSaveURL(ctx, []models.InsertData{
+					{OriginalURL: fmt.Sprintf("http://example.com/s%d-%d", w, i+1), ShortURL: fmt.Sprintf("s%d-%d", w, i+1)},
+					{OriginalURL: fmt.Sprintf("http://example.com/s%d-%d", w, i+2), ShortURL: fmt.Sprintf("s%d-%d", w, i+2)},
+				}, userID)
+				assert.NoError(t, err)
+			}
+		}(w)
+
+		// переходы по ссылкам, в том числе по ещё не созданным
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				short := fmt.Sprintf("s%d-%d", w, i)
+				full, err := s.GetURL(ctx, short)
+				if err == nil {
+					assert.Equal(t, "http://example.com/"+short, full)
+				}
+				_, _ = s.GetShortURL(ctx, "http://example.com/"+short)
+				_, _ = s.GetUserURLs(ctx, "http://localhost:8080", userID)
+				_, _ = s.GetServiceStats(ctx)
+			}
+		}(w)
+
+		// удаление чётных ссылок
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perUser; i += 2 {
+				assert.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{
+					{UserID: userID, URLS: []string{fmt.Sprintf("s%d-%d", w, i)}},
+				}))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stats, err := s.GetServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.ServiceStat{URLS: workers * perUser, Users: workers}, stats)
+
+	// состояние после перезапуска совпадает с состоянием в памяти
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user0", URLS: []string{"s0-1"}}}))
+	require.NoError(t, s.Close())
+	s = newTestStorage(t, path)
+	defer s.Close()
+
+	restored, err := s.GetServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, stats, restored)
+	_, err = s.GetURL(ctx, "s0-1")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	urls, err := s.GetUserURLs(ctx, "http://localhost:8080", "user3")
+	require.NoError(t, err)
+	assert.Len(t, urls, perUser)
+}
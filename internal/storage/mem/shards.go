@@ -0,0 +1,90 @@
+package mem
+
+import "sync"
+
+// shardCount - количество сегментов в shardedMap. Степень двойки, чтобы
+// номер сегмента вычислялся маской.
+const shardCount = 64
+
+// shardedMap - карта, разделённая на сегменты со своими RWMutex. Чтения разных
+// ключей не конкурируют между собой, а запись блокирует только один сегмент
+// и только на время изменения карты.
+type shardedMap[V any] struct {
+	shards [shardCount]mapShard[V]
+}
+
+// mapShard - сегмент shardedMap.
+type mapShard[V any] struct {
+	mutex sync.RWMutex
+	items map[string]V
+}
+
+// newShardedMap создаёт пустую сегментированную карту.
+func newShardedMap[V any]() *shardedMap[V] {
+	m := &shardedMap[V]{}
+	for i := range m.shards {
+		m.shards[i].items = make(map[string]V)
+	}
+	return m
+}
+
+// shard возвращает сегмент, в котором хранится ключ. Используется хеш FNV-1a.
+func (m *shardedMap[V]) shard(key string) *mapShard[V] {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &m.shards[h&(shardCount-1)]
+}
+
+// Load возвращает значение по ключу.
+func (m *shardedMap[V]) Load(key string) (V, bool) {
+	shard := m.shard(key)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	value, ok := shard.items[key]
+	return value, ok
+}
+
+// Store сохраняет значение по ключу.
+func (m *shardedMap[V]) Store(key string, value V) {
+	shard := m.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.items[key] = value
+}
+
+// Delete удаляет значение по ключу.
+func (m *shardedMap[V]) Delete(key string) {
+	shard := m.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	delete(shard.items, key)
+}
+
+// Len возвращает количество ключей во всех сегментах.
+func (m *shardedMap[V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		m.shards[i].mutex.RLock()
+		n += len(m.shards[i].items)
+		m.shards[i].mutex.RUnlock()
+	}
+	return n
+}
+
+// Range вызывает fn для каждой пары ключ-значение. Сегмент остаётся заблокированным
+// на чтение, пока fn обрабатывает его ключи, поэтому fn не должна изменять карту.
+func (m *shardedMap[V]) Range(fn func(key string, value V)) {
+	for i := range m.shards {
+		m.shards[i].mutex.RLock()
+		for key, value := range m.shards[i].items {
+			fn(key, value)
+		}
+		m.shards[i].mutex.RUnlock()
+	}
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// SaveClicks сохраняет пакет переходов по ссылкам через COPY. Запрос не повторяется
+// при временных ошибках: COPY не идемпотентен, и повтор после потерянного ответа
+// записал бы переходы дважды. Несохранённый пакет повторяет вызывающая сторона.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	_, err := s.pool.CopyFrom(ctx, pgx.Identifier{"click"},
+		[]string{"short_url", "clicked_at", "referrer", "user_agent", "ip_prefix", "country", "city"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			c := clicks[i]
+			return []any{c.ShortURL, c.Time, c.Referrer, c.UserAgent, c.IPPrefix, c.Country, c.City}, nil
+		}))
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось сохранить переходы: %s", err)
+		return classifyError(err, ErrSaveClicks)
+	}
+	return nil
+}
+
+// GetLinkOwner возвращает владельца ссылки, в том числе удалённой.
+func (s *Storage) GetLinkOwner(ctx context.Context, shortURL string) (string, error) {
+	return readFrom(ctx, s, shortURL, func(db *pgxpool.Pool) (string, error) {
+		var userID string
+		err := db.QueryRow(ctx, `SELECT user_id FROM url WHERE short_url = $1`, shortURL).Scan(&userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return "", storage.ErrNotFound
+			}
+			logger.Log.Sugar().Errorf("Не удалось получить владельца ссылки: %s", err)
+			return "", classifyError(err, ErrGetURL)
+		}
+		return userID, nil
+	})
+}
+
+// GetLinkStats подсчитывает статистику переходов по ссылке запросами к таблице click.
+// Статистика читается с реплики, поэтому последние переходы могут в неё ещё не попасть.
+func (s *Storage) GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error) {
+	return readFrom(ctx, s, "", func(db *pgxpool.Pool) (models.LinkStats, error) {
+		return getLinkStats(ctx, db, query)
+	})
+}
+
+// getLinkStats подсчитывает статистику переходов по ссылке в базе данных db.
+func getLinkStats(ctx context.Context, db *pgxpool.Pool, query models.LinkStatsQuery) (models.LinkStats, error) {
+	stats := models.LinkStats{
+		ShortURL: query.ShortURL,
+		From:     query.From,
+		To:       query.To,
+		Interval: query.Interval,
+	}
+
+	row := db.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT (ip_prefix, user_agent))
+		FROM click WHERE short_url = $1 AND clicked_at >= $2 AND clicked_at < $3
+	`, query.ShortURL, query.From, query.To)
+	if err := row.Scan(&stats.Clicks, &stats.Visitors); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подсчитать переходы: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrGetURL)
+	}
+	if stats.Clicks == 0 {
+		return stats, nil
+	}
+
+	// шаги отсчитываются от начала эпохи Unix, поэтому сутки начинаются в полночь UTC
+	rows, err := db.Query(ctx, `
+		SELECT to_timestamp(floor(extract(epoch FROM clicked_at)::float8 / $4) * $4) AS bucket, COUNT(*)
+		FROM click WHERE short_url = $1 AND clicked_at >= $2 AND clicked_at < $3
+		GROUP BY bucket ORDER BY bucket
+	`, query.ShortURL, query.From, query.To, query.Interval.Duration().Seconds())
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrGetURL)
+	}
+	stats.Timeline, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ClickBucket, error) {
+		var bucket models.ClickBucket
+		err := row.Scan(&bucket.Time, &bucket.Clicks)
+		bucket.Time = bucket.Time.UTC()
+		return bucket, err
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrScanRows)
+	}
+
+	if stats.Referrers, err = topClickSources(ctx, db, "referrer", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	if stats.UserAgents, err = topClickSources(ctx, db, "user_agent", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	if stats.Countries, err = topClickSources(ctx, db, "country", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	return stats, nil
+}
+
+// topClickSources возвращает самые частые значения столбца column таблицы click
+// за период запроса.
+func topClickSources(ctx context.Context, db *pgxpool.Pool, column string, query models.LinkStatsQuery) ([]models.ClickSource, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*) AS clicks
+		FROM click WHERE short_url = $1 AND clicked_at >= $2 AND clicked_at < $3
+		GROUP BY %[1]s ORDER BY clicks DESC, %[1]s LIMIT $4
+	`, pgx.Identifier{column}.Sanitize()), query.ShortURL, query.From, query.To, query.Top)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+	sources, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.ClickSource])
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return sources, nil
+}
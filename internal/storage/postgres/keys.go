@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// AddKeys добавляет ключи в таблицу short_key, пропуская ключи, которые уже есть
+// в пуле или заняты сохранёнными ссылками.
+func (s *Storage) AddKeys(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO short_key (short_url)
+		SELECT k FROM unnest($1::text[]) AS k
+		WHERE NOT EXISTS (SELECT 1 FROM url WHERE url.short_url = k)
+		ON CONFLICT (short_url) DO NOTHING
+	`, keys)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось добавить ключи: %s", err)
+		return 0, classifyError(err, ErrSaveURL)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimKeys забирает из пула не более n самых старых ключей. Строки, заблокированные
+// другими экземплярами приложения, пропускаются, поэтому экземпляры не ждут друг друга.
+func (s *Storage) ClaimKeys(ctx context.Context, n int) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `
+		DELETE FROM short_key
+		WHERE short_url IN (
+			SELECT short_url FROM short_key ORDER BY created LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING short_url
+	`, n)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить ключи: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось прочитать ключи: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return keys, nil
+}
+
+// ReleaseKeys возвращает в пул неиспользованные ключи. Ключи, которые успели
+// занять ссылки, в пул не возвращаются.
+func (s *Storage) ReleaseKeys(ctx context.Context, keys []string) error {
+	_, err := s.AddKeys(ctx, keys)
+	return err
+}
+
+// CountFreeKeys возвращает количество ключей в пуле.
+func (s *Storage) CountFreeKeys(ctx context.Context) (int, error) {
+	var count int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM short_key`).Scan(&count); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось посчитать ключи: %s", err)
+		return 0, classifyError(err, ErrGetURL)
+	}
+	return count, nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// fullURLLockSpace - первый ключ рекомендательных блокировок полных URL, второй
+// ключ - группа хеша полного URL. Отделяет их от блокировки миграций.
+const fullURLLockSpace int32 = 0x75726c
+
+// fullURLLockBuckets - количество групп, по которым блокируются полные URL, чтобы
+// большой пакет не занимал больше блокировок, чем помещается в общую таблицу блокировок.
+const fullURLLockBuckets = 256
+
+// unlockTimeout ограничивает время снятия рекомендательных блокировок.
+const unlockTimeout = 5 * time.Second
+
+// LockFullURLs блокирует полные URL рекомендательными блокировками на отдельном
+// соединении из пула до вызова возвращённой функции unlock. Полные URL блокируются
+// группами по хешу, поэтому URL одной группы ждут друг друга. Группы блокируются
+// в порядке возрастания, чтобы пакеты с общими группами не блокировали друг друга взаимно.
+func (s *Storage) LockFullURLs(ctx context.Context, fullURLs []string) (func(), error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить соединение: %s", err)
+		return nil, classifyError(err, ErrLockURL)
+	}
+
+	_, err = conn.Exec(ctx, `
+		SELECT pg_advisory_lock($1::int4, k)
+		FROM (SELECT DISTINCT hashtext(f) & ($3 - 1) AS k FROM unnest($2::text[]) AS f ORDER BY k) AS keys
+	`, fullURLLockSpace, fullURLs, fullURLLockBuckets)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось заблокировать полные URL: %s", err)
+		// часть блокировок могла быть взята, поэтому соединение в пул не возвращается
+		releaseLocked(conn)
+		return nil, classifyError(err, ErrLockURL)
+	}
+
+	return func() { releaseLocked(conn) }, nil
+}
+
+// releaseLocked снимает все рекомендательные блокировки соединения и возвращает
+// его в пул. Если снять блокировки не удалось, соединение закрывается.
+func releaseLocked(conn *pgxpool.Conn) {
+	defer conn.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer cancel()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock_all()`); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось снять блокировки полных URL: %s", err)
+		// соединение с удерживаемыми блокировками нельзя возвращать в пул
+		conn.Conn().Close(ctx)
+	}
+}
+
+// GetShortURLs возвращает короткие URL неудалённых ссылок с полными URL fullURLs.
+// Полные URL, для которых ссылок нет, в результат не попадают. Читает основной
+// сервер, так как используется для проверки уникальности перед сохранением.
+func (s *Storage) GetShortURLs(ctx context.Context, fullURLs []string) (map[string]string, error) {
+	existing := make(map[string]string)
+	if len(fullURLs) == 0 {
+		return existing, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT u.full_url, u.short_url
+		FROM unnest($1::text[]) AS f
+		JOIN url u ON md5(u.full_url) = md5(f) AND u.full_url = f
+		WHERE NOT u.is_deleted
+	`, fullURLs)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить короткие URL: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+	var fullURL, shortURL string
+	_, err = pgx.ForEachRow(rows, []any{&fullURL, &shortURL}, func() error {
+		existing[fullURL] = shortURL
+		return nil
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось прочитать короткие URL: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return existing, nil
+}
@@ -0,0 +1,377 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// migrationsFS содержит SQL-файлы миграций вида <версия>_<название>.up.sql
+// и <версия>_<название>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey - ключ рекомендательной блокировки, под которой выполняются
+// миграции, чтобы схему одновременно изменяла только одна реплика.
+const migrationLockKey int64 = 0x73686f7274656e72
+
+// возможные ошибки миграций
+var (
+	// ErrMigrate описывает ошибку применения или отката миграций.
+	ErrMigrate = errors.New("migrating database")
+	// ErrLoadMigrations описывает ошибку чтения встроенных файлов миграций.
+	ErrLoadMigrations = errors.New("loading migrations")
+	// ErrUnknownVersion описывает ошибку, когда запрошенная версия схемы не существует.
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration описывает одну версию схемы базы данных.
+type Migration struct {
+	Version int64  // Номер версии, определяющий порядок применения.
+	Name    string // Название миграции.
+	Up      string // SQL для перехода на эту версию.
+	Down    string // SQL для отката этой версии.
+}
+
+// MigrationStatus описывает состояние миграции в базе данных.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time // Время применения или nil, если миграция не применена.
+	Unknown   bool       // Признак применённой версии, которой нет среди встроенных миграций.
+}
+
+// appliedMigration описывает запись о применённой миграции в таблице schema_migrations.
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// querier выполняет запросы на соединении или пуле соединений.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Migrator применяет и откатывает встроенные миграции схемы базы данных.
+// Применённые версии хранятся в таблице schema_migrations.
+type Migrator struct {
+	pool       *pgxpool.Pool // Пул соединений с базой данных.
+	migrations []Migration   // Миграции, упорядоченные по версии.
+	ownPool    bool          // Признак того, что пул создан мигратором и закрывается им.
+}
+
+// NewMigrator создаёт мигратор с собственным пулом соединений к базе данных,
+// указанной в конфигурации. Пул закрывается методом Close.
+func NewMigrator(cfg *config.Config) (*Migrator, error) {
+	pool, err := pgxpool.New(context.Background(), cfg.DSN)
+	if err != nil {
+		return nil, ErrCreatePool
+	}
+	m, err := newMigrator(pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	m.ownPool = true
+	return m, nil
+}
+
+// newMigrator создаёт мигратор, использующий существующий пул соединений.
+func newMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось загрузить миграции: %s", err)
+		return nil, ErrLoadMigrations
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// loadMigrations читает и упорядочивает миграции из файловой системы.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		name := file.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		body, err := fs.ReadFile(fsys, "migrations/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Close закрывает пул соединений, если он был создан мигратором.
+func (m *Migrator) Close() {
+	if m.ownPool {
+		m.pool.Close()
+	}
+}
+
+// Up применяет все неприменённые миграции с версией не выше target.
+// Если target равен нулю, применяются все миграции.
+//
+// Возвращает количество применённых миграций.
+func (m *Migrator) Up(ctx context.Context, target int64) (int, error) {
+	if target != 0 && m.find(target) < 0 {
+		return 0, ErrUnknownVersion
+	}
+
+	applied := 0
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if target != 0 && migration.Version > target {
+				break
+			}
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			logger.Log.Sugar().Infof("применение миграции %d_%s", migration.Version, migration.Name)
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+					migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Ошибка применения миграций: %s", err)
+		return applied, fmt.Errorf("%w: %w", ErrMigrate, err)
+	}
+
+	return applied, nil
+}
+
+// Down откатывает steps последних применённых миграций в обратном порядке.
+//
+// Возвращает количество откаченных миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+
+			logger.Log.Sugar().Infof("откат миграции %d_%s", migration.Version, migration.Name)
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Ошибка отката миграций: %s", err)
+		return reverted, fmt.Errorf("%w: %w", ErrMigrate, err)
+	}
+
+	return reverted, nil
+}
+
+// Status возвращает список известных миграций с временем их применения, а также
+// применённые версии, которых нет среди встроенных миграций, например после
+// отката приложения на старую версию. Список упорядочен по версии.
+//
+// Status не берёт блокировку миграций и не изменяет базу данных: если таблицы
+// schema_migrations ещё нет, все миграции считаются неприменёнными.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var exists bool
+	err := m.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMigrate, err)
+	}
+	versions := make(map[int64]appliedMigration)
+	if exists {
+		if versions, err = appliedVersions(ctx, m.pool); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMigrate, err)
+		}
+	}
+
+	return m.statuses(versions), nil
+}
+
+// statuses сопоставляет встроенные миграции с применёнными версиями versions.
+func (m *Migrator) statuses(versions map[int64]appliedMigration) []MigrationStatus {
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if applied, ok := versions[migration.Version]; ok {
+			status.AppliedAt = &applied.appliedAt
+		}
+		result = append(result, status)
+	}
+	for version, applied := range versions {
+		if m.find(version) >= 0 {
+			continue
+		}
+		result = append(result, MigrationStatus{
+			Migration: Migration{Version: version, Name: applied.name},
+			AppliedAt: &applied.appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+
+	return result
+}
+
+// find возвращает индекс миграции с указанной версией или -1.
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// withLock выполняет fn на выделенном соединении под рекомендательной блокировкой
+// и гарантирует наличие таблицы schema_migrations.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// остальные реплики ждут здесь, пока первая не закончит миграции
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer func() {
+		// блокировка снимается отдельным контекстом, чтобы не остаться висеть при отмене ctx
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось снять блокировку миграций: %s", err)
+			// соединение с удерживаемой блокировкой нельзя возвращать в пул
+			conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			"version" BIGINT PRIMARY KEY,
+			"name" TEXT NOT NULL,
+			"applied_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions возвращает применённые версии схемы с названием и временем их применения.
+func appliedVersions(ctx context.Context, db querier) (map[int64]appliedMigration, error) {
+	rows, err := db.Query(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var (
+			version int64
+			applied appliedMigration
+		)
+		if err = rows.Scan(&version, &applied.name, &applied.appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = applied
+	}
+
+	return versions, rows.Err()
+}
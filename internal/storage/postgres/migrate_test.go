@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"migrations/0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+		"migrations/0001_first.down.sql":  {Data: []byte("SELECT -1;")},
+		"migrations/README.md":            {Data: []byte("ignored")},
+		"migrations/0002_second.down.sql": {Data: []byte("SELECT -2;")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "SELECT 1;", Down: "SELECT -1;"},
+		{Version: 2, Name: "second", Up: "SELECT 2;", Down: "SELECT -2;"},
+	}, migrations)
+
+	_, err = loadMigrations(fstest.MapFS{"migrations/0003_only_down.down.sql": {Data: []byte("SELECT 3;")}})
+	assert.Error(t, err)
+
+	// встроенные миграции должны загружаться без ошибок
+	embedded, err := loadMigrations(migrationsFS)
+	require.NoError(t, err)
+	assert.NotEmpty(t, embedded)
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "first"},
+		{Version: 2, Name: "second"},
+	}}
+	appliedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// применённые версии, неизвестные этой версии приложения, тоже попадают в список
+	statuses := m.statuses(map[int64]appliedMigration{
+		1: {name: "first", appliedAt: appliedAt},
+		3: {name: "third", appliedAt: appliedAt},
+	})
+	assert.Equal(t, []MigrationStatus{
+		{Migration: Migration{Version: 1, Name: "first"}, AppliedAt: &appliedAt},
+		{Migration: Migration{Version: 2, Name: "second"}},
+		{Migration: Migration{Version: 3, Name: "third"}, AppliedAt: &appliedAt, Unknown: true},
+	}, statuses)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS url (
+	"id" SERIAL PRIMARY KEY,
+	"full_url" VARCHAR(250) NOT NULL,
+	"short_url" VARCHAR(250) NOT NULL,
+	"created" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	"user_id" UUID NOT NULL,
+	"is_deleted" BOOLEAN DEFAULT FALSE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_full_url_unique ON url(full_url);
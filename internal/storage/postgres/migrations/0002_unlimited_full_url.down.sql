@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_url_full_url_md5;
+
+ALTER TABLE url ALTER COLUMN full_url TYPE VARCHAR(250);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_full_url_unique ON url (full_url);
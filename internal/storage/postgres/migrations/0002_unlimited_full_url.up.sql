@@ -0,0 +1,7 @@
+-- full_url больше не ограничен по длине, уникальность обеспечивается индексом по хешу,
+-- так как B-tree индекс не может хранить значения длиннее трети страницы
+ALTER TABLE url ALTER COLUMN full_url TYPE TEXT;
+
+DROP INDEX IF EXISTS idx_full_url_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_full_url_md5 ON url (md5(full_url));
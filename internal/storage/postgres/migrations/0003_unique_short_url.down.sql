@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_url_short_url_unique;
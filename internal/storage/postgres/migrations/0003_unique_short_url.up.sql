@@ -0,0 +1,16 @@
+-- короткий URL однозначно определяет ссылку, поэтому он должен быть уникален.
+-- Случайный генератор мог выдать один короткий URL нескольким ссылкам: такие ссылки
+-- нужно исправить вручную, поэтому миграция прерывается со списком коротких URL
+DO $$
+DECLARE
+	duplicates TEXT;
+BEGIN
+	SELECT string_agg(short_url, ', ' ORDER BY short_url) INTO duplicates
+	FROM (SELECT short_url FROM url GROUP BY short_url HAVING COUNT(*) > 1 ORDER BY short_url LIMIT 100) AS d;
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION 'short urls are used by several links, make them unique before migrating: %', duplicates;
+	END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_short_url_unique ON url (short_url);
@@ -0,0 +1,7 @@
+-- пул заранее сгенерированных свободных коротких URL
+CREATE TABLE IF NOT EXISTS short_key (
+	"short_url" TEXT PRIMARY KEY,
+	"created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_short_key_created ON short_key (created);
@@ -0,0 +1,6 @@
+-- срок действия ссылки: NULL означает отсутствие ограничения
+ALTER TABLE url ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ;
+ALTER TABLE url ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- частичный индекс для поиска ссылок с истёкшим сроком действия
+CREATE INDEX IF NOT EXISTS idx_url_expires_at ON url (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
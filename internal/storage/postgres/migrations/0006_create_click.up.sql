@@ -0,0 +1,12 @@
+-- переходы по ссылкам; ссылка на url не ставится, так как переходы
+-- остаются на шарде, на котором записаны, даже после переноса ссылки
+CREATE TABLE IF NOT EXISTS click (
+	"id" BIGSERIAL PRIMARY KEY,
+	"short_url" TEXT NOT NULL,
+	"clicked_at" TIMESTAMPTZ NOT NULL,
+	"referrer" TEXT NOT NULL DEFAULT '',
+	"user_agent" TEXT NOT NULL DEFAULT '',
+	"ip_prefix" TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_short_url_clicked_at ON click (short_url, clicked_at);
@@ -0,0 +1,2 @@
+ALTER TABLE click DROP COLUMN IF EXISTS city;
+ALTER TABLE click DROP COLUMN IF EXISTS country;
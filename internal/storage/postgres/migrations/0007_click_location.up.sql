@@ -0,0 +1,3 @@
+-- местоположение клиента по базе GeoIP, пустое, если база не задана
+ALTER TABLE click ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '';
+ALTER TABLE click ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT '';
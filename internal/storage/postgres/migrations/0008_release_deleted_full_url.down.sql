@@ -0,0 +1,18 @@
+-- полный URL снова должен быть уникален среди всех ссылок. Если после удаления
+-- ссылки её полный URL сократили снова, откат прерывается со списком таких URL:
+-- удалять ссылки вместе с владельцами и переходами миграция не должна
+DO $$
+DECLARE
+	duplicates TEXT;
+BEGIN
+	SELECT string_agg(full_url, ', ' ORDER BY full_url) INTO duplicates
+	FROM (SELECT full_url FROM url GROUP BY full_url HAVING COUNT(*) > 1 ORDER BY full_url LIMIT 100) AS d;
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION 'full urls are used by several links, remove the deleted ones before rolling back: %', duplicates;
+	END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS idx_url_full_url_md5_active;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_full_url_md5 ON url (md5(full_url));
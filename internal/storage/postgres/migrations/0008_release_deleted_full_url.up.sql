@@ -0,0 +1,5 @@
+-- полный URL уникален только среди неудалённых ссылок, чтобы удалённую
+-- или истёкшую ссылку можно было сократить снова
+DROP INDEX IF EXISTS idx_url_full_url_md5;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_full_url_md5_active ON url (md5(full_url)) WHERE NOT is_deleted;
@@ -0,0 +1,10 @@
+-- общий счётчик порядковых номеров коротких URL, из которого экземпляры приложения
+-- резервируют непересекающиеся диапазоны; начинается с количества уже сохранённых ссылок
+CREATE TABLE IF NOT EXISTS short_url_sequence (
+	"id" BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK ("id"),
+	"next" BIGINT NOT NULL
+);
+
+INSERT INTO short_url_sequence ("next")
+SELECT COUNT(*) FROM url
+ON CONFLICT ("id") DO NOTHING;
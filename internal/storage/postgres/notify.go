@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// changesChannel - канал NOTIFY, в который публикуются события изменения ссылок.
+	changesChannel = "url_changes"
+	// maxNotifyPayload - максимальный размер одного уведомления в байтах.
+	// Postgres ограничивает payload 8000 байт, часть оставляем про запас.
+	maxNotifyPayload = 7000
+	// listenMinBackoff и listenMaxBackoff ограничивают паузу перед повторным подключением.
+	listenMinBackoff = 500 * time.Millisecond
+	listenMaxBackoff = 30 * time.Second
+)
+
+// notifyChanges публикует событие изменения ссылок в рамках транзакции tx,
+// поэтому уведомления доставляются только после её фиксации.
+func notifyChanges(ctx context.Context, tx pgx.Tx, op storage.ChangeOp, shortURLs []string) error {
+	payloads, err := encodeChanges(op, shortURLs)
+	if err != nil {
+		return err
+	}
+	for _, payload := range payloads {
+		if _, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, changesChannel, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeChanges кодирует событие в JSON, разбивая список коротких URL на части,
+// каждая из которых помещается в одно уведомление.
+func encodeChanges(op storage.ChangeOp, shortURLs []string) ([]string, error) {
+	var (
+		payloads []string
+		chunk    []string
+		size     int
+	)
+	flush := func() error {
+		payload, err := json.Marshal(storage.ChangeEvent{Op: op, ShortURLs: chunk})
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, string(payload))
+		chunk, size = nil, 0
+		return nil
+	}
+
+	// запас на имя операции и структуру JSON
+	const overhead = 64
+	for _, shortURL := range shortURLs {
+		// кавычки и запятая, экранирование не учитываем: короткие URL состоят из символов алфавита
+		itemSize := len(shortURL) + 3
+		if len(chunk) > 0 && overhead+size+itemSize > maxNotifyPayload {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		chunk = append(chunk, shortURL)
+		size += itemSize
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+// ListenChanges подписывается на события изменения ссылок на выделенном соединении
+// из пула и вызывает handle для каждого события, пока не будет закрыт stopChan.
+// Короткие URL из событий отмечаются изменёнными, чтобы чтения этих ссылок
+// не заполняли кеш с отстающей реплики.
+// При потере соединения переподключается с растущей паузой. После каждого
+// подключения вызывает handle с событием ChangeReset, так как события,
+// опубликованные без подписки, потеряны.
+func (s *Storage) ListenChanges(wg *sync.WaitGroup, stopChan chan int64, handle func(storage.ChangeEvent)) {
+	defer wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := listenMinBackoff
+	for {
+		err := s.listen(ctx, func() {
+			backoff = listenMinBackoff
+			handle(storage.ChangeEvent{Op: storage.ChangeReset})
+		}, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Sugar().Errorf("Потеряна подписка на изменения ссылок, повтор через %s: %s", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+// listen выполняет LISTEN на отдельном соединении и передаёт события в handle
+// до ошибки соединения или отмены ctx.
+func (s *Storage) listen(ctx context.Context, onConnect func(), handle func(storage.ChangeEvent)) error {
+	pooled, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение с подпиской не возвращается в пул, чтобы его не получили другие запросы
+	conn := pooled.Hijack()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn.Close(closeCtx)
+	}()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return err
+	}
+	onConnect()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event storage.ChangeEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось разобрать событие изменения ссылок: %s", err)
+			continue
+		}
+		s.touchLinks(event.ShortURLs...)
+		handle(event)
+	}
+}
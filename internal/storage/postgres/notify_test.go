@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+func TestEncodeChanges(t *testing.T) {
+	shortURLs := make([]string, 2000)
+	for i := range shortURLs {
+		shortURLs[i] = fmt.Sprintf("code%06d", i)
+	}
+
+	payloads, err := encodeChanges(storage.ChangeDelete, shortURLs)
+	require.NoError(t, err)
+	assert.Greater(t, len(payloads), 1)
+
+	var decoded []string
+	for _, payload := range payloads {
+		assert.LessOrEqual(t, len(payload), maxNotifyPayload)
+
+		var event storage.ChangeEvent
+		require.NoError(t, json.Unmarshal([]byte(payload), &event))
+		assert.Equal(t, storage.ChangeDelete, event.Op)
+		decoded = append(decoded, event.ShortURLs...)
+	}
+	assert.Equal(t, shortURLs, decoded)
+
+	payloads, err = encodeChanges(storage.ChangeDelete, nil)
+	require.NoError(t, err)
+	assert.Empty(t, payloads)
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/retry"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// defaultRetryAttempts - количество попыток запроса при временных ошибках,
+	// если оно не задано в конфигурации.
+	defaultRetryAttempts = 3
+	// retryInitialDelay и retryMaxDelay ограничивают паузы между повторами запросов.
+	retryInitialDelay = 50 * time.Millisecond
+	retryMaxDelay     = time.Second
+	// waitInitialDelay и waitMaxDelay ограничивают паузы между проверками
+	// доступности базы данных при запуске.
+	waitInitialDelay = 500 * time.Millisecond
+	waitMaxDelay     = 5 * time.Second
+)
+
+// newPool создаёт пул соединений по dsn с настройками пула из конфигурации.
+// Незаданные настройки остаются значениями по умолчанию pgx.
+func newPool(dsn string, cfg *config.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, ErrCreatePool
+	}
+	if cfg.DBMaxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.DBMaxConns)
+	}
+	if cfg.DBMinConns > 0 {
+		poolConfig.MinConns = int32(cfg.DBMinConns)
+	}
+	if cfg.DBMaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.DBMaxConnLifetime
+	}
+	if cfg.DBMaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.DBMaxConnIdleTime
+	}
+	// ошибки установки соединения отличаются от таймаутов запросов
+	dial := poolConfig.ConnConfig.DialFunc
+	poolConfig.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, &dialError{err: err}
+		}
+		return conn, nil
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, ErrCreatePool
+	}
+	return pool, nil
+}
+
+// dialError описывает ошибку установки сетевого соединения с базой данных.
+type dialError struct {
+	err error
+}
+
+// Error возвращает текстовое описание ошибки.
+func (e *dialError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap возвращает исходную сетевую ошибку.
+func (e *dialError) Unwrap() error {
+	return e.err
+}
+
+// retryPolicy возвращает политику повтора запросов из конфигурации.
+func retryPolicy(cfg *config.Config) retry.Policy {
+	attempts := cfg.DBRetryAttempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	return retry.Policy{Attempts: attempts, InitialDelay: retryInitialDelay, MaxDelay: retryMaxDelay}
+}
+
+// withRetry выполняет идемпотентную операцию fn, повторяя её при временных ошибках.
+func (s *Storage) withRetry(ctx context.Context, fn func() error) error {
+	return retry.Do(ctx, s.retry, isTransient, fn)
+}
+
+// waitForDB ждёт, пока база данных станет доступна, но не дольше s.waitTimeout.
+// Позволяет запускать приложение одновременно с базой данных, например в kubernetes.
+func (s *Storage) waitForDB() error {
+	if s.waitTimeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.waitTimeout)
+	defer cancel()
+
+	policy := retry.Policy{InitialDelay: waitInitialDelay, MaxDelay: waitMaxDelay}
+	err := retry.Do(ctx, policy, isTransient, func() error {
+		err := s.pool.Ping(ctx)
+		if err != nil {
+			logger.Log.Sugar().Warnf("База данных недоступна, ждём: %s", err)
+		}
+		return err
+	})
+	if err != nil {
+		return classifyError(err, ErrPing)
+	}
+	return nil
+}
+
+// isTransient проверяет, что ошибка временная и запрос можно повторить:
+// база данных недоступна или транзакция прервана из-за конкурентного доступа.
+func isTransient(err error) bool {
+	if errors.Is(err, storage.ErrUnavailable) || isUnavailable(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		(pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected)
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "база данных недоступна", err: fmt.Errorf("%w: %w", storage.ErrUnavailable, ErrGetURL), expected: true},
+		{name: "база данных запускается", err: &pgconn.PgError{Code: pgerrcode.CannotConnectNow}, expected: true},
+		{name: "ошибка сериализации", err: &pgconn.PgError{Code: pgerrcode.SerializationFailure}, expected: true},
+		{name: "взаимная блокировка", err: &pgconn.PgError{Code: pgerrcode.DeadlockDetected}, expected: true},
+		{name: "нарушение уникальности", err: &pgconn.PgError{Code: pgerrcode.UniqueViolation}, expected: false},
+		{name: "ссылка не найдена", err: storage.ErrNotFound, expected: false},
+		{name: "прочая ошибка", err: errors.New("syntax error"), expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isTransient(tc.err))
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	// соединение с базой данных не удалось установить или оно потеряно
+	for _, err := range []error{
+		&pgconn.PgError{Code: pgerrcode.AdminShutdown},
+		&dialError{err: context.DeadlineExceeded},
+	} {
+		classified := classifyError(err, ErrGetURL)
+		assert.ErrorIs(t, classified, storage.ErrUnavailable)
+		assert.NotErrorIs(t, classified, storage.ErrTimeout)
+		assert.ErrorIs(t, classified, ErrGetURL)
+	}
+
+	// медленный запрос не означает потерю соединения
+	classified := classifyError(fmt.Errorf("query: %w", context.DeadlineExceeded), ErrGetURL)
+	assert.ErrorIs(t, classified, storage.ErrTimeout)
+	assert.ErrorIs(t, classified, storage.ErrUnavailable)
+
+	assert.Equal(t, ErrGetURL, classifyError(errors.New("syntax error"), ErrGetURL))
+}
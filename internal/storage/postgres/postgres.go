@@ -2,17 +2,20 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/hll"
+	"github.com/zYoma/go-url-shortener/internal/libs/retry"
 	"github.com/zYoma/go-url-shortener/internal/logger"
 	"github.com/zYoma/go-url-shortener/internal/models"
 	"github.com/zYoma/go-url-shortener/internal/storage"
@@ -24,14 +27,8 @@ var (
 	ErrCreatePool = errors.New("unable to create connection pool")
 	// ErrPing описывает ошибку проверки соединения с базой данных.
 	ErrPing = errors.New("checking connection to the database")
-	// ErrURLNotFound описывает ошибку, возникающую, когда URL не найден в базе данных.
-	ErrURLNotFound = errors.New("url not found")
 	// ErrSaveURL описывает ошибку сохранения URL в базе данных.
 	ErrSaveURL = errors.New("saving to database")
-	// ErrCreateTable описывает ошибку создания таблиц в базе данных.
-	ErrCreateTable = errors.New("creating tables")
-	// ErrConflict описывает ошибку конфликта при попытке вставки URL, который уже существует.
-	ErrConflict = errors.New("url already exist")
 	// ErrGetURL описывает ошибку получения данных из базы данных.
 	ErrGetURL = errors.New("select from database")
 	// ErrScanRows описывает ошибку чтения строк из результата запроса.
@@ -40,52 +37,214 @@ var (
 	ErrSRows = errors.New("line search error")
 	// ErrUpdateURL описывает ошибку обновления данных о URL в базе данных.
 	ErrUpdateURL = errors.New("update urls")
-	// ErrURLDeleted описывает ошибку, возникающую при попытке доступа к удалённому URL.
-	ErrURLDeleted = errors.New("URL was deleted")
+	// ErrSaveClicks описывает ошибку сохранения переходов по ссылкам в базе данных.
+	ErrSaveClicks = errors.New("saving clicks to database")
+	// ErrLockURL описывает ошибку блокировки полных URL в базе данных.
+	ErrLockURL = errors.New("locking urls")
+	// ErrReserveSequence описывает ошибку резервирования порядковых номеров в базе данных.
+	ErrReserveSequence = errors.New("reserving sequence numbers")
 )
 
 // Storage реализует интерфейс StorageProvider и предоставляет методы для работы с хранилищем URL.
+//
+// Storage не использует блокировки на стороне приложения: запросы выполняются
+// параллельно через пул соединений, а целостность данных обеспечивается уникальными
+// индексами и транзакциями. Конкурентное сохранение одного полного URL возвращает
+// конфликт, одного короткого URL - коллизию.
+//
+// Если заданы реплики, запросы на чтение распределяются между ними, а изменения
+// выполняются на основном сервере. Чтобы изменения были видны сразу, ссылка,
+// сохранённая, удалённая или помеченная истёкшей в течение readYourWritesWindow,
+// читается с основного сервера, как и список ссылок пользователя, недавно
+// изменявшего ссылки. Недавние изменения отслеживаются в памяти экземпляра:
+// удаления других экземпляров он узнаёт из подписки на изменения ссылок, поэтому
+// кеш не заполняется удалённой ссылкой с отстающей реплики. Ссылка, сохранённая
+// другим экземпляром, может быть не найдена, пока реплика не догонит изменения.
+//
+// Идемпотентные запросы повторяются при временных ошибках: недоступности базы данных,
+// ошибках сериализации и взаимных блокировках.
 type Storage struct {
-	pool  *pgxpool.Pool // Пул соединений с базой данных.
-	mutex sync.Mutex    // Мьютекс для синхронизации доступа к базе данных.
+	pool          *pgxpool.Pool // Пул соединений с базой данных.
+	replicas      *replicaSet   // Реплики для чтения, nil если не заданы.
+	recentWriters sync.Map      // Время последнего изменения ссылок по идентификатору пользователя.
+	recentLinks   sync.Map      // Время сохранения ссылок по короткому и полному URL.
+	retry         retry.Policy  // Политика повтора запросов при временных ошибках.
+	waitTimeout   time.Duration // Сколько ждать доступности базы данных при инициализации.
 }
 
 // New инициализирует новый экземпляр Storage с подключением к базе данных, указанной в конфигурации.
 func New(cfg *config.Config) (storage.StorageProvider, error) {
-	dbpool, err := pgxpool.New(context.Background(), cfg.DSN)
+	dbpool, err := newPool(cfg.DSN, cfg)
 	if err != nil {
-		return nil, ErrCreatePool
+		return nil, err
 	}
-	return &Storage{pool: dbpool}, nil
+	s := &Storage{pool: dbpool, retry: retryPolicy(cfg), waitTimeout: cfg.DBWaitTimeout}
+
+	if len(cfg.ReplicaDSNs) > 0 {
+		if s.replicas, err = newReplicaSet(cfg.ReplicaDSNs, cfg); err != nil {
+			dbpool.Close()
+			return nil, err
+		}
+		s.replicas.run(cfg.ReplicaCheckInterval, s.forgetWriters)
+	}
+	return s, nil
 }
 
-// SaveURL сохраняет указанный URL в базе данных, ассоциируя его с конкретным пользователем.
-func (s *Storage) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// readFrom выполняет запрос на чтение на доступной реплике. Если реплик нет или все
+// недоступны, а также если ссылка с коротким или полным URL link недавно изменена,
+// запрос выполняется на основном сервере. При недоступности реплики запрос
+// повторяется на основном сервере. Пустой link означает чтение, не относящееся к одной ссылке.
+func readFrom[T any](ctx context.Context, s *Storage, link string, query func(db *pgxpool.Pool) (T, error)) (T, error) {
+	r := s.replicas.pick()
+	if r == nil || link != "" && s.isRecentLink(link) {
+		// изменение недавно изменённой ссылки могло ещё не дойти до реплики
+		return readPrimary(ctx, s, query)
+	}
 
-	_, err := s.pool.Exec(ctx, `
-        INSERT INTO url (full_url, short_url, user_id) VALUES ($1, $2, $3) ;
-    `, fullURL, shortURL, userID)
+	result, err := query(r.pool)
+	if errors.Is(err, storage.ErrUnavailable) {
+		s.replicas.markDown(r)
+		return readPrimary(ctx, s, query)
+	}
+	return result, err
+}
+
+// readPrimary выполняет запрос на чтение на основном сервере, повторяя его при временных ошибках.
+func readPrimary[T any](ctx context.Context, s *Storage, query func(db *pgxpool.Pool) (T, error)) (T, error) {
+	var result T
+	err := s.withRetry(ctx, func() error {
+		var err error
+		result, err = query(s.pool)
+		return err
+	})
+	return result, err
+}
+
+// touchWriter отмечает, что пользователь изменил свои ссылки.
+func (s *Storage) touchWriter(userID string) {
+	if s.replicas != nil {
+		s.recentWriters.Store(userID, time.Now())
+	}
+}
+
+// isRecentWriter проверяет, изменял ли пользователь ссылки в течение readYourWritesWindow.
+func (s *Storage) isRecentWriter(userID string) bool {
+	touched, ok := s.recentWriters.Load(userID)
+	return ok && time.Since(touched.(time.Time)) < readYourWritesWindow
+}
+
+// touchLinks отмечает, что ссылки с короткими или полными URL links сохранены,
+// удалены или помечены истёкшими.
+func (s *Storage) touchLinks(links ...string) {
+	if s.replicas == nil {
+		return
+	}
+	now := time.Now()
+	for _, link := range links {
+		s.recentLinks.Store(link, now)
+	}
+}
+
+// isRecentLink проверяет, изменялась ли ссылка с коротким или полным URL link
+// в течение readYourWritesWindow.
+func (s *Storage) isRecentLink(link string) bool {
+	touched, ok := s.recentLinks.Load(link)
+	return ok && time.Since(touched.(time.Time)) < readYourWritesWindow
+}
+
+// forgetWriters удаляет устаревшие отметки об изменениях ссылок.
+func (s *Storage) forgetWriters() {
+	for _, recent := range []*sync.Map{&s.recentWriters, &s.recentLinks} {
+		recent.Range(func(key, touched any) bool {
+			if time.Since(touched.(time.Time)) >= readYourWritesWindow {
+				recent.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+// SaveURL сохраняет указанный URL в базе данных, ассоциируя его с конкретным пользователем.
+// Полный URL уникален только среди неудалённых ссылок, поэтому удалённую ссылку можно
+// сократить снова, а ссылка с истёкшим сроком действия помечается удалённой перед вставкой.
+func (s *Storage) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string, schedule models.Schedule) error {
+	s.touchWriter(userID)
+	s.touchLinks(shortURL, fullURL)
+	attempt := 0
+	err := s.withRetry(ctx, func() error {
+		attempt++
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			err := releaseExpired(ctx, tx, `
+				UPDATE url SET is_deleted = true
+				WHERE md5(full_url) = md5($1) AND full_url = $1 AND NOT is_deleted AND expires_at <= now()
+				RETURNING short_url`, fullURL)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO url (full_url, short_url, user_id, active_from, expires_at) VALUES ($1, $2, $3, $4, $5) ;
+			`, fullURL, shortURL, userID, timeOrNil(schedule.ActiveFrom), timeOrNil(schedule.ExpiresAt))
+			return err
+		})
+	})
 
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
-			return ErrConflict
+		if attempt > 1 && (isConflict(err) || isShortURLCollision(err)) {
+			// предыдущая попытка могла сохранить ссылку, хотя ответ до нас не дошёл;
+			// повторная вставка тогда нарушает любой из уникальных индексов
+			if link, getErr := getURL(ctx, s.pool, shortURL); getErr == nil && link.OriginalURL == fullURL {
+				return nil
+			}
+		}
+		if isShortURLCollision(err) {
+			return storage.ErrShortURLCollision
+		}
+		if isConflict(err) {
+			existing, getErr := getShortURL(ctx, s.pool, fullURL)
+			if getErr != nil {
+				return storage.ErrConflict
+			}
+			return &storage.ConflictError{ShortURL: existing}
 		}
 		logger.Log.Sugar().Errorf("Не удалось сохранить url: %s", err)
-		return ErrSaveURL
+		return classifyError(err, ErrSaveURL)
 	}
 	return nil
 }
 
-// GetShortURL возвращает короткий URL по заданному полному URL.
+// releaseExpired выполняет запрос query, который помечает удалёнными истёкшие ссылки
+// с сохраняемыми полными URL и возвращает их короткие URL, и публикует их как истёкшие.
+// Так полный URL истёкшей ссылки освобождается, не дожидаясь ExpireURLs.
+func releaseExpired(ctx context.Context, tx pgx.Tx, query string, args ...any) error {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	expired, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	return notifyChanges(ctx, tx, storage.ChangeExpire, expired)
+}
+
+// GetShortURL возвращает короткий URL неудалённой ссылки по заданному полному URL.
 func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
+	return readFrom(ctx, s, fullURL, func(db *pgxpool.Pool) (string, error) {
+		return getShortURL(ctx, db, fullURL)
+	})
+}
+
+// getShortURL возвращает короткий URL по заданному полному URL из базы данных db.
+func getShortURL(ctx context.Context, db *pgxpool.Pool, fullURL string) (string, error) {
 	var shortURL string
-	row := s.pool.QueryRow(ctx, `SELECT short_url FROM url WHERE full_url = $1`, fullURL)
+	// сравнение по md5 позволяет использовать уникальный индекс idx_url_full_url_md5_active
+	row := db.QueryRow(ctx, `SELECT short_url FROM url WHERE md5(full_url) = md5($1) AND full_url = $1 AND NOT is_deleted`, fullURL)
 	err := row.Scan(&shortURL)
 	if err != nil {
-		return "", ErrURLNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", storage.ErrNotFound
+		}
+		return "", classifyError(err, ErrGetURL)
 	}
 
 	return shortURL, nil
@@ -93,113 +252,234 @@ func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, erro
 
 // GetURL возвращает полный URL по заданному короткому URL.
 func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	fullURL, schedule, err := s.GetURLSchedule(ctx, shortURL)
+	if err != nil {
+		return "", err
+	}
+	if err = storage.CheckSchedule(schedule, time.Now()); err != nil {
+		return "", err
+	}
+	return fullURL, nil
+}
+
+// GetURLSchedule возвращает полный URL и срок действия ссылки.
+func (s *Storage) GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error) {
+	link, err := readFrom(ctx, s, shortURL, func(db *pgxpool.Pool) (models.Link, error) {
+		return getURL(ctx, db, shortURL)
+	})
+	return link.OriginalURL, link.Schedule, err
+}
+
+// getURL возвращает полный URL и срок действия ссылки по заданному короткому URL
+// из базы данных db.
+func getURL(ctx context.Context, db *pgxpool.Pool, shortURL string) (models.Link, error) {
 	var (
-		fullURL   string
-		isDeleted bool
+		fullURL               string
+		isDeleted             bool
+		activeFrom, expiresAt *time.Time
 	)
-	row := s.pool.QueryRow(ctx, `SELECT full_url, is_deleted FROM url WHERE short_url = $1`, shortURL)
-	err := row.Scan(&fullURL, &isDeleted)
+	row := db.QueryRow(ctx, `
+		SELECT full_url, is_deleted, active_from, expires_at FROM url WHERE short_url = $1
+	`, shortURL)
+	err := row.Scan(&fullURL, &isDeleted, &activeFrom, &expiresAt)
 	if err != nil {
 		// Если URL не найден, возвращаем соответствующую ошибку
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrURLNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Link{}, storage.ErrNotFound
 		}
-		// Для других ошибок возвращаем их напрямую
-		return "", err
+		logger.Log.Sugar().Errorf("Не удалось получить url: %s", err)
+		return models.Link{}, classifyError(err, ErrGetURL)
 	}
 
 	// Проверяем, помечен ли URL как удаленный
 	if isDeleted {
-		return "", ErrURLDeleted
+		return models.Link{}, storage.ErrGone
 	}
 
-	return fullURL, nil
+	return models.Link{OriginalURL: fullURL, Schedule: models.NewSchedule(activeFrom, expiresAt)}, nil
 }
 
-// Init выполняет инициализацию хранилища, включая создание необходимых таблиц.
+// Init выполняет инициализацию хранилища: ждёт доступности базы данных
+// и применяет к ней все встроенные миграции схемы, которые ещё не были применены.
 func (s *Storage) Init() error {
-	ctx := context.Background()
-	txOptions := pgx.TxOptions{}
-
-	tx, err := s.pool.BeginTx(ctx, txOptions)
-	if err != nil {
-		logger.Log.Sugar().Errorf("Не удалось создать таблицу: %s", err)
-		return ErrCreateTable
+	if err := s.waitForDB(); err != nil {
+		return err
 	}
 
-	defer func() {
-		if err = tx.Rollback(ctx); err != nil && err != sql.ErrTxDone {
-			logger.Log.Sugar().Errorf("Ошибка при откате транзакции: %v", err)
-		}
-	}()
-
-	_, err = tx.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS url (
-			"id" SERIAL PRIMARY KEY,
-			"full_url" VARCHAR(250) NOT NULL,
-			"short_url" VARCHAR(250) NOT NULL,
-			"created" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			"user_id" UUID NOT NULL,
-			"is_deleted" BOOLEAN DEFAULT FALSE
-		);
-    `)
+	migrator, err := newMigrator(s.pool)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Ошибка при создании таблицы: %s", err)
-		return ErrCreateTable
+		return err
 	}
 
-	_, err = tx.Exec(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_full_url_unique ON url(full_url);`)
-	if err != nil {
-		logger.Log.Sugar().Errorf("Ошибка при создании индекса: %s", err)
-		return ErrCreateTable
+	if _, err = migrator.Up(context.Background(), 0); err != nil {
+		return classifyError(err, ErrMigrate)
 	}
-	return tx.Commit(ctx)
+	return nil
 }
 
 // Ping проверяет состояние соединения с базой данных.
 func (s *Storage) Ping(ctx context.Context) error {
 	if err := s.pool.Ping(ctx); err != nil {
-		return ErrPing
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, ErrPing)
 	}
 	return nil
 }
 
+// Close закрывает пулы соединений с базой данных и репликами.
+func (s *Storage) Close() error {
+	s.replicas.close()
+	s.pool.Close()
+	return nil
+}
+
+// bulkChunkSize - количество ссылок, передаваемых BulkSaveURL во временную таблицу за раз.
+const bulkChunkSize = 5000
+
 // BulkSaveURL выполняет массовое сохранение данных о URL для указанного пользователя.
-func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// Ссылки передаются через COPY во временную таблицу и переносятся в url с ON CONFLICT,
+// поэтому размер пакета не ограничен количеством параметров запроса, а уже сохранённые
+// полные URL не прерывают сохранение остальных. Большие пакеты передаются частями
+// по bulkChunkSize ссылок, но все части сохраняются в одной транзакции: при ошибке
+// не сохраняется ни одна ссылка пакета.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	s.touchWriter(userID)
+	for _, d := range data {
+		s.touchLinks(d.ShortURL, d.OriginalURL)
+	}
+	batch := storage.NewBulkBatch(data)
+	err := s.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `
+				CREATE TEMPORARY TABLE bulk_url (
+					idx INTEGER NOT NULL,
+					full_url TEXT NOT NULL,
+					short_url TEXT NOT NULL,
+					active_from TIMESTAMPTZ,
+					expires_at TIMESTAMPTZ
+				) ON COMMIT DROP`)
+			if err != nil {
+				return err
+			}
+			for start := 0; start < len(batch.Unique); start += bulkChunkSize {
+				chunk := batch.Unique[start:min(start+bulkChunkSize, len(batch.Unique))]
+				if err = bulkSaveChunk(ctx, tx, batch, chunk, userID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		if isShortURLCollision(err) {
+			// короткий URL заняли параллельно между проверкой и вставкой
+			return nil, storage.ErrShortURLCollision
+		}
+		logger.Log.Sugar().Errorf("Не удалось сохранить url: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
 
-	// Проверка на пустой слайс
-	if len(data) == 0 {
-		return nil
+	return batch.Finish(), nil
+}
+
+// bulkSaveChunk сохраняет ссылки пакета с индексами chunk и заполняет их результаты.
+// Временная таблица bulk_url очищается перед каждой частью пакета.
+func bulkSaveChunk(ctx context.Context, tx pgx.Tx, batch *storage.BulkBatch, chunk []int, userID string) error {
+	if _, err := tx.Exec(ctx, `TRUNCATE bulk_url`); err != nil {
+		return err
 	}
 
-	// Начало подготовки запроса
-	valueStrings := make([]string, 0, len(data))
-	valueArgs := make([]interface{}, 0, len(data)*2)
-	for i, d := range data {
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d)", i*3+1, i*3+2, i*3+3))
-		valueArgs = append(valueArgs, d.OriginalURL, d.ShortURL, userID)
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"bulk_url"}, []string{"idx", "full_url", "short_url", "active_from", "expires_at"},
+		pgx.CopyFromSlice(len(chunk), func(i int) ([]any, error) {
+			d := batch.Data[chunk[i]]
+			return []any{chunk[i], d.OriginalURL, d.ShortURL, timeOrNil(d.ActiveFrom), timeOrNil(d.ExpiresAt)}, nil
+		}))
+	if err != nil {
+		return err
 	}
 
-	// Формирование и выполнение запроса
-	stmt := fmt.Sprintf("INSERT INTO url (full_url, short_url, user_id) VALUES %s", strings.Join(valueStrings, ","))
-	_, err := s.pool.Exec(ctx, stmt, valueArgs...)
+	err = releaseExpired(ctx, tx, `
+		UPDATE url u SET is_deleted = true FROM bulk_url b
+		WHERE md5(u.full_url) = md5(b.full_url) AND u.full_url = b.full_url
+			AND NOT u.is_deleted AND u.expires_at <= now()
+		RETURNING u.short_url`)
 	if err != nil {
-		logger.Log.Sugar().Errorf("Не удалось сохранить url: %s", err)
-		return ErrSaveURL
+		return err
+	}
+
+	// ссылки с занятым коротким URL не вставляются, чтобы не прерывать весь пакет;
+	// строки вставляются в порядке md5 полного URL, чтобы параллельные пакеты с общими
+	// ссылками ждали друг друга на уникальном индексе в одном порядке, а не взаимно блокировались
+	rows, err := tx.Query(ctx, `
+		INSERT INTO url (full_url, short_url, user_id, active_from, expires_at)
+		SELECT b.full_url, b.short_url, $1, b.active_from, b.expires_at FROM bulk_url b
+		WHERE NOT EXISTS (SELECT 1 FROM url u WHERE u.short_url = b.short_url)
+		ORDER BY md5(b.full_url)
+		ON CONFLICT ((md5(full_url))) WHERE NOT is_deleted DO NOTHING
+		RETURNING short_url`, userID)
+	if err != nil {
+		return err
+	}
+	created, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	createdSet := make(map[string]struct{}, len(created))
+	for _, shortURL := range created {
+		createdSet[shortURL] = struct{}{}
 	}
 
+	// короткие URL всех ссылок пакета, которые теперь сохранены: новых и существующих
+	rows, err = tx.Query(ctx, `
+		SELECT b.idx, u.short_url FROM bulk_url b
+		JOIN url u ON md5(u.full_url) = md5(b.full_url) AND u.full_url = b.full_url AND NOT u.is_deleted`)
+	if err != nil {
+		return err
+	}
+	saved := make(map[int]string, len(chunk))
+	var (
+		idx      int
+		shortURL string
+	)
+	_, err = pgx.ForEachRow(rows, []any{&idx, &shortURL}, func() error {
+		saved[idx] = shortURL
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range chunk {
+		shortURL, ok := saved[i]
+		_, isCreated := createdSet[shortURL]
+		switch {
+		case !ok:
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCollision}
+		case isCreated:
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCreated, ShortURL: shortURL}
+		default:
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveExisting, ShortURL: shortURL}
+		}
+	}
 	return nil
 }
 
 // GetUserURLs возвращает список URL, созданных пользователем.
 func (s *Storage) GetUserURLs(ctx context.Context, baseURL string, userID string) ([]models.UserURLS, error) {
+	if s.isRecentWriter(userID) {
+		return getUserURLs(ctx, s.pool, baseURL, userID)
+	}
+	return readFrom(ctx, s, "", func(db *pgxpool.Pool) ([]models.UserURLS, error) {
+		return getUserURLs(ctx, db, baseURL, userID)
+	})
+}
+
+// getUserURLs возвращает список URL, созданных пользователем, из базы данных db.
+func getUserURLs(ctx context.Context, db *pgxpool.Pool, baseURL string, userID string) ([]models.UserURLS, error) {
 	var urls []models.UserURLS
-	rows, err := s.pool.Query(ctx, `SELECT short_url, full_url FROM url WHERE user_id = $1`, userID)
+	rows, err := db.Query(ctx, `SELECT short_url, full_url FROM url WHERE user_id = $1`, userID)
 	if err != nil {
 		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
-		return nil, ErrGetURL
+		return nil, classifyError(err, ErrGetURL)
 	}
 	defer rows.Close()
 
@@ -216,7 +496,7 @@ func (s *Storage) GetUserURLs(ctx context.Context, baseURL string, userID string
 	// Проверяем наличие ошибок после завершения перебора
 	if err = rows.Err(); err != nil {
 		logger.Log.Sugar().Errorf("Ошибка: %s", err)
-		return nil, ErrSRows
+		return nil, classifyError(err, ErrSRows)
 	}
 
 	return urls, nil
@@ -236,6 +516,8 @@ func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListU
 	)
 
 	for _, message := range messages {
+		s.touchWriter(message.UserID)
+		s.touchLinks(message.URLS...)
 		for _, url := range message.URLS {
 			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d)", argCounter, argCounter+1))
 			args = append(args, url, message.UserID)
@@ -247,29 +529,185 @@ func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListU
 		return nil // Нет URL для обновления
 	}
 
-	query := fmt.Sprintf(`UPDATE url SET is_deleted = true WHERE (short_url, user_id) IN (%s)`,
+	query := fmt.Sprintf(`
+		UPDATE url SET is_deleted = true
+		WHERE (short_url, user_id) IN (%s) AND NOT is_deleted
+		RETURNING short_url`,
 		strings.Join(placeholders, ", "))
 
-	_, err := s.pool.Exec(ctx, query, args...)
+	// удалённые ссылки публикуются в той же транзакции, чтобы остальные
+	// экземпляры приложения сбросили их в своих кешах
+	err := s.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+			if err != nil {
+				return err
+			}
+			return notifyChanges(ctx, tx, storage.ChangeDelete, deleted)
+		})
+	})
 	if err != nil {
 		logger.Log.Sugar().Errorf("Не удалось выполнить обновление: %s", err)
-		return ErrUpdateURL
+		return classifyError(err, ErrUpdateURL)
 	}
 
 	return nil
 }
 
+// ExpireURLs помечает удалёнными не более limit ссылок с истёкшим сроком действия
+// и возвращает их короткие URL. Строки, которые помечает другой экземпляр приложения,
+// пропускаются, поэтому несколько экземпляров могут помечать ссылки одновременно.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	var expired []string
+	// истёкшие ссылки публикуются в той же транзакции, чтобы остальные
+	// экземпляры приложения сбросили их в своих кешах
+	err := s.withRetry(ctx, func() error {
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+				UPDATE url SET is_deleted = true
+				WHERE id IN (
+					SELECT id FROM url
+					WHERE expires_at <= now() AND NOT is_deleted
+					LIMIT $1
+					FOR UPDATE SKIP LOCKED
+				)
+				RETURNING short_url`, limit)
+			if err != nil {
+				return err
+			}
+			expired, err = pgx.CollectRows(rows, pgx.RowTo[string])
+			if err != nil {
+				return err
+			}
+			return notifyChanges(ctx, tx, storage.ChangeExpire, expired)
+		})
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось пометить истёкшие ссылки: %s", err)
+		return nil, classifyError(err, ErrUpdateURL)
+	}
+	s.touchLinks(expired...)
+	return expired, nil
+}
+
 // GetServiceStats получает статистику сервиса.
 func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
+	return readFrom(ctx, s, "", func(db *pgxpool.Pool) (models.ServiceStat, error) {
+		return getServiceStats(ctx, db)
+	})
+}
+
+// getServiceStats получает статистику сервиса из базы данных db.
+func getServiceStats(ctx context.Context, db *pgxpool.Pool) (models.ServiceStat, error) {
 	var (
 		URLS  int
 		Users int
 	)
-	row := s.pool.QueryRow(ctx, `SELECT COUNT(full_url), COUNT(DISTINCT user_id) FROM url;`)
+	row := db.QueryRow(ctx, `SELECT COUNT(full_url), COUNT(DISTINCT user_id) FROM url;`)
 	err := row.Scan(&URLS, &Users)
 	if err != nil {
-		return models.ServiceStat{}, err
+		return models.ServiceStat{}, classifyError(err, ErrGetURL)
 	}
 
 	return models.ServiceStat{URLS: URLS, Users: Users}, nil
 }
+
+// UserSketch возвращает оценку HyperLogLog пользователей, у которых есть ссылки.
+// Регистры считаются в базе данных, поэтому передаётся не больше hll.Registers строк.
+func (s *Storage) UserSketch(ctx context.Context) (hll.Sketch, error) {
+	return readFrom(ctx, s, "", func(db *pgxpool.Pool) (hll.Sketch, error) {
+		// младшие hll.Precision бит хеша выбирают регистр, ранг считается по остальным 18 битам
+		rows, err := db.Query(ctx, `
+			SELECT h & ($1 - 1), max(19 - length(ltrim(((h::bigint & 4294967295) >> $2)::bit(18)::text, '0')))
+			FROM (SELECT hashtext(user_id::text) AS h FROM url) AS hashes
+			GROUP BY 1
+		`, hll.Registers, hll.Precision)
+		if err != nil {
+			return nil, classifyError(err, ErrGetURL)
+		}
+		sketch := hll.New()
+		var register, rank int
+		_, err = pgx.ForEachRow(rows, []any{&register, &rank}, func() error {
+			sketch.Set(register, uint8(rank))
+			return nil
+		})
+		if err != nil {
+			return nil, classifyError(err, ErrScanRows)
+		}
+		return sketch, nil
+	})
+}
+
+// timeOrNil возвращает nil для нулевого времени, чтобы в базу данных попал NULL.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// isConflict проверяет, что ошибка вызвана нарушением ограничения уникальности.
+func isConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code)
+}
+
+// shortURLIndex - имя уникального индекса по короткому URL, по которому
+// коллизия короткого URL отличается от конфликта полного URL.
+const shortURLIndex = "idx_url_short_url_unique"
+
+// isShortURLCollision проверяет, что ошибка вызвана повторным использованием короткого URL.
+func isShortURLCollision(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == shortURLIndex
+}
+
+// classifyError возвращает storage.ErrUnavailable, если ошибка вызвана потерей
+// соединения с базой данных, storage.ErrTimeout, если запрос не уложился в отведённое
+// время, и fallback во всех остальных случаях.
+func classifyError(err error, fallback error) error {
+	switch {
+	case isConnectionFailure(err):
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, fallback)
+	case isUnavailable(err):
+		return fmt.Errorf("%w: %w", storage.ErrTimeout, fallback)
+	}
+	return fallback
+}
+
+// isUnavailable проверяет, что ошибка связана с соединением с базой данных
+// или таймаутом, а не с самим запросом.
+func isUnavailable(err error) bool {
+	if isConnectionFailure(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		pgconn.Timeout(err) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// isConnectionFailure проверяет, что соединение с базой данных не удалось установить
+// или оно потеряно. Таймауты запросов и ожидания соединения из пула к ним не относятся.
+func isConnectionFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) ||
+			pgErr.Code == pgerrcode.AdminShutdown ||
+			pgErr.Code == pgerrcode.CrashShutdown ||
+			pgErr.Code == pgerrcode.CannotConnectNow ||
+			pgErr.Code == pgerrcode.TooManyConnections
+	}
+
+	// ошибки установки соединения, в том числе по таймауту, оборачивают dialError
+	var dialErr *dialError
+	if errors.As(err, &dialErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
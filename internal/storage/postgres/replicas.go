@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+const (
+	// defaultReplicaCheckInterval - период проверки доступности реплик по умолчанию.
+	defaultReplicaCheckInterval = 5 * time.Second
+	// readYourWritesWindow - время после изменения ссылок, в течение которого эти ссылки
+	// и список ссылок изменившего их пользователя читаются с основного сервера,
+	// чтобы реплика успела догнать изменения.
+	readYourWritesWindow = 5 * time.Second
+)
+
+// replica - пул соединений с репликой и признак её доступности.
+type replica struct {
+	pool    *pgxpool.Pool
+	host    string
+	healthy atomic.Bool
+}
+
+// replicaSet распределяет чтения по доступным репликам по кругу и периодически
+// проверяет их доступность. Недоступная реплика исключается до следующей успешной проверки.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// newReplicaSet создаёт пулы соединений с репликами. Соединения устанавливаются
+// при первом запросе, поэтому до первой проверки реплики считаются доступными.
+func newReplicaSet(dsns []string, cfg *config.Config) (*replicaSet, error) {
+	set := &replicaSet{}
+	for _, dsn := range dsns {
+		pool, err := newPool(dsn, cfg)
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+		r := &replica{pool: pool, host: pool.Config().ConnConfig.Host}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+	return set, nil
+}
+
+// pick возвращает следующую доступную реплику или nil, если доступных реплик нет.
+func (s *replicaSet) pick() *replica {
+	if s == nil {
+		return nil
+	}
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// markDown исключает реплику до следующей успешной проверки.
+func (s *replicaSet) markDown(r *replica) {
+	if r.healthy.Swap(false) {
+		logger.Log.Sugar().Warnf("реплика %s недоступна, чтения переключены", r.host)
+	}
+}
+
+// run проверяет доступность реплик каждые interval до вызова close.
+// Вызов onTick после каждой проверки используется для служебных задач хранилища.
+func (s *replicaSet) run(interval time.Duration, onTick func()) {
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.check(ctx, interval)
+				onTick()
+			}
+		}
+	}()
+}
+
+// check проверяет доступность всех реплик параллельно.
+func (s *replicaSet) check(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if err := r.pool.Ping(pingCtx); err != nil {
+				s.markDown(r)
+				return
+			}
+			if !r.healthy.Swap(true) {
+				logger.Log.Sugar().Infof("реплика %s снова доступна", r.host)
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// close останавливает проверки и закрывает пулы соединений с репликами.
+func (s *replicaSet) close() {
+	if s == nil {
+		return
+	}
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+)
+
+func TestReplicaSetPick(t *testing.T) {
+	// соединения с репликами устанавливаются только при первом запросе
+	set, err := newReplicaSet([]string{
+		"postgres://postgres@127.0.0.1:1/replica1",
+		"postgres://postgres@127.0.0.2:1/replica2",
+	}, &config.Config{DBMaxConns: 2})
+	require.NoError(t, err)
+	defer set.close()
+
+	// настройки пула из конфигурации применяются и к репликам
+	assert.EqualValues(t, 2, set.replicas[0].pool.Config().MaxConns)
+
+	// чтения распределяются по кругу
+	first, second := set.pick(), set.pick()
+	assert.NotSame(t, first, second)
+	assert.Same(t, first, set.pick())
+
+	// недоступная реплика пропускается
+	set.markDown(first)
+	for i := 0; i < 3; i++ {
+		assert.Same(t, second, set.pick())
+	}
+
+	// без доступных реплик чтения выполняются на основном сервере
+	set.markDown(second)
+	assert.Nil(t, set.pick())
+
+	var empty *replicaSet
+	assert.Nil(t, empty.pick())
+}
+
+func TestRecentLinks(t *testing.T) {
+	set, err := newReplicaSet([]string{"postgres://postgres@127.0.0.1:1/replica"}, &config.Config{})
+	require.NoError(t, err)
+	defer set.close()
+	s := &Storage{replicas: set}
+
+	// с основного сервера читаются только недавно изменённые ссылки
+	s.touchLinks("sdReka", "https://practicum.yandex.ru/")
+	assert.True(t, s.isRecentLink("sdReka"))
+	assert.True(t, s.isRecentLink("https://practicum.yandex.ru/"))
+	assert.False(t, s.isRecentLink("unknown"))
+
+	readDB := func(link string) *pgxpool.Pool {
+		db, err := readFrom(context.Background(), s, link, func(db *pgxpool.Pool) (*pgxpool.Pool, error) {
+			return db, nil
+		})
+		require.NoError(t, err)
+		return db
+	}
+	assert.Nil(t, readDB("sdReka"))
+	assert.Same(t, set.replicas[0].pool, readDB("unknown"))
+
+	// устаревшие отметки удаляются
+	s.recentLinks.Store("sdReka", time.Now().Add(-readYourWritesWindow))
+	s.forgetWriters()
+	assert.False(t, s.isRecentLink("sdReka"))
+	_, ok := s.recentLinks.Load("sdReka")
+	assert.False(t, ok)
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// ReserveSequence резервирует n порядковых номеров в таблице short_url_sequence
+// и возвращает первый из них. Обновление строки счётчика блокирует её до конца
+// запроса, поэтому экземпляры приложения получают непересекающиеся диапазоны.
+func (s *Storage) ReserveSequence(ctx context.Context, n uint64) (uint64, error) {
+	var start int64
+	err := s.pool.QueryRow(ctx, `
+		UPDATE short_url_sequence SET "next" = "next" + $1 RETURNING "next" - $1
+	`, int64(n)).Scan(&start)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось зарезервировать порядковые номера: %s", err)
+		return 0, classifyError(err, ErrReserveSequence)
+	}
+	return uint64(start), nil
+}
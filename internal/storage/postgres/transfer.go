@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+)
+
+// ScanLinks возвращает не более limit ссылок с короткими URL больше after
+// в порядке возрастания короткого URL. Используется для переноса ссылок между шардами.
+func (s *Storage) ScanLinks(ctx context.Context, after string, limit int) ([]models.Link, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT short_url, full_url, user_id::text, is_deleted, COALESCE(created, now()::timestamp),
+			active_from, expires_at
+		FROM url
+		WHERE short_url > $1
+		ORDER BY short_url
+		LIMIT $2
+	`, after, limit)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить ссылки: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Link, error) {
+		var (
+			link                  models.Link
+			activeFrom, expiresAt *time.Time
+		)
+		err := row.Scan(&link.ShortURL, &link.OriginalURL, &link.UserID, &link.IsDeleted, &link.Created, &activeFrom, &expiresAt)
+		link.Schedule = models.NewSchedule(activeFrom, expiresAt)
+		return link, err
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось прочитать ссылки: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return links, nil
+}
+
+// ImportLinks сохраняет перенесённые ссылки как есть, пропуская ссылки,
+// короткий или полный URL которых уже занят. Возвращает короткие URL сохранённых ссылок.
+func (s *Storage) ImportLinks(ctx context.Context, links []models.Link) ([]string, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	var (
+		shortURLs = make([]string, 0, len(links))
+		fullURLs  = make([]string, 0, len(links))
+		userIDs   = make([]string, 0, len(links))
+		deleted   = make([]bool, 0, len(links))
+		created   = make([]time.Time, 0, len(links))
+		active    = make([]*time.Time, 0, len(links))
+		expires   = make([]*time.Time, 0, len(links))
+	)
+	for _, link := range links {
+		s.touchLinks(link.ShortURL, link.OriginalURL)
+		shortURLs = append(shortURLs, link.ShortURL)
+		fullURLs = append(fullURLs, link.OriginalURL)
+		userIDs = append(userIDs, link.UserID)
+		deleted = append(deleted, link.IsDeleted)
+		created = append(created, link.Created)
+		active = append(active, timeOrNil(link.ActiveFrom))
+		expires = append(expires, timeOrNil(link.ExpiresAt))
+	}
+
+	var imported []string
+	err := s.withRetry(ctx, func() error {
+		rows, err := s.pool.Query(ctx, `
+			INSERT INTO url (short_url, full_url, user_id, is_deleted, created, active_from, expires_at)
+			SELECT l.short_url, l.full_url, l.user_id::uuid, l.is_deleted, l.created, l.active_from, l.expires_at
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::boolean[], $5::timestamp[],
+				$6::timestamptz[], $7::timestamptz[])
+				AS l(short_url, full_url, user_id, is_deleted, created, active_from, expires_at)
+			ON CONFLICT DO NOTHING
+			RETURNING short_url
+		`, shortURLs, fullURLs, userIDs, deleted, created, active, expires)
+		if err != nil {
+			return err
+		}
+		imported, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось сохранить перенесённые ссылки: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
+	return imported, nil
+}
+
+// RemoveLinks безвозвратно удаляет ссылки, перенесённые на другой шард, если признак
+// удаления ссылки не изменился с момента её чтения. Возвращает короткие URL удалённых ссылок.
+func (s *Storage) RemoveLinks(ctx context.Context, links []models.Link) ([]string, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	shortURLs := make([]string, 0, len(links))
+	deleted := make([]bool, 0, len(links))
+	for _, link := range links {
+		shortURLs = append(shortURLs, link.ShortURL)
+		deleted = append(deleted, link.IsDeleted)
+	}
+
+	var removed []string
+	err := s.withRetry(ctx, func() error {
+		rows, err := s.pool.Query(ctx, `
+			DELETE FROM url u
+			USING unnest($1::text[], $2::boolean[]) AS l(short_url, is_deleted)
+			WHERE u.short_url = l.short_url AND u.is_deleted = l.is_deleted
+			RETURNING u.short_url
+		`, shortURLs, deleted)
+		if err != nil {
+			return err
+		}
+		removed, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
+	})
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось удалить перенесённые ссылки: %s", err)
+		return nil, classifyError(err, ErrUpdateURL)
+	}
+	return removed, nil
+}
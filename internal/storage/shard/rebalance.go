@@ -0,0 +1,213 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+const (
+	// rebalanceBatch - количество ссылок, читаемых с шарда за один запрос при переносе.
+	rebalanceBatch = 1000
+	// rebalanceTimeout ограничивает время переноса одной пачки ссылок.
+	rebalanceTimeout = time.Minute
+)
+
+// Rebalance переносит ссылки, лежащие не на своих шардах, пока не будет закрыт
+// stopChan. Первый перенос выполняется сразу после запуска, при ошибках и ссылках,
+// которые не удалось перенести, перенос повторяется каждые interval. Когда обход
+// всех шардов переносит все найденные ссылки, хранилище перестаёт искать ссылки
+// и удалять их на чужих шардах. Если interval не задан, перенос не выполняется.
+//
+// wg *sync.WaitGroup: группа ожидания для синхронизации завершения горутины.
+func (s *Storage) Rebalance(wg *sync.WaitGroup, stopChan chan int64) {
+	defer wg.Done()
+
+	if s.interval <= 0 || len(s.shards) < 2 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if s.rebalancing.Load() {
+			moved, skipped, err := s.rebalance(stopChan)
+			switch {
+			case err != nil:
+				logger.Log.Sugar().Errorf("Не удалось перенести ссылки между шардами: %s", err)
+			case skipped > 0:
+				logger.Log.Sugar().Warnf("Перенесено ссылок между шардами: %d, не удалось перенести: %d", moved, skipped)
+			default:
+				logger.Log.Sugar().Infof("Перенесено ссылок между шардами: %d, все ссылки лежат на своих шардах", moved)
+				s.rebalancing.Store(false)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// rebalance обходит все шарды и переносит ссылки на их шарды. Возвращает количество
+// перенесённых ссылок и ссылок, которые не удалось перенести, так как их короткий
+// или полный URL уже занят на целевом шарде.
+func (s *Storage) rebalance(stopChan chan int64) (moved, skipped int, err error) {
+	for index, shard := range s.shards {
+		source, ok := storage.As[storage.LinkTransfer](shard)
+		if !ok {
+			continue
+		}
+
+		after := ""
+		for {
+			select {
+			case <-stopChan:
+				return moved, skipped, nil
+			default:
+			}
+
+			links, err := s.moveBatch(index, source, after)
+			if err != nil {
+				return moved, skipped, err
+			}
+			moved += links.moved
+			skipped += links.skipped
+			if links.scanned < rebalanceBatch {
+				break
+			}
+			after = links.last
+		}
+	}
+	return moved, skipped, nil
+}
+
+// batchResult описывает результат переноса одной пачки ссылок.
+type batchResult struct {
+	scanned int    // Количество прочитанных ссылок.
+	moved   int    // Количество перенесённых ссылок.
+	skipped int    // Количество ссылок, которые не удалось перенести.
+	last    string // Короткий URL последней прочитанной ссылки.
+}
+
+// moveBatch читает пачку ссылок с шарда index после короткого URL after
+// и переносит ссылки, которые принадлежат другим шардам.
+func (s *Storage) moveBatch(index int, source storage.LinkTransfer, after string) (batchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rebalanceTimeout)
+	defer cancel()
+
+	links, err := source.ScanLinks(ctx, after, rebalanceBatch)
+	if err != nil {
+		return batchResult{}, err
+	}
+	result := batchResult{scanned: len(links)}
+	if len(links) == 0 {
+		return result, nil
+	}
+	result.last = links[len(links)-1].ShortURL
+
+	misplaced := make(map[int][]models.Link)
+	for _, link := range links {
+		if target := owner(link.ShortURL, len(s.shards)); target != index {
+			misplaced[target] = append(misplaced[target], link)
+		}
+	}
+
+	for target, targetLinks := range misplaced {
+		dest, ok := storage.As[storage.LinkTransfer](s.shards[target])
+		if !ok {
+			result.skipped += len(targetLinks)
+			continue
+		}
+		// ссылка удаляется с исходного шарда только после сохранения на целевом,
+		// поэтому при ошибке она остаётся доступной и переносится при следующем обходе
+		imported, err := dest.ImportLinks(ctx, targetLinks)
+		if err != nil {
+			return result, err
+		}
+		done := s.alreadyMoved(ctx, target, targetLinks, imported)
+		removed, err := s.removeMoved(ctx, source, target, done)
+		if err != nil {
+			return result, err
+		}
+		result.moved += len(removed)
+		result.skipped += len(targetLinks) - len(removed)
+	}
+	return result, nil
+}
+
+// removeMoved удаляет с исходного шарда ссылки links, сохранённые на шарде target.
+// Ссылки, удалённые пользователем после чтения с исходного шарда, могли попасть
+// на целевой шард неудалёнными, поэтому удаление сначала повторяется на целевом шарде.
+// Возвращает короткие URL ссылок, удалённых с исходного шарда.
+func (s *Storage) removeMoved(ctx context.Context, source storage.LinkTransfer, target int, links []models.Link) ([]string, error) {
+	removed, err := source.RemoveLinks(ctx, links)
+	if err != nil || len(removed) == len(links) {
+		return removed, err
+	}
+
+	done := make(map[string]struct{}, len(removed))
+	for _, shortURL := range removed {
+		done[shortURL] = struct{}{}
+	}
+	var (
+		changed  []models.Link
+		messages []models.UserListURLForDelete
+	)
+	byUser := make(map[string]int)
+	for _, link := range links {
+		if _, ok := done[link.ShortURL]; ok || link.IsDeleted {
+			continue
+		}
+		link.IsDeleted = true
+		changed = append(changed, link)
+		index, ok := byUser[link.UserID]
+		if !ok {
+			index = len(messages)
+			byUser[link.UserID] = index
+			messages = append(messages, models.UserListURLForDelete{UserID: link.UserID})
+		}
+		messages[index].URLS = append(messages[index].URLS, link.ShortURL)
+	}
+	if len(changed) == 0 {
+		return removed, nil
+	}
+
+	if err = s.shards[target].DeleteListURL(ctx, messages); err != nil {
+		return removed, err
+	}
+	again, err := source.RemoveLinks(ctx, changed)
+	return append(removed, again...), err
+}
+
+// alreadyMoved возвращает ссылки, сохранённые на шарде target: импортированные
+// и уже бывшие на нём, например если предыдущий перенос прервался после
+// сохранения ссылок, но до их удаления с исходного шарда.
+func (s *Storage) alreadyMoved(ctx context.Context, target int, links []models.Link, imported []string) []models.Link {
+	done := make(map[string]struct{}, len(imported))
+	for _, shortURL := range imported {
+		done[shortURL] = struct{}{}
+	}
+
+	moved := make([]models.Link, 0, len(links))
+	for _, link := range links {
+		if _, ok := done[link.ShortURL]; ok {
+			moved = append(moved, link)
+			continue
+		}
+		stored, err := readLink(ctx, s.shards[target], link.ShortURL)
+		if (err == nil && !link.IsDeleted && stored.OriginalURL == link.OriginalURL) ||
+			(errors.Is(err, storage.ErrGone) && link.IsDeleted) {
+			moved = append(moved, link)
+		}
+	}
+	return moved
+}
@@ -0,0 +1,32 @@
+package shard
+
+import "hash/fnv"
+
+// owner возвращает индекс шарда, которому принадлежит короткий URL, среди n шардов.
+//
+// Шард выбирается рендеву-хешированием: у каждого шарда свой вес для короткого URL,
+// ссылка принадлежит шарду с наибольшим весом. При добавлении шарда в конец списка
+// владелец меняется только у ссылок, которые переходят на новый шард.
+func owner(shortURL string, n int) int {
+	h := fnv.New64a()
+	// запись в hash.Hash не возвращает ошибок
+	_, _ = h.Write([]byte(shortURL))
+	key := h.Sum64()
+
+	best, bestScore := 0, uint64(0)
+	for i := 0; i < n; i++ {
+		if s := score(key, i); i == 0 || s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	return best
+}
+
+// score возвращает вес шарда index для хеша короткого URL. Хеш перемешивается
+// финализатором splitmix64, чтобы веса соседних шардов не зависели друг от друга.
+func score(key uint64, index int) uint64 {
+	x := key ^ (uint64(index+1) * 0x9e3779b97f4a7c15)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
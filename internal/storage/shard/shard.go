@@ -0,0 +1,577 @@
+// Package shard реализует хранилище URL, распределяющее ссылки между несколькими хранилищами.
+package shard
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/hll"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// возможные ошибки пакета
+var (
+	// ErrNoShards описывает ошибку создания хранилища без шардов.
+	ErrNoShards = errors.New("no shards configured")
+)
+
+// Storage распределяет ссылки между шардами по хешу короткого URL. Переходы и
+// сохранение ссылки обращаются к одному шарду, списки ссылок пользователя и
+// статистика собираются со всех шардов.
+//
+// Полный URL уникален в пределах шарда. SaveURL и BulkSaveURL перед сохранением
+// ищут полный URL на всех шардах под блокировкой полного URL на первом шарде,
+// поэтому одновременное сохранение одного полного URL на разных шардах не создаёт
+// двух ссылок. Первый шард выбран потому, что новые шарды добавляются в конец списка.
+//
+// Новые шарды добавляются в конец списка, после чего Rebalance переносит на них
+// ссылки. Пока перенос не завершён, ссылка, не найденная на своём шарде, ищется
+// на остальных, удаление ссылок выполняется на всех шардах, а короткий URL новой
+// ссылки не должен быть занят и на остальных шардах. Если перенос отключен,
+// хранилище не знает, добавлялись ли шарды, поэтому работает так всегда.
+type Storage struct {
+	shards      []storage.StorageProvider
+	interval    time.Duration
+	rebalancing atomic.Bool // Ссылки могут лежать не на своих шардах.
+}
+
+// New создаёт хранилище над шардами shards. До завершения первого переноса
+// ссылок хранилище считает, что ссылки могут лежать не на своих шардах.
+func New(shards []storage.StorageProvider, cfg *config.Config) (*Storage, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	s := &Storage{shards: shards, interval: cfg.ShardRebalanceInterval}
+	s.rebalancing.Store(len(shards) > 1)
+	return s, nil
+}
+
+// owner возвращает шард, которому принадлежит короткий URL.
+func (s *Storage) owner(shortURL string) storage.StorageProvider {
+	return s.shards[owner(shortURL, len(s.shards))]
+}
+
+// fanOut параллельно выполняет fn на всех шардах и возвращает результаты и ошибки
+// в порядке шардов.
+func fanOut[T any](shards []storage.StorageProvider, fn func(index int, shard storage.StorageProvider) (T, error)) ([]T, []error) {
+	results := make([]T, len(shards))
+	errs := make([]error, len(shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard storage.StorageProvider) {
+			defer wg.Done()
+			results[i], errs[i] = fn(i, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// SaveURL сохраняет ссылку на шарде её короткого URL. Если полный URL уже
+// сохранён на любом шарде, возвращается storage.ConflictError.
+func (s *Storage) SaveURL(ctx context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error {
+	unlock, err := s.lockFullURLs(ctx, []string{fullURL})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, err := s.findShortURLs(ctx, []string{fullURL})
+	if err != nil {
+		return err
+	}
+	if existingURL, ok := existing[fullURL]; ok {
+		return &storage.ConflictError{ShortURL: existingURL}
+	}
+
+	taken, err := s.takenElsewhere(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return storage.ErrShortURLCollision
+	}
+	return s.owner(shortURL).SaveURL(ctx, fullURL, shortURL, userID, schedule)
+}
+
+// takenElsewhere проверяет, занят ли короткий URL на шардах, кроме его собственного.
+// Пока перенос ссылок не завершён, ссылка с этим коротким URL может лежать на прежнем
+// шарде, и новая ссылка на собственном шарде её бы скрыла. Ссылка всегда лежит на
+// прежнем шарде или уже на собственном, поэтому проверка перед сохранением не
+// пропускает ссылку, которую переносят в это время.
+func (s *Storage) takenElsewhere(ctx context.Context, shortURL string) (bool, error) {
+	if !s.rebalancing.Load() {
+		return false, nil
+	}
+
+	home := s.owner(shortURL)
+	for _, shard := range s.shards {
+		if shard == home {
+			continue
+		}
+		// ссылка, которая ещё не открылась, тоже занимает короткий URL
+		_, err := readLink(ctx, shard, shortURL)
+		switch {
+		case err == nil, errors.Is(err, storage.ErrGone), errors.Is(err, storage.ErrNotActive):
+			return true, nil
+		case !errors.Is(err, storage.ErrNotFound):
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// lockFullURLs блокирует полные URL на первом шарде, если шардов несколько и первый
+// шард это поддерживает. С одним шардом уникальность полного URL обеспечивает шард.
+func (s *Storage) lockFullURLs(ctx context.Context, fullURLs []string) (func(), error) {
+	locker, ok := storage.As[storage.FullURLLocker](s.shards[0])
+	if !ok || len(s.shards) < 2 {
+		return func() {}, nil
+	}
+	return locker.LockFullURLs(ctx, fullURLs)
+}
+
+// ReserveSequence резервирует порядковые номера на первом шарде, чтобы диапазоны
+// номеров не пересекались на всех шардах. Если первый шард не раздаёт диапазоны
+// номеров, возвращается storage.ErrNotSupported.
+func (s *Storage) ReserveSequence(ctx context.Context, n uint64) (uint64, error) {
+	store, ok := storage.As[storage.SequenceStore](s.shards[0])
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	return store.ReserveSequence(ctx, n)
+}
+
+// findShortURLs ищет короткие URL неудалённых ссылок с полными URL fullURLs на всех шардах.
+func (s *Storage) findShortURLs(ctx context.Context, fullURLs []string) (map[string]string, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) (map[string]string, error) {
+		if reader, ok := storage.As[storage.BulkShortURLReader](shard); ok {
+			return reader.GetShortURLs(ctx, fullURLs)
+		}
+		existing := make(map[string]string)
+		for _, fullURL := range fullURLs {
+			shortURL, err := shard.GetShortURL(ctx, fullURL)
+			switch {
+			case err == nil:
+				existing[fullURL] = shortURL
+			case !errors.Is(err, storage.ErrNotFound):
+				return nil, err
+			}
+		}
+		return existing, nil
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]string)
+	for _, result := range results {
+		for fullURL, shortURL := range result {
+			existing[fullURL] = shortURL
+		}
+	}
+	return existing, nil
+}
+
+// BulkSaveURL сохраняет пакет, разделяя его по шардам коротких URL. Полные URL,
+// уже сохранённые на любом шарде, возвращаются с существующим коротким URL.
+// Части пакета сохраняются на шардах параллельно, каждая в своей транзакции,
+// поэтому при ошибке одного шарда части пакета на остальных шардах остаются сохранёнными.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	batch := storage.NewBulkBatch(data)
+
+	fullURLs := make([]string, 0, len(batch.Unique))
+	for _, i := range batch.Unique {
+		fullURLs = append(fullURLs, data[i].OriginalURL)
+	}
+	unlock, err := s.lockFullURLs(ctx, fullURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	existing, err := s.findShortURLs(ctx, fullURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	// индексы элементов пакета по шардам
+	parts := make([][]int, len(s.shards))
+	for _, i := range batch.Unique {
+		if shortURL, ok := existing[data[i].OriginalURL]; ok {
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveExisting, ShortURL: shortURL}
+			continue
+		}
+		taken, err := s.takenElsewhere(ctx, data[i].ShortURL)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCollision}
+			continue
+		}
+		index := owner(data[i].ShortURL, len(s.shards))
+		parts[index] = append(parts[index], i)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(s.shards))
+	)
+	for index, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(index int, part []int) {
+			defer wg.Done()
+			partData := make([]models.InsertData, 0, len(part))
+			for _, i := range part {
+				partData = append(partData, data[i])
+			}
+			results, err := s.shards[index].BulkSaveURL(ctx, partData, userID)
+			if err != nil {
+				errs[index] = err
+				return
+			}
+			for j, i := range part {
+				batch.Results[i] = results[j]
+			}
+		}(index, part)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return batch.Finish(), nil
+}
+
+// GetURL возвращает полный URL с шарда короткого URL. Пока перенос ссылок
+// не завершён, ненайденная ссылка ищется на остальных шардах.
+func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	return lookup(s, shortURL, func(shard storage.StorageProvider) (string, error) {
+		return shard.GetURL(ctx, shortURL)
+	})
+}
+
+// GetURLSchedule возвращает полный URL и срок действия ссылки с шарда короткого URL
+// так же, как GetURL. Для шарда, который не возвращает срок действия, срок действия
+// проверяется на шарде, а возвращается пустым.
+func (s *Storage) GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error) {
+	link, err := lookup(s, shortURL, func(shard storage.StorageProvider) (models.Link, error) {
+		return readLink(ctx, shard, shortURL)
+	})
+	return link.OriginalURL, link.Schedule, err
+}
+
+// readLink возвращает полный URL и срок действия ссылки с шарда shard, не проверяя
+// срок действия. Для шарда, который не возвращает срок действия, срок действия
+// проверяется на шарде, а возвращается пустым.
+func readLink(ctx context.Context, shard storage.StorageProvider, shortURL string) (models.Link, error) {
+	if reader, ok := storage.As[storage.ScheduleReader](shard); ok {
+		fullURL, schedule, err := reader.GetURLSchedule(ctx, shortURL)
+		return models.Link{OriginalURL: fullURL, Schedule: schedule}, err
+	}
+	fullURL, err := shard.GetURL(ctx, shortURL)
+	return models.Link{OriginalURL: fullURL}, err
+}
+
+// lookup выполняет get на шарде короткого URL. Пока перенос ссылок не завершён,
+// ненайденная ссылка ищется на остальных шардах.
+func lookup[T any](s *Storage, shortURL string, get func(shard storage.StorageProvider) (T, error)) (T, error) {
+	home := s.owner(shortURL)
+	result, err := get(home)
+	if !errors.Is(err, storage.ErrNotFound) || !s.rebalancing.Load() {
+		return result, err
+	}
+
+	for _, shard := range s.shards {
+		if shard == home {
+			continue
+		}
+		if shardResult, shardErr := get(shard); !errors.Is(shardErr, storage.ErrNotFound) {
+			return shardResult, shardErr
+		}
+	}
+	return result, err
+}
+
+// GetShortURL ищет полный URL на всех шардах.
+func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) (string, error) {
+		return shard.GetShortURL(ctx, fullURL)
+	})
+	for i, err := range errs {
+		if err == nil {
+			return results[i], nil
+		}
+	}
+	for _, err := range errs {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return "", err
+		}
+	}
+	return "", storage.ErrNotFound
+}
+
+// Init инициализирует все шарды.
+func (s *Storage) Init() error {
+	for _, shard := range s.shards {
+		if err := shard.Init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping проверяет доступность всех шардов.
+func (s *Storage) Ping(ctx context.Context) error {
+	_, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) (struct{}, error) {
+		return struct{}{}, shard.Ping(ctx)
+	})
+	return errors.Join(errs...)
+}
+
+// GetUserURLs собирает ссылки пользователя со всех шардов. Ссылки
+// перечисляются по шардам, внутри шарда - в порядке, который возвращает шард.
+func (s *Storage) GetUserURLs(ctx context.Context, baseURL, userID string) ([]models.UserURLS, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) ([]models.UserURLS, error) {
+		return shard.GetUserURLs(ctx, baseURL, userID)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var urls []models.UserURLS
+	for _, result := range results {
+		urls = append(urls, result...)
+	}
+	return urls, nil
+}
+
+// DeleteListURL удаляет ссылки на их шардах. Пока перенос ссылок не завершён,
+// удаление выполняется на всех шардах, чтобы не пропустить ещё не перенесённые ссылки.
+func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListURLForDelete) error {
+	parts := make([][]models.UserListURLForDelete, len(s.shards))
+	if s.rebalancing.Load() {
+		for i := range parts {
+			parts[i] = messages
+		}
+	} else {
+		for _, message := range messages {
+			byShard := make(map[int][]string)
+			for _, shortURL := range message.URLS {
+				index := owner(shortURL, len(s.shards))
+				byShard[index] = append(byShard[index], shortURL)
+			}
+			for index, urls := range byShard {
+				parts[index] = append(parts[index], models.UserListURLForDelete{UserID: message.UserID, URLS: urls})
+			}
+		}
+	}
+
+	_, errs := fanOut(s.shards, func(index int, shard storage.StorageProvider) (struct{}, error) {
+		if len(parts[index]) == 0 {
+			return struct{}{}, nil
+		}
+		return struct{}{}, shard.DeleteListURL(ctx, parts[index])
+	})
+	return errors.Join(errs...)
+}
+
+// ExpireURLs помечает удалёнными истёкшие ссылки на всех шардах, которые это
+// поддерживают, не более limit ссылок на каждом шарде.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) ([]string, error) {
+		expirer, ok := storage.As[storage.Expirer](shard)
+		if !ok {
+			return nil, nil
+		}
+		return expirer.ExpireURLs(ctx, limit)
+	})
+
+	var expired []string
+	for _, result := range results {
+		expired = append(expired, result...)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// SaveClicks сохраняет переходы на шардах их коротких URL. Переходы не переносятся
+// вместе со ссылками, поэтому после переноса они остаются на прежнем шарде.
+// Если часть шардов недоступна, ошибка возвращается для всего пакета, и при его
+// повторной записи переходы на остальных шардах будут учтены дважды.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	parts := make([][]models.Click, len(s.shards))
+	for _, click := range clicks {
+		index := owner(click.ShortURL, len(s.shards))
+		parts[index] = append(parts[index], click)
+	}
+
+	_, errs := fanOut(s.shards, func(index int, shard storage.StorageProvider) (struct{}, error) {
+		store, ok := storage.As[storage.ClickStore](shard)
+		if !ok || len(parts[index]) == 0 {
+			return struct{}{}, nil
+		}
+		return struct{}{}, store.SaveClicks(ctx, parts[index])
+	})
+	return errors.Join(errs...)
+}
+
+// GetLinkOwner возвращает владельца ссылки с её шарда. Пока перенос ссылок
+// не завершён, ненайденная ссылка ищется на остальных шардах.
+func (s *Storage) GetLinkOwner(ctx context.Context, shortURL string) (string, error) {
+	return lookup(s, shortURL, func(shard storage.StorageProvider) (string, error) {
+		return getLinkOwner(ctx, shard, shortURL)
+	})
+}
+
+// getLinkOwner возвращает владельца ссылки с шарда shard. Шард без статистики
+// переходов ссылку не находит.
+func getLinkOwner(ctx context.Context, shard storage.StorageProvider, shortURL string) (string, error) {
+	reader, ok := storage.As[storage.LinkStatsReader](shard)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return reader.GetLinkOwner(ctx, shortURL)
+}
+
+// GetLinkStats собирает статистику переходов по ссылке со всех шардов, так как
+// после переноса ссылки её переходы остаются на прежнем шарде. Каждый шард
+// возвращает только свои самые частые источники, поэтому, если переходы лежат
+// на нескольких шардах, самые частые источники и количество уникальных
+// посетителей приблизительны.
+func (s *Storage) GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) (models.LinkStats, error) {
+		reader, ok := storage.As[storage.LinkStatsReader](shard)
+		if !ok {
+			return models.LinkStats{}, nil
+		}
+		return reader.GetLinkStats(ctx, query)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return models.LinkStats{}, err
+	}
+
+	stats := models.LinkStats{
+		ShortURL: query.ShortURL,
+		From:     query.From,
+		To:       query.To,
+		Interval: query.Interval,
+	}
+	timeline := make(map[time.Time]int)
+	referrers := make(map[string]int)
+	userAgents := make(map[string]int)
+	countries := make(map[string]int)
+	for _, result := range results {
+		stats.Clicks += result.Clicks
+		stats.Visitors += result.Visitors
+		for _, bucket := range result.Timeline {
+			timeline[bucket.Time] += bucket.Clicks
+		}
+		for _, source := range result.Referrers {
+			referrers[source.Value] += source.Clicks
+		}
+		for _, source := range result.UserAgents {
+			userAgents[source.Value] += source.Clicks
+		}
+		for _, source := range result.Countries {
+			countries[source.Value] += source.Clicks
+		}
+	}
+
+	for bucket, clicks := range timeline {
+		stats.Timeline = append(stats.Timeline, models.ClickBucket{Time: bucket, Clicks: clicks})
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool {
+		return stats.Timeline[i].Time.Before(stats.Timeline[j].Time)
+	})
+	stats.Referrers = storage.CountClickSources(referrers, query.Top)
+	stats.UserAgents = storage.CountClickSources(userAgents, query.Top)
+	stats.Countries = storage.CountClickSources(countries, query.Top)
+	return stats, nil
+}
+
+// GetServiceStats суммирует статистику всех шардов. Если все шарды оценивают своих
+// пользователей, количество пользователей оценивается по объединённой оценке
+// HyperLogLog с погрешностью около 1%, и пользователь, ссылки которого лежат на
+// нескольких шардах, учитывается один раз. Иначе количество пользователей шардов суммируется.
+func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
+	results, errs := fanOut(s.shards, func(_ int, shard storage.StorageProvider) (models.ServiceStat, error) {
+		return shard.GetServiceStats(ctx)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return models.ServiceStat{}, err
+	}
+
+	var stats models.ServiceStat
+	for _, result := range results {
+		stats.URLS += result.URLS
+		stats.Users += result.Users
+	}
+
+	users, err := s.countUsers(ctx)
+	switch {
+	case errors.Is(err, storage.ErrNotSupported):
+	case err != nil:
+		return models.ServiceStat{}, err
+	default:
+		stats.Users = users
+	}
+	return stats, nil
+}
+
+// countUsers оценивает количество уникальных пользователей всех шардов, объединяя
+// оценки HyperLogLog шардов. Если какой-либо шард не оценивает пользователей,
+// возвращается storage.ErrNotSupported.
+func (s *Storage) countUsers(ctx context.Context) (int, error) {
+	sketchers := make([]storage.UserSketcher, 0, len(s.shards))
+	for _, shard := range s.shards {
+		sketcher, ok := storage.As[storage.UserSketcher](shard)
+		if !ok {
+			return 0, storage.ErrNotSupported
+		}
+		sketchers = append(sketchers, sketcher)
+	}
+
+	results, errs := fanOut(s.shards, func(index int, _ storage.StorageProvider) (hll.Sketch, error) {
+		return sketchers[index].UserSketch(ctx)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+
+	users := hll.New()
+	for _, result := range results {
+		users.Merge(result)
+	}
+	return users.Estimate(), nil
+}
+
+// ListenChanges подписывается на изменения ссылок на всех шардах, которые их рассылают.
+func (s *Storage) ListenChanges(wg *sync.WaitGroup, stopChan chan int64, handle func(storage.ChangeEvent)) {
+	defer wg.Done()
+	for _, shard := range s.shards {
+		if listener, ok := storage.As[storage.ChangeListener](shard); ok {
+			wg.Add(1)
+			go listener.ListenChanges(wg, stopChan, handle)
+		}
+	}
+}
+
+// Close закрывает все шарды.
+func (s *Storage) Close() error {
+	errs := make([]error, 0, len(s.shards))
+	for _, shard := range s.shards {
+		errs = append(errs, shard.Close())
+	}
+	return errors.Join(errs...)
+}
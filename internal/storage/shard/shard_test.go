@@ -0,0 +1,429 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/libs/hll"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+// memShard - простое хранилище в памяти, поддерживающее перенос ссылок.
+type memShard struct {
+	mutex sync.Mutex
+	links map[string]models.Link
+}
+
+func newMemShard() *memShard {
+	return &memShard{links: make(map[string]models.Link)}
+}
+
+func (m *memShard) SaveURL(_ context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, link := range m.links {
+		if link.OriginalURL == fullURL {
+			return &storage.ConflictError{ShortURL: link.ShortURL}
+		}
+	}
+	if _, ok := m.links[shortURL]; ok {
+		return storage.ErrShortURLCollision
+	}
+	m.links[shortURL] = models.Link{ShortURL: shortURL, OriginalURL: fullURL, UserID: userID, Schedule: schedule}
+	return nil
+}
+
+func (m *memShard) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	results := make([]models.BulkSaveResult, 0, len(data))
+	for _, d := range data {
+		if err := m.SaveURL(ctx, d.OriginalURL, d.ShortURL, userID, d.Schedule); err != nil {
+			return nil, err
+		}
+		results = append(results, models.BulkSaveResult{Status: models.BulkSaveCreated, ShortURL: d.ShortURL})
+	}
+	return results, nil
+}
+
+func (m *memShard) GetURL(_ context.Context, shortURL string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	link, ok := m.links[shortURL]
+	switch {
+	case !ok:
+		return "", storage.ErrNotFound
+	case link.IsDeleted:
+		return "", storage.ErrGone
+	}
+	return link.OriginalURL, nil
+}
+
+func (m *memShard) GetShortURL(_ context.Context, fullURL string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, link := range m.links {
+		if link.OriginalURL == fullURL {
+			return link.ShortURL, nil
+		}
+	}
+	return "", storage.ErrNotFound
+}
+
+func (m *memShard) GetUserURLs(_ context.Context, baseURL, userID string) ([]models.UserURLS, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var urls []models.UserURLS
+	for _, link := range m.links {
+		if link.UserID == userID && !link.IsDeleted {
+			urls = append(urls, models.UserURLS{ShortURL: baseURL + "/" + link.ShortURL, OriginalURL: link.OriginalURL})
+		}
+	}
+	return urls, nil
+}
+
+func (m *memShard) DeleteListURL(_ context.Context, messages []models.UserListURLForDelete) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, message := range messages {
+		for _, shortURL := range message.URLS {
+			if link, ok := m.links[shortURL]; ok && link.UserID == message.UserID {
+				link.IsDeleted = true
+				m.links[shortURL] = link
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memShard) GetServiceStats(context.Context) (models.ServiceStat, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return models.ServiceStat{URLS: len(m.links)}, nil
+}
+
+func (m *memShard) UserSketch(context.Context) (hll.Sketch, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sketch := hll.New()
+	for _, link := range m.links {
+		h := fnv.New32a()
+		h.Write([]byte(link.UserID))
+		sketch.Add(h.Sum32())
+	}
+	return sketch, nil
+}
+
+func (m *memShard) ScanLinks(_ context.Context, after string, limit int) ([]models.Link, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var links []models.Link
+	for shortURL, link := range m.links {
+		if shortURL > after {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortURL < links[j].ShortURL })
+	return links[:min(limit, len(links))], nil
+}
+
+func (m *memShard) ImportLinks(_ context.Context, links []models.Link) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var imported []string
+	for _, link := range links {
+		if _, ok := m.links[link.ShortURL]; !ok {
+			m.links[link.ShortURL] = link
+			imported = append(imported, link.ShortURL)
+		}
+	}
+	return imported, nil
+}
+
+func (m *memShard) RemoveLinks(_ context.Context, links []models.Link) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var removed []string
+	for _, link := range links {
+		if stored, ok := m.links[link.ShortURL]; ok && stored.IsDeleted == link.IsDeleted {
+			delete(m.links, link.ShortURL)
+			removed = append(removed, link.ShortURL)
+		}
+	}
+	return removed, nil
+}
+
+func (m *memShard) Init() error                { return nil }
+func (m *memShard) Ping(context.Context) error { return nil }
+func (m *memShard) Close() error               { return nil }
+
+func TestOwner(t *testing.T) {
+	// при добавлении шарда ссылки переходят только на новый шард
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		shortURL := fmt.Sprintf("code%d", i)
+		before, after := owner(shortURL, 3), owner(shortURL, 4)
+		if before != after {
+			assert.Equal(t, 3, after)
+			moved++
+		}
+	}
+	// на новый шард переходит примерно четверть ссылок
+	assert.InDelta(t, 2500, moved, 250)
+}
+
+func TestShardRebalance(t *testing.T) {
+	ctx := context.Background()
+
+	// все ссылки сохранены, пока шард был один
+	old := newMemShard()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, old.SaveURL(ctx, fmt.Sprintf("https://ya.ru/%d", i), fmt.Sprintf("code%d", i), "user", models.Schedule{}))
+	}
+
+	// после добавления шарда ссылки доступны до завершения переноса
+	added := newMemShard()
+	s, err := New([]storage.StorageProvider{old, added}, &config.Config{ShardRebalanceInterval: time.Hour})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		fullURL, err := s.GetURL(ctx, fmt.Sprintf("code%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("https://ya.ru/%d", i), fullURL)
+	}
+
+	// короткий URL ещё не перенесённой ссылки занят
+	var misplaced string
+	for i := 0; misplaced == ""; i++ {
+		if code := fmt.Sprintf("code%d", i); owner(code, 2) == 1 {
+			misplaced = code
+		}
+	}
+	err = s.SaveURL(ctx, "https://go.dev", misplaced, "user", models.Schedule{})
+	assert.ErrorIs(t, err, storage.ErrShortURLCollision)
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{{OriginalURL: "https://go.dev", ShortURL: misplaced}}, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{{Status: models.BulkSaveCollision}}, results)
+
+	var wg sync.WaitGroup
+	stopChan := make(chan int64)
+	wg.Add(1)
+	go s.Rebalance(&wg, stopChan)
+	assert.Eventually(t, func() bool { return !s.rebalancing.Load() }, time.Second, 10*time.Millisecond)
+	close(stopChan)
+	wg.Wait()
+
+	// ссылки лежат на своих шардах
+	assert.NotEmpty(t, added.links)
+	for index, shard := range []*memShard{old, added} {
+		for shortURL := range shard.links {
+			assert.Equal(t, index, owner(shortURL, 2))
+		}
+	}
+
+	urls, err := s.GetUserURLs(ctx, "http://localhost", "user")
+	require.NoError(t, err)
+	assert.Len(t, urls, 100)
+
+	stats, err := s.GetServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 100, stats.URLS)
+	// ссылки пользователя лежат на обоих шардах, но он учитывается один раз
+	assert.Equal(t, 1, stats.Users)
+
+	// полный URL ищется на всех шардах
+	err = s.SaveURL(ctx, "https://ya.ru/1", "other", "user", models.Schedule{})
+	assert.ErrorIs(t, err, storage.ErrConflict)
+
+	// удаление выполняется на шарде ссылки
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"code1", "code2"}}}))
+	_, err = s.GetURL(ctx, "code1")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	_, err = s.GetURL(ctx, "code2")
+	assert.ErrorIs(t, err, storage.ErrGone)
+}
+
+func TestShardWithoutRebalance(t *testing.T) {
+	ctx := context.Background()
+
+	old := newMemShard()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, old.SaveURL(ctx, fmt.Sprintf("https://ya.ru/%d", i), fmt.Sprintf("code%d", i), "user", models.Schedule{}))
+	}
+
+	// перенос отключен, но ссылки остаются доступными после добавления шарда
+	s, err := New([]storage.StorageProvider{old, newMemShard()}, &config.Config{})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.Rebalance(&wg, make(chan int64))
+	for i := 0; i < 20; i++ {
+		fullURL, err := s.GetURL(ctx, fmt.Sprintf("code%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("https://ya.ru/%d", i), fullURL)
+	}
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"code1"}}}))
+	_, err = s.GetURL(ctx, "code1")
+	assert.ErrorIs(t, err, storage.ErrGone)
+}
+
+// lockShard блокирует все полные URL одним мьютексом.
+type lockShard struct {
+	*memShard
+	lock sync.Mutex
+}
+
+func (s *lockShard) LockFullURLs(context.Context, []string) (func(), error) {
+	s.lock.Lock()
+	return s.lock.Unlock, nil
+}
+
+func TestShardFullURLUnique(t *testing.T) {
+	ctx := context.Background()
+	first, second := &lockShard{memShard: newMemShard()}, newMemShard()
+	s, err := New([]storage.StorageProvider{first, second}, &config.Config{})
+	require.NoError(t, err)
+
+	// короткие URL разных шардов
+	codes := make([][]string, 2)
+	for i := 0; len(codes[0]) < 10 || len(codes[1]) < 10; i++ {
+		code := fmt.Sprintf("code%d", i)
+		codes[owner(code, 2)] = append(codes[owner(code, 2)], code)
+	}
+
+	// одновременное сохранение одного полного URL на разных шардах создаёт одну ссылку
+	var (
+		wg      sync.WaitGroup
+		created sync.Map
+	)
+	for i := 0; i < 10; i++ {
+		for index := range codes {
+			wg.Add(1)
+			go func(fullURL, shortURL string) {
+				defer wg.Done()
+				if err := s.SaveURL(ctx, fullURL, shortURL, "user", models.Schedule{}); err == nil {
+					_, loaded := created.LoadOrStore(fullURL, shortURL)
+					assert.False(t, loaded, fullURL)
+				} else {
+					assert.ErrorIs(t, err, storage.ErrConflict)
+				}
+			}(fmt.Sprintf("https://ya.ru/%d", i), codes[index][i])
+		}
+	}
+	wg.Wait()
+
+	// полный URL с другого шарда возвращается как существующий
+	shortURL, ok := created.Load("https://ya.ru/0")
+	require.True(t, ok)
+	other := codes[0][len(codes[0])-1]
+	if owner(shortURL.(string), 2) == 0 {
+		other = codes[1][len(codes[1])-1]
+	}
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{{OriginalURL: "https://ya.ru/0", ShortURL: other}}, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{{Status: models.BulkSaveExisting, ShortURL: shortURL.(string)}}, results)
+}
+
+// importHookShard вызывает hook перед сохранением перенесённых ссылок.
+type importHookShard struct {
+	*memShard
+	hook func(links []models.Link)
+}
+
+func (s *importHookShard) ImportLinks(ctx context.Context, links []models.Link) ([]string, error) {
+	s.hook(links)
+	return s.memShard.ImportLinks(ctx, links)
+}
+
+func TestShardRebalanceDeleteDuringMove(t *testing.T) {
+	ctx := context.Background()
+
+	old := newMemShard()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, old.SaveURL(ctx, fmt.Sprintf("https://ya.ru/%d", i), fmt.Sprintf("code%d", i), "user", models.Schedule{}))
+	}
+
+	// пользователь удаляет ссылки после их чтения с исходного шарда, но до сохранения на целевом
+	var deleted []string
+	added := &importHookShard{memShard: newMemShard(), hook: func(links []models.Link) {
+		for _, link := range links {
+			deleted = append(deleted, link.ShortURL)
+		}
+		require.NoError(t, old.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: deleted}}))
+	}}
+	s, err := New([]storage.StorageProvider{old, added}, &config.Config{ShardRebalanceInterval: time.Hour})
+	require.NoError(t, err)
+
+	moved, skipped, err := s.rebalance(make(chan int64))
+	require.NoError(t, err)
+	assert.Zero(t, skipped)
+	assert.Equal(t, len(deleted), moved)
+	require.NotEmpty(t, deleted)
+
+	// удаление переносится вместе со ссылкой
+	for _, shortURL := range deleted {
+		assert.NotContains(t, old.links, shortURL)
+		_, err = s.GetURL(ctx, shortURL)
+		assert.ErrorIs(t, err, storage.ErrGone)
+	}
+}
+
+// statsShard возвращает заранее заданную статистику переходов.
+type statsShard struct {
+	*memShard
+	stats models.LinkStats
+}
+
+func (s *statsShard) GetLinkOwner(context.Context, string) (string, error) {
+	return "user", nil
+}
+
+func (s *statsShard) GetLinkStats(context.Context, models.LinkStatsQuery) (models.LinkStats, error) {
+	return s.stats, nil
+}
+
+func TestShardLinkStats(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// после переноса ссылки её переходы лежат на обоих шардах
+	oldShard := &statsShard{memShard: newMemShard(), stats: models.LinkStats{
+		Clicks:     3,
+		Visitors:   2,
+		Timeline:   []models.ClickBucket{{Time: day, Clicks: 3}},
+		Referrers:  []models.ClickSource{{Value: "https://a.ru", Clicks: 2}, {Value: "https://b.ru", Clicks: 1}},
+		UserAgents: []models.ClickSource{{Value: "curl", Clicks: 3}},
+		Countries:  []models.ClickSource{{Value: "RU", Clicks: 3}},
+	}}
+	newShard := &statsShard{memShard: newMemShard(), stats: models.LinkStats{
+		Clicks:     2,
+		Visitors:   1,
+		Timeline:   []models.ClickBucket{{Time: day, Clicks: 1}, {Time: day.Add(24 * time.Hour), Clicks: 1}},
+		Referrers:  []models.ClickSource{{Value: "https://b.ru", Clicks: 2}},
+		UserAgents: []models.ClickSource{{Value: "curl", Clicks: 2}},
+		Countries:  []models.ClickSource{{Value: "DE", Clicks: 2}},
+	}}
+	s, err := New([]storage.StorageProvider{oldShard, newShard}, &config.Config{})
+	require.NoError(t, err)
+
+	query := models.LinkStatsQuery{ShortURL: "short", From: day, To: day.Add(48 * time.Hour), Interval: models.StatsDay, Top: 1}
+	stats, err := s.GetLinkStats(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkStats{
+		ShortURL:   "short",
+		From:       query.From,
+		To:         query.To,
+		Interval:   models.StatsDay,
+		Clicks:     5,
+		Visitors:   3,
+		Timeline:   []models.ClickBucket{{Time: day, Clicks: 4}, {Time: day.Add(24 * time.Hour), Clicks: 1}},
+		Referrers:  []models.ClickSource{{Value: "https://b.ru", Clicks: 3}},
+		UserAgents: []models.ClickSource{{Value: "curl", Clicks: 5}},
+		Countries:  []models.ClickSource{{Value: "RU", Clicks: 3}},
+	}, stats)
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/zYoma/go-url-shortener/internal/logger"
+)
+
+// AddKeys добавляет ключи в таблицу short_key, пропуская ключи, которые уже есть
+// в пуле или заняты сохранёнными ссылками.
+func (s *Storage) AddKeys(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось начать транзакцию: %s", err)
+		return 0, classifyError(err, ErrSaveURL)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO short_key (short_url)
+		SELECT ? WHERE NOT EXISTS (SELECT 1 FROM url WHERE short_url = ?)
+	`)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подготовить запрос: %s", err)
+		return 0, classifyError(err, ErrSaveURL)
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, key := range keys {
+		res, err := stmt.ExecContext(ctx, key, key)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Не удалось добавить ключ: %s", err)
+			return 0, classifyError(err, ErrSaveURL)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, classifyError(err, ErrSaveURL)
+		}
+		added += int(n)
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось зафиксировать транзакцию: %s", err)
+		return 0, classifyError(err, ErrSaveURL)
+	}
+	return added, nil
+}
+
+// ClaimKeys забирает из пула не более n самых старых ключей.
+func (s *Storage) ClaimKeys(ctx context.Context, n int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM short_key
+		WHERE short_url IN (SELECT short_url FROM short_key ORDER BY created LIMIT ?)
+		RETURNING short_url
+	`, n)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось получить ключи: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось прочитать ключ: %s", err)
+			return nil, ErrScanRows
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return keys, nil
+}
+
+// ReleaseKeys возвращает в пул неиспользованные ключи. Ключи, которые успели
+// занять ссылки, в пул не возвращаются.
+func (s *Storage) ReleaseKeys(ctx context.Context, keys []string) error {
+	_, err := s.AddKeys(ctx, keys)
+	return err
+}
+
+// CountFreeKeys возвращает количество ключей в пуле.
+func (s *Storage) CountFreeKeys(ctx context.Context) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM short_key`).Scan(&count); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось посчитать ключи: %s", err)
+		return 0, classifyError(err, ErrGetURL)
+	}
+	return count, nil
+}
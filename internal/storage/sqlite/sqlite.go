@@ -0,0 +1,647 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/logger"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Scheme - префикс DSN, по которому выбирается хранилище SQLite,
+// например sqlite:///var/lib/shortener/db.sqlite.
+const Scheme = "sqlite://"
+
+// возможные ошибки пакета
+var (
+	// ErrOpenDB описывает ошибку открытия файла базы данных.
+	ErrOpenDB = errors.New("unable to open database")
+	// ErrPing описывает ошибку проверки соединения с базой данных.
+	ErrPing = errors.New("checking connection to the database")
+	// ErrSaveURL описывает ошибку сохранения URL в базе данных.
+	ErrSaveURL = errors.New("saving to database")
+	// ErrCreateTable описывает ошибку создания таблиц в базе данных.
+	ErrCreateTable = errors.New("creating tables")
+	// ErrGetURL описывает ошибку получения данных из базы данных.
+	ErrGetURL = errors.New("select from database")
+	// ErrScanRows описывает ошибку чтения строк из результата запроса.
+	ErrScanRows = errors.New("scan rows")
+	// ErrUpdateURL описывает ошибку обновления данных о URL в базе данных.
+	ErrUpdateURL = errors.New("update urls")
+	// ErrSaveClicks описывает ошибку сохранения переходов по ссылкам в базе данных.
+	ErrSaveClicks = errors.New("saving clicks to database")
+)
+
+// schema описывает таблицы хранилища. Семантика совпадает с postgres.Storage:
+// короткий URL уникален, полный URL уникален среди неудалённых ссылок, удаление ссылок мягкое.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS url (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"full_url" TEXT NOT NULL,
+		"short_url" TEXT NOT NULL,
+		"created" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		"user_id" TEXT NOT NULL,
+		"is_deleted" BOOLEAN DEFAULT FALSE,
+		"active_from" INTEGER,
+		"expires_at" INTEGER
+	);`,
+	// уникальный индекс из первых версий схемы не позволял сократить удалённую ссылку снова
+	`DROP INDEX IF EXISTS idx_full_url_unique;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_url_full_url_active ON url(full_url) WHERE NOT is_deleted;`,
+	// неуникальный индекс из первых версий схемы заменён уникальным
+	`DROP INDEX IF EXISTS idx_url_short_url;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_url_short_url_unique ON url(short_url);`,
+	`CREATE INDEX IF NOT EXISTS idx_url_user_id ON url(user_id);`,
+	// пул заранее сгенерированных свободных коротких URL
+	`CREATE TABLE IF NOT EXISTS short_key (
+		"short_url" TEXT PRIMARY KEY,
+		"created" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`,
+	// переходы по ссылкам, время перехода хранится в миллисекундах Unix
+	`CREATE TABLE IF NOT EXISTS click (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"short_url" TEXT NOT NULL,
+		"clicked_at" INTEGER NOT NULL,
+		"referrer" TEXT NOT NULL DEFAULT '',
+		"user_agent" TEXT NOT NULL DEFAULT '',
+		"ip_prefix" TEXT NOT NULL DEFAULT '',
+		"country" TEXT NOT NULL DEFAULT '',
+		"city" TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_click_short_url_clicked_at ON click(short_url, clicked_at);`,
+}
+
+// column описывает столбец, добавленный в таблицу после первых версий схемы.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addedColumns добавляются в таблицы, созданные старыми версиями схемы.
+// Время срока действия ссылок хранится в миллисекундах Unix.
+var addedColumns = []column{
+	{table: "url", name: "active_from", definition: "INTEGER"},
+	{table: "url", name: "expires_at", definition: "INTEGER"},
+	{table: "click", name: "country", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "click", name: "city", definition: "TEXT NOT NULL DEFAULT ''"},
+}
+
+// columnIndexes создаются после добавления столбцов, по которым они строятся.
+var columnIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_url_expires_at ON url(expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;`,
+}
+
+// Storage реализует интерфейс StorageProvider поверх встроенной базы данных SQLite.
+type Storage struct {
+	db *sql.DB // Соединения с файлом базы данных.
+}
+
+// New открывает файл базы данных, указанный в DSN конфигурации после префикса Scheme.
+func New(cfg *config.Config) (storage.StorageProvider, error) {
+	path := strings.TrimPrefix(cfg.DSN, Scheme)
+	if path == "" {
+		return nil, ErrOpenDB
+	}
+
+	// WAL позволяет читать базу параллельно с записью, а busy_timeout
+	// заставляет конкурирующих писателей ждать освобождения блокировки
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(ON)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось открыть базу данных: %s", err)
+		return nil, ErrOpenDB
+	}
+	return &Storage{db: db}, nil
+}
+
+// Init создаёт таблицы и индексы, если они ещё не существуют,
+// и добавляет в существующие таблицы недостающие столбцы.
+func (s *Storage) Init() error {
+	ctx := context.Background()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось начать транзакцию: %s", err)
+		return ErrCreateTable
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range schema {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			logger.Log.Sugar().Errorf("Ошибка при создании таблицы: %s", err)
+			return ErrCreateTable
+		}
+	}
+	if err = addColumns(ctx, tx); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка при добавлении столбцов: %s", err)
+		return ErrCreateTable
+	}
+	for _, stmt := range columnIndexes {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			logger.Log.Sugar().Errorf("Ошибка при создании индекса: %s", err)
+			return ErrCreateTable
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addColumns добавляет столбцы addedColumns, которых ещё нет в таблицах.
+// SQLite не поддерживает ADD COLUMN IF NOT EXISTS, поэтому наличие столбца
+// проверяется по pragma_table_info.
+func addColumns(ctx context.Context, tx *sql.Tx) error {
+	for _, c := range addedColumns {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.name,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s;`, c.table, c.name, c.definition)
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixMilli возвращает время в миллисекундах Unix или nil для нулевого времени.
+func unixMilli(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+// fromUnixMilli возвращает время по значению в миллисекундах Unix.
+// NULL соответствует нулевому времени.
+func fromUnixMilli(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.UnixMilli(v.Int64).UTC()
+}
+
+// releaseExpiredQuery помечает удалённой ссылку с истёкшим сроком действия и заданным
+// полным URL, чтобы полный URL можно было сократить снова, не дожидаясь ExpireURLs.
+const releaseExpiredQuery = `
+	UPDATE url SET is_deleted = TRUE
+	WHERE full_url = ? AND expires_at IS NOT NULL AND expires_at <= ? AND NOT is_deleted
+`
+
+// SaveURL сохраняет указанный URL в базе данных, ассоциируя его с конкретным пользователем.
+// Полный URL уникален только среди неудалённых ссылок, поэтому удалённую ссылку можно
+// сократить снова, а ссылка с истёкшим сроком действия помечается удалённой перед вставкой.
+func (s *Storage) SaveURL(ctx context.Context, fullURL string, shortURL string, userID string, schedule models.Schedule) error {
+	_, err := s.db.ExecContext(ctx, releaseExpiredQuery, fullURL, time.Now().UnixMilli())
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось пометить истёкшую ссылку: %s", err)
+		return classifyError(err, ErrUpdateURL)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO url (full_url, short_url, user_id, active_from, expires_at) VALUES (?, ?, ?, ?, ?);
+	`, fullURL, shortURL, userID, unixMilli(schedule.ActiveFrom), unixMilli(schedule.ExpiresAt))
+
+	if err != nil {
+		if isShortURLCollision(err) {
+			return storage.ErrShortURLCollision
+		}
+		if isConflict(err) {
+			existing, getErr := s.GetShortURL(ctx, fullURL)
+			if getErr != nil {
+				return storage.ErrConflict
+			}
+			return &storage.ConflictError{ShortURL: existing}
+		}
+		logger.Log.Sugar().Errorf("Не удалось сохранить url: %s", err)
+		return classifyError(err, ErrSaveURL)
+	}
+	return nil
+}
+
+// GetShortURL возвращает короткий URL неудалённой ссылки по заданному полному URL.
+func (s *Storage) GetShortURL(ctx context.Context, fullURL string) (string, error) {
+	var shortURL string
+	row := s.db.QueryRowContext(ctx, `SELECT short_url FROM url WHERE full_url = ? AND NOT is_deleted`, fullURL)
+	if err := row.Scan(&shortURL); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.ErrNotFound
+		}
+		return "", classifyError(err, ErrGetURL)
+	}
+
+	return shortURL, nil
+}
+
+// GetURL возвращает полный URL по заданному короткому URL с учётом срока действия ссылки.
+func (s *Storage) GetURL(ctx context.Context, shortURL string) (string, error) {
+	fullURL, schedule, err := s.GetURLSchedule(ctx, shortURL)
+	if err != nil {
+		return "", err
+	}
+	if err = storage.CheckSchedule(schedule, time.Now()); err != nil {
+		return "", err
+	}
+	return fullURL, nil
+}
+
+// GetURLSchedule возвращает полный URL и срок действия ссылки.
+func (s *Storage) GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error) {
+	var (
+		fullURL               string
+		isDeleted             bool
+		activeFrom, expiresAt sql.NullInt64
+	)
+	row := s.db.QueryRowContext(ctx, `
+		SELECT full_url, is_deleted, active_from, expires_at FROM url WHERE short_url = ?
+	`, shortURL)
+	if err := row.Scan(&fullURL, &isDeleted, &activeFrom, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.Schedule{}, storage.ErrNotFound
+		}
+		logger.Log.Sugar().Errorf("Не удалось получить url: %s", err)
+		return "", models.Schedule{}, classifyError(err, ErrGetURL)
+	}
+
+	if isDeleted {
+		return "", models.Schedule{}, storage.ErrGone
+	}
+	return fullURL, models.Schedule{ActiveFrom: fromUnixMilli(activeFrom), ExpiresAt: fromUnixMilli(expiresAt)}, nil
+}
+
+// Ping проверяет доступность файла базы данных.
+func (s *Storage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, ErrPing)
+	}
+	return nil
+}
+
+// Close закрывает соединения с базой данных.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// BulkSaveURL выполняет массовое сохранение данных о URL для указанного пользователя
+// в одной транзакции. Полные URL неудалённых ссылок возвращаются с существующим коротким
+// URL, занятые короткие URL - как коллизии. Истёкшие ссылки с теми же полными URL
+// помечаются удалёнными.
+func (s *Storage) BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error) {
+	batch := storage.NewBulkBatch(data)
+	if len(batch.Unique) == 0 {
+		return batch.Finish(), nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось начать транзакцию: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO url (full_url, short_url, user_id, active_from, expires_at) VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подготовить запрос: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
+	defer stmt.Close()
+
+	release, err := tx.PrepareContext(ctx, releaseExpiredQuery)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подготовить запрос: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
+	defer release.Close()
+
+	now := time.Now().UnixMilli()
+	for _, i := range batch.Unique {
+		d := data[i]
+		if _, err = release.ExecContext(ctx, d.OriginalURL, now); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось пометить истёкшую ссылку: %s", err)
+			return nil, classifyError(err, ErrUpdateURL)
+		}
+		_, err = stmt.ExecContext(ctx, d.OriginalURL, d.ShortURL, userID, unixMilli(d.ActiveFrom), unixMilli(d.ExpiresAt))
+		if err == nil {
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCreated, ShortURL: d.ShortURL}
+			continue
+		}
+		if !isConflict(err) {
+			logger.Log.Sugar().Errorf("Не удалось сохранить url: %s", err)
+			return nil, classifyError(err, ErrSaveURL)
+		}
+
+		// нарушение ограничения отменяет только эту вставку, транзакция продолжается;
+		// существующий полный URL проверяется первым, так как новый короткий URL его не исправит
+		var existing string
+		err = tx.QueryRowContext(ctx, `SELECT short_url FROM url WHERE full_url = ? AND NOT is_deleted`, d.OriginalURL).Scan(&existing)
+		switch {
+		case err == nil:
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveExisting, ShortURL: existing}
+		case errors.Is(err, sql.ErrNoRows):
+			batch.Results[i] = models.BulkSaveResult{Status: models.BulkSaveCollision}
+		default:
+			return nil, classifyError(err, ErrGetURL)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось зафиксировать транзакцию: %s", err)
+		return nil, classifyError(err, ErrSaveURL)
+	}
+	return batch.Finish(), nil
+}
+
+// GetUserURLs возвращает список URL, созданных пользователем.
+func (s *Storage) GetUserURLs(ctx context.Context, baseURL string, userID string) ([]models.UserURLS, error) {
+	var urls []models.UserURLS
+	rows, err := s.db.QueryContext(ctx, `SELECT short_url, full_url FROM url WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pair models.UserURLS
+		if err = rows.Scan(&pair.ShortURL, &pair.OriginalURL); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+			return nil, ErrScanRows
+		}
+		pair.ShortURL = fmt.Sprintf("%s/%s", baseURL, pair.ShortURL)
+		urls = append(urls, pair)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+
+	return urls, nil
+}
+
+// DeleteListURL помечает удалёнными URL, принадлежащие указанным пользователям.
+func (s *Storage) DeleteListURL(ctx context.Context, messages []models.UserListURLForDelete) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось начать транзакцию: %s", err)
+		return classifyError(err, ErrUpdateURL)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE url SET is_deleted = TRUE WHERE short_url = ? AND user_id = ?`)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подготовить запрос: %s", err)
+		return classifyError(err, ErrUpdateURL)
+	}
+	defer stmt.Close()
+
+	for _, message := range messages {
+		for _, url := range message.URLS {
+			if _, err = stmt.ExecContext(ctx, url, message.UserID); err != nil {
+				logger.Log.Sugar().Errorf("Не удалось выполнить обновление: %s", err)
+				return classifyError(err, ErrUpdateURL)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось зафиксировать транзакцию: %s", err)
+		return classifyError(err, ErrUpdateURL)
+	}
+	return nil
+}
+
+// ExpireURLs помечает удалёнными не более limit ссылок с истёкшим сроком действия
+// и возвращает их короткие URL.
+func (s *Storage) ExpireURLs(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE url SET is_deleted = TRUE
+		WHERE id IN (
+			SELECT id FROM url
+			WHERE expires_at IS NOT NULL AND expires_at <= ? AND NOT is_deleted
+			LIMIT ?
+		)
+		RETURNING short_url
+	`, time.Now().UnixMilli(), limit)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось пометить истёкшие ссылки: %s", err)
+		return nil, classifyError(err, ErrUpdateURL)
+	}
+	defer rows.Close()
+
+	var expired []string
+	for rows.Next() {
+		var shortURL string
+		if err = rows.Scan(&shortURL); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+			return nil, ErrScanRows
+		}
+		expired = append(expired, shortURL)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка: %s", err)
+		return nil, classifyError(err, ErrUpdateURL)
+	}
+	return expired, nil
+}
+
+// SaveClicks сохраняет пакет переходов по ссылкам в одной транзакции.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось начать транзакцию: %s", err)
+		return classifyError(err, ErrSaveClicks)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO click (short_url, clicked_at, referrer, user_agent, ip_prefix, country, city)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подготовить запрос: %s", err)
+		return classifyError(err, ErrSaveClicks)
+	}
+	defer stmt.Close()
+
+	for _, click := range clicks {
+		_, err = stmt.ExecContext(ctx,
+			click.ShortURL, click.Time.UnixMilli(), click.Referrer, click.UserAgent, click.IPPrefix, click.Country, click.City,
+		)
+		if err != nil {
+			logger.Log.Sugar().Errorf("Не удалось сохранить переход: %s", err)
+			return classifyError(err, ErrSaveClicks)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось зафиксировать транзакцию: %s", err)
+		return classifyError(err, ErrSaveClicks)
+	}
+	return nil
+}
+
+// GetLinkOwner возвращает владельца ссылки, в том числе удалённой.
+func (s *Storage) GetLinkOwner(ctx context.Context, shortURL string) (string, error) {
+	var userID string
+	row := s.db.QueryRowContext(ctx, `SELECT user_id FROM url WHERE short_url = ?`, shortURL)
+	if err := row.Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.ErrNotFound
+		}
+		logger.Log.Sugar().Errorf("Не удалось получить владельца ссылки: %s", err)
+		return "", classifyError(err, ErrGetURL)
+	}
+	return userID, nil
+}
+
+// GetLinkStats подсчитывает статистику переходов по ссылке запросами к таблице click.
+func (s *Storage) GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error) {
+	stats := models.LinkStats{
+		ShortURL: query.ShortURL,
+		From:     query.From,
+		To:       query.To,
+		Interval: query.Interval,
+	}
+	from, to := query.From.UnixMilli(), query.To.UnixMilli()
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT ip_prefix || char(0) || user_agent)
+		FROM click WHERE short_url = ? AND clicked_at >= ? AND clicked_at < ?
+	`, query.ShortURL, from, to)
+	if err := row.Scan(&stats.Clicks, &stats.Visitors); err != nil {
+		logger.Log.Sugar().Errorf("Не удалось подсчитать переходы: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrGetURL)
+	}
+	if stats.Clicks == 0 {
+		return stats, nil
+	}
+
+	step := query.Interval.Duration().Milliseconds()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT clicked_at - clicked_at % ? AS bucket, COUNT(*)
+		FROM click WHERE short_url = ? AND clicked_at >= ? AND clicked_at < ?
+		GROUP BY bucket ORDER BY bucket
+	`, step, query.ShortURL, from, to)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrGetURL)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			bucket int64
+			clicks int
+		)
+		if err = rows.Scan(&bucket, &clicks); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+			return models.LinkStats{}, ErrScanRows
+		}
+		stats.Timeline = append(stats.Timeline, models.ClickBucket{Time: time.UnixMilli(bucket).UTC(), Clicks: clicks})
+	}
+	if err = rows.Err(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка: %s", err)
+		return models.LinkStats{}, classifyError(err, ErrScanRows)
+	}
+
+	if stats.Referrers, err = s.topClickSources(ctx, "referrer", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	if stats.UserAgents, err = s.topClickSources(ctx, "user_agent", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	if stats.Countries, err = s.topClickSources(ctx, "country", query); err != nil {
+		return models.LinkStats{}, err
+	}
+	return stats, nil
+}
+
+// topClickSources возвращает самые частые значения столбца column таблицы click
+// за период запроса. Имя столбца подставляется в запрос, поэтому передаётся только константой.
+func (s *Storage) topClickSources(ctx context.Context, column string, query models.LinkStatsQuery) ([]models.ClickSource, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*) AS clicks
+		FROM click WHERE short_url = ? AND clicked_at >= ? AND clicked_at < ?
+		GROUP BY %[1]s ORDER BY clicks DESC, %[1]s LIMIT ?
+	`, column), query.ShortURL, query.From.UnixMilli(), query.To.UnixMilli(), query.Top)
+	if err != nil {
+		logger.Log.Sugar().Errorf("Не удалось выполнить запрос: %s", err)
+		return nil, classifyError(err, ErrGetURL)
+	}
+	defer rows.Close()
+
+	var sources []models.ClickSource
+	for rows.Next() {
+		var source models.ClickSource
+		if err = rows.Scan(&source.Value, &source.Clicks); err != nil {
+			logger.Log.Sugar().Errorf("Не удалось прочитать строку: %s", err)
+			return nil, ErrScanRows
+		}
+		sources = append(sources, source)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Log.Sugar().Errorf("Ошибка: %s", err)
+		return nil, classifyError(err, ErrScanRows)
+	}
+	return sources, nil
+}
+
+// GetServiceStats получает статистику сервиса.
+func (s *Storage) GetServiceStats(ctx context.Context) (models.ServiceStat, error) {
+	var stat models.ServiceStat
+	row := s.db.QueryRowContext(ctx, `SELECT COUNT(full_url), COUNT(DISTINCT user_id) FROM url`)
+	if err := row.Scan(&stat.URLS, &stat.Users); err != nil {
+		return models.ServiceStat{}, classifyError(err, ErrGetURL)
+	}
+
+	return stat, nil
+}
+
+// isConflict проверяет, что ошибка вызвана нарушением ограничения уникальности.
+func isConflict(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isShortURLCollision проверяет, что ошибка вызвана повторным использованием короткого URL.
+// SQLite не сообщает имя индекса отдельно, поэтому столбец ищется в тексте ошибки.
+func isShortURLCollision(err error) bool {
+	return isConflict(err) && strings.Contains(err.Error(), "url.short_url")
+}
+
+// classifyError возвращает storage.ErrUnavailable, если база данных заблокирована
+// другим процессом, и fallback во всех остальных случаях.
+func classifyError(err error, fallback error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return fmt.Errorf("%w: %w", storage.ErrUnavailable, fallback)
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,203 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zYoma/go-url-shortener/internal/config"
+	"github.com/zYoma/go-url-shortener/internal/models"
+	"github.com/zYoma/go-url-shortener/internal/storage"
+)
+
+func newTestStorage(t *testing.T) storage.StorageProvider {
+	dsn := Scheme + filepath.Join(t.TempDir(), "shortener.db")
+	s, err := New(&config.Config{DSN: dsn})
+	require.NoError(t, err)
+	require.NoError(t, s.Init())
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user1", models.Schedule{}))
+	_, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "short2"},
+		{OriginalURL: "http://vk.com", ShortURL: "short3"},
+	}, "user2")
+	require.NoError(t, err)
+
+	// повторное сохранение полного URL возвращает существующий короткий URL
+	err = s.SaveURL(ctx, "http://ya.ru", "short4", "user2", models.Schedule{})
+	var conflict *storage.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "short1", conflict.ShortURL)
+
+	// занятый короткий URL отличается от конфликта полного URL
+	err = s.SaveURL(ctx, "http://ok.ru", "short1", "user2", models.Schedule{})
+	assert.ErrorIs(t, err, storage.ErrShortURLCollision)
+	assert.NotErrorIs(t, err, storage.ErrConflict)
+
+	// уже сохранённые URL и занятые короткие URL не прерывают сохранение пакета
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://ok.ru", ShortURL: "short5"},
+		{OriginalURL: "http://vk.com", ShortURL: "short1"},
+		{OriginalURL: "http://go.dev", ShortURL: "short1"},
+	}, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{
+		{Status: models.BulkSaveCreated, ShortURL: "short5"},
+		{Status: models.BulkSaveExisting, ShortURL: "short3"},
+		{Status: models.BulkSaveCollision},
+	}, results)
+	_, err = s.GetURL(ctx, "short5")
+	require.NoError(t, err)
+
+	// пользователь может удалить только свои ссылки
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{
+		{UserID: "user2", URLS: []string{"short1", "short2"}},
+	}))
+	_, err = s.GetURL(ctx, "short2")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	got, err := s.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://ya.ru", got)
+
+	urls, err := s.GetUserURLs(ctx, "http://localhost:8080", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []models.UserURLS{
+		{ShortURL: "http://localhost:8080/short2", OriginalURL: "http://mail.ru"},
+		{ShortURL: "http://localhost:8080/short3", OriginalURL: "http://vk.com"},
+		{ShortURL: "http://localhost:8080/short5", OriginalURL: "http://ok.ru"},
+	}, urls)
+
+	stats, err := s.GetServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.ServiceStat{URLS: 4, Users: 2}, stats)
+}
+
+func TestStorageSchedule(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now()
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "expired", "user", models.Schedule{ExpiresAt: now.Add(-time.Minute)}))
+	_, err := s.BulkSaveURL(ctx, []models.InsertData{
+		{OriginalURL: "http://mail.ru", ShortURL: "later", Schedule: models.Schedule{ActiveFrom: now.Add(time.Hour)}},
+		{OriginalURL: "http://vk.com", ShortURL: "active", Schedule: models.Schedule{ExpiresAt: now.Add(time.Hour)}},
+	}, "user")
+	require.NoError(t, err)
+
+	_, err = s.GetURL(ctx, "expired")
+	assert.ErrorIs(t, err, storage.ErrExpired)
+	_, err = s.GetURL(ctx, "later")
+	assert.ErrorIs(t, err, storage.ErrNotActive)
+	got, err := s.GetURL(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, "http://vk.com", got)
+
+	expirer := s.(storage.Expirer)
+	expired, err := expirer.ExpireURLs(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expired"}, expired)
+	expired, err = expirer.ExpireURLs(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	// повторная инициализация не добавляет столбцы заново
+	require.NoError(t, s.Init())
+}
+
+func TestStorageReshorten(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short1", "user", models.Schedule{}))
+	require.NoError(t, s.SaveURL(ctx, "http://mail.ru", "short2", "user", models.Schedule{ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, s.DeleteListURL(ctx, []models.UserListURLForDelete{{UserID: "user", URLS: []string{"short1"}}}))
+
+	// полный URL удалённой и истёкшей ссылки можно сократить снова
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short3", "user", models.Schedule{}))
+	results, err := s.BulkSaveURL(ctx, []models.InsertData{{OriginalURL: "http://mail.ru", ShortURL: "short4"}}, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []models.BulkSaveResult{{Status: models.BulkSaveCreated, ShortURL: "short4"}}, results)
+
+	for full, short := range map[string]string{"http://ya.ru": "short3", "http://mail.ru": "short4"} {
+		got, err := s.GetShortURL(ctx, full)
+		require.NoError(t, err)
+		assert.Equal(t, short, got)
+	}
+	_, err = s.GetURL(ctx, "short2")
+	assert.ErrorIs(t, err, storage.ErrGone)
+	assert.NotErrorIs(t, err, storage.ErrExpired)
+}
+
+func TestKeyStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	keys := s.(storage.KeyStore)
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "key1", "user1", models.Schedule{}))
+
+	// занятые и повторяющиеся ключи в пул не попадают
+	added, err := keys.AddKeys(ctx, []string{"key1", "key2", "key3", "key2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	claimed, err := keys.ClaimKeys(ctx, 5)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"key2", "key3"}, claimed)
+
+	count, err := keys.CountFreeKeys(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	require.NoError(t, keys.ReleaseKeys(ctx, []string{"key3"}))
+	count, err = keys.CountFreeKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestLinkStats(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	reader := s.(storage.LinkStatsReader)
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.SaveURL(ctx, "http://ya.ru", "short", "user", models.Schedule{}))
+	owner, err := reader.GetLinkOwner(ctx, "short")
+	require.NoError(t, err)
+	assert.Equal(t, "user", owner)
+	_, err = reader.GetLinkOwner(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.(storage.ClickStore).SaveClicks(ctx, []models.Click{
+		{ShortURL: "short", Time: day.Add(time.Hour), Referrer: "https://a.ru", UserAgent: "curl", IPPrefix: "10.0.0.0/24", Country: "RU", City: "Moscow"},
+		{ShortURL: "short", Time: day.Add(2 * time.Hour), Referrer: "https://a.ru", UserAgent: "curl", IPPrefix: "10.0.0.0/24", Country: "RU", City: "Moscow"},
+		{ShortURL: "short", Time: day.Add(25 * time.Hour), UserAgent: "firefox", IPPrefix: "10.0.0.0/24"},
+		{ShortURL: "short", Time: day.Add(72 * time.Hour), UserAgent: "curl"},
+		{ShortURL: "other", Time: day.Add(time.Hour)},
+	}))
+
+	query := models.LinkStatsQuery{ShortURL: "short", From: day, To: day.Add(48 * time.Hour), Interval: models.StatsDay, Top: 1}
+	stats, err := reader.GetLinkStats(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkStats{
+		ShortURL:   "short",
+		From:       query.From,
+		To:         query.To,
+		Interval:   models.StatsDay,
+		Clicks:     3,
+		Visitors:   2,
+		Timeline:   []models.ClickBucket{{Time: day, Clicks: 2}, {Time: day.Add(24 * time.Hour), Clicks: 1}},
+		Referrers:  []models.ClickSource{{Value: "https://a.ru", Clicks: 2}},
+		UserAgents: []models.ClickSource{{Value: "curl", Clicks: 2}},
+		Countries:  []models.ClickSource{{Value: "RU", Clicks: 2}},
+	}, stats)
+}
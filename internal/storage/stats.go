@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/zYoma/go-url-shortener/internal/models"
+)
+
+// TopClickSources сортирует источники переходов по убыванию количества переходов,
+// а при равенстве - по значению, и оставляет не более top первых.
+func TopClickSources(sources []models.ClickSource, top int) []models.ClickSource {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Clicks != sources[j].Clicks {
+			return sources[i].Clicks > sources[j].Clicks
+		}
+		return sources[i].Value < sources[j].Value
+	})
+	if len(sources) > top {
+		sources = sources[:top]
+	}
+	return sources
+}
+
+// CountClickSources возвращает top самых частых значений из количества переходов
+// по каждому значению.
+func CountClickSources(counts map[string]int, top int) []models.ClickSource {
+	sources := make([]models.ClickSource, 0, len(counts))
+	for value, clicks := range counts {
+		sources = append(sources, models.ClickSource{Value: value, Clicks: clicks})
+	}
+	return TopClickSources(sources, top)
+}
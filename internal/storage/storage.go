@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 
+	"github.com/zYoma/go-url-shortener/internal/libs/hll"
 	"github.com/zYoma/go-url-shortener/internal/models"
 )
 
@@ -11,6 +12,43 @@ import (
 // обрабатывать операции с URL.
 type StorageProvider interface {
 	URLProvider
+
+	// Close освобождает ресурсы хранилища при остановке приложения.
+	Close() error
+}
+
+// Wrapper реализуют обёртки над хранилищем, например кеш, чтобы можно было
+// получить доступ к возможностям исходного хранилища.
+type Wrapper interface {
+	// Unwrap возвращает обёрнутое хранилище.
+	Unwrap() StorageProvider
+}
+
+// As ищет в цепочке обёрток хранилище, реализующее интерфейс T, начиная с самого provider.
+func As[T any](provider URLProvider) (T, bool) {
+	for provider != nil {
+		if target, ok := provider.(T); ok {
+			return target, true
+		}
+		wrapper, ok := provider.(Wrapper)
+		if !ok {
+			break
+		}
+		provider = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// Base возвращает исходное хранилище в цепочке обёрток provider.
+func Base(provider URLProvider) URLProvider {
+	for {
+		wrapper, ok := provider.(Wrapper)
+		if !ok {
+			return provider
+		}
+		provider = wrapper.Unwrap()
+	}
 }
 
 // URLProvider определяет набор методов для управления URL в хранилище, включая
@@ -18,13 +56,17 @@ type StorageProvider interface {
 // Этот интерфейс предназначен для взаимодействия с различными реализациями хранилищ,
 // поддерживающих операции с короткими и полными URL.
 type URLProvider interface {
-	// SaveURL сохраняет короткий и полный URL, ассоциированные с идентификатором пользователя.
-	SaveURL(ctx context.Context, fullURL, shortURL, userID string) error
+	// SaveURL сохраняет короткий и полный URL, ассоциированные с идентификатором пользователя,
+	// вместе со сроком действия ссылки.
+	SaveURL(ctx context.Context, fullURL, shortURL, userID string, schedule models.Schedule) error
 
 	// BulkSaveURL выполняет массовое сохранение данных о URL для указанного пользователя.
-	BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) error
+	// Уже сохранённые полные URL и занятые короткие URL не прерывают сохранение пакета:
+	// результат каждой ссылки возвращается в порядке data.
+	BulkSaveURL(ctx context.Context, data []models.InsertData, userID string) ([]models.BulkSaveResult, error)
 
-	// GetURL извлекает полный URL по его короткой версии.
+	// GetURL извлекает полный URL по его короткой версии. Для ссылки, срок действия
+	// которой ещё не начался или уже истёк, возвращает ErrNotActive или ErrExpired.
 	GetURL(ctx context.Context, shortURL string) (string, error)
 
 	// GetShortURL извлекает короткий URL по его полной версии.
@@ -45,3 +87,122 @@ type URLProvider interface {
 	// GetServiceStats получает статистику сервиса.
 	GetServiceStats(ctx context.Context) (models.ServiceStat, error)
 }
+
+// KeyStore определяет пул заранее сгенерированных свободных коротких URL (ключей).
+// Экземпляры приложения забирают ключи из пула пачками и используют их при создании ссылок.
+type KeyStore interface {
+	// AddKeys добавляет ключи в пул, пропуская ключи, которые уже есть в пуле
+	// или заняты сохранёнными ссылками. Возвращает количество добавленных ключей.
+	AddKeys(ctx context.Context, keys []string) (int, error)
+
+	// ClaimKeys забирает из пула не более n ключей. Забранные ключи удаляются из пула,
+	// поэтому другие экземпляры приложения их не получат.
+	ClaimKeys(ctx context.Context, n int) ([]string, error)
+
+	// ReleaseKeys возвращает в пул неиспользованные ключи.
+	ReleaseKeys(ctx context.Context, keys []string) error
+
+	// CountFreeKeys возвращает количество ключей в пуле.
+	CountFreeKeys(ctx context.Context) (int, error)
+}
+
+// SequenceStore реализуют хранилища, которые раздают экземплярам приложения
+// непересекающиеся диапазоны порядковых номеров для последовательного генератора.
+type SequenceStore interface {
+	// ReserveSequence резервирует n следующих порядковых номеров и возвращает первый из них.
+	ReserveSequence(ctx context.Context, n uint64) (uint64, error)
+}
+
+// LinkTransfer реализуют хранилища, ссылки которых можно переносить в другое
+// хранилище, например при добавлении шардов.
+type LinkTransfer interface {
+	// ScanLinks возвращает не более limit ссылок, включая удалённые, с короткими URL
+	// больше after в порядке возрастания короткого URL.
+	ScanLinks(ctx context.Context, after string, limit int) ([]models.Link, error)
+
+	// ImportLinks сохраняет ссылки вместе с владельцем, признаком удаления, временем
+	// создания и сроком действия, пропуская ссылки, короткий или полный URL которых уже занят.
+	// Возвращает короткие URL сохранённых ссылок.
+	ImportLinks(ctx context.Context, links []models.Link) ([]string, error)
+
+	// RemoveLinks безвозвратно удаляет ссылки, признак удаления которых не изменился
+	// с момента чтения links, и возвращает их короткие URL. Ссылки, удалённые после
+	// чтения, остаются, чтобы удаление можно было перенести вместе с ними.
+	RemoveLinks(ctx context.Context, links []models.Link) ([]string, error)
+}
+
+// Expirer реализуют хранилища, которые могут помечать удалёнными ссылки
+// с истёкшим сроком действия.
+type Expirer interface {
+	// ExpireURLs помечает удалёнными не более limit ссылок с истёкшим сроком действия
+	// и возвращает их короткие URL.
+	ExpireURLs(ctx context.Context, limit int) ([]string, error)
+}
+
+// ScheduleReader реализуют хранилища, которые возвращают ссылку вместе с её сроком
+// действия, чтобы обёртки, например кеш, могли проверять срок действия сами.
+type ScheduleReader interface {
+	// GetURLSchedule возвращает полный URL и срок действия ссылки, не проверяя его.
+	// Для удалённой ссылки возвращает ErrGone, для несуществующей - ErrNotFound.
+	GetURLSchedule(ctx context.Context, shortURL string) (string, models.Schedule, error)
+}
+
+// FullURLLocker реализуют хранилища, которые могут блокировать полные URL для всех
+// экземпляров приложения, например на время проверки уникальности полного URL
+// на нескольких шардах и сохранения ссылки.
+type FullURLLocker interface {
+	// LockFullURLs блокирует полные URL до вызова возвращённой функции unlock.
+	LockFullURLs(ctx context.Context, fullURLs []string) (unlock func(), err error)
+}
+
+// BulkShortURLReader реализуют хранилища, которые могут найти короткие URL
+// сразу для многих полных URL.
+type BulkShortURLReader interface {
+	// GetShortURLs возвращает короткие URL неудалённых ссылок по их полным URL.
+	// Полные URL, для которых ссылок нет, в результат не попадают.
+	GetShortURLs(ctx context.Context, fullURLs []string) (map[string]string, error)
+}
+
+// UserSketcher реализуют хранилища, которые оценивают количество пользователей так,
+// чтобы оценки нескольких шардов можно было объединить без перечисления пользователей.
+type UserSketcher interface {
+	// UserSketch возвращает оценку HyperLogLog идентификаторов пользователей, у которых
+	// есть ссылки, в том числе удалённые. Регистр выбирают младшие биты хеша hashtext
+	// идентификатора в postgres, поэтому оценки разных хранилищ должны считаться одинаково.
+	UserSketch(ctx context.Context) (hll.Sketch, error)
+}
+
+// ClickStore реализуют хранилища, которые сохраняют переходы по ссылкам.
+type ClickStore interface {
+	// SaveClicks сохраняет пакет переходов по ссылкам.
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+}
+
+// LinkStatsReader реализуют хранилища, из которых можно прочитать статистику
+// переходов по ссылкам.
+type LinkStatsReader interface {
+	// GetLinkOwner возвращает идентификатор владельца ссылки, в том числе удалённой
+	// или истёкшей. Для несуществующей ссылки возвращает ErrNotFound.
+	GetLinkOwner(ctx context.Context, shortURL string) (string, error)
+
+	// GetLinkStats возвращает статистику переходов по ссылке за период запроса.
+	// Шаги периода без переходов в Timeline не попадают.
+	GetLinkStats(ctx context.Context, query models.LinkStatsQuery) (models.LinkStats, error)
+}
+
+// CircuitState описывает состояние автоматического выключателя хранилища.
+type CircuitState string
+
+const (
+	// CircuitClosed - хранилище доступно, запросы передаются ему.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen - хранилище недоступно, запросы отклоняются без обращения к нему.
+	CircuitOpen CircuitState = "open"
+)
+
+// CircuitBreaker реализуют обёртки, которые перестают обращаться к недоступному
+// хранилищу до тех пор, пока проверки не покажут, что оно снова работает.
+type CircuitBreaker interface {
+	// CircuitState возвращает текущее состояние выключателя.
+	CircuitState() CircuitState
+}